@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// linkedDashboardUID returns the dashboard an alert rule belongs to: the
+// dashboardUid of legacy alerting, or the __dashboardUid__ annotation unified
+// alerting sets when a rule is created from a panel.
+func linkedDashboardUID(dashboardUID string, annotations map[string]string) string {
+	if dashboardUID != "" {
+		return dashboardUID
+	}
+	return annotations["__dashboardUid__"]
+}
+
+// describeLinkedDashboards sets the dashboard of each alert rule linked to
+// one, with its title when the dashboard is visible.
+func describeLinkedDashboards(ctx context.Context, alertRules []Alert) {
+	var titles map[string]string
+	for i := range alertRules {
+		alertRules[i].DashboardUID = linkedDashboardUID(alertRules[i].DashboardUID, alertRules[i].Annotations)
+		if alertRules[i].DashboardUID == "" {
+			continue
+		}
+
+		if titles == nil {
+			titles = make(map[string]string)
+			dashboards, err := fetchAllDashboards(ctx)
+			if err != nil {
+				log.Printf("Warning: Could not list dashboards for the alert rules: %v", err)
+			}
+			for _, dash := range dashboards {
+				titles[dash.UID] = dash.Title
+			}
+		}
+		alertRules[i].DashboardTitle = titles[alertRules[i].DashboardUID]
+	}
+}
+
+// linkedAlertIndex maps dashboard UIDs to the alert rules linked to them. The
+// alert rules are only listed when first needed.
+type linkedAlertIndex struct {
+	ctx   context.Context
+	rules map[string][]string
+	err   error
+
+	reported bool // Whether err is in the export's errors already
+}
+
+func newLinkedAlertIndex(ctx context.Context) *linkedAlertIndex {
+	return &linkedAlertIndex{ctx: ctx}
+}
+
+func (x *linkedAlertIndex) alertUIDs(dashboardUID string) ([]string, error) {
+	if x.rules == nil && x.err == nil {
+		var alertRules []Alert
+		if err := fetchAlertRules(x.ctx, "", &alertRules); err != nil {
+			x.err = err
+		} else {
+			x.rules = make(map[string][]string)
+			for _, rule := range alertRules {
+				if uid := linkedDashboardUID(rule.DashboardUID, rule.Annotations); uid != "" && rule.UID != "" {
+					x.rules[uid] = append(x.rules[uid], rule.UID)
+				}
+			}
+		}
+	}
+	if x.err != nil {
+		return nil, x.err
+	}
+	return x.rules[dashboardUID], nil
+}
+
+// exportLinkedAlerts writes the alert rules linked to a dashboard to
+// <title>.alerts/ next to its file, and marks them in exported.
+func exportLinkedAlerts(ctx context.Context, index *linkedAlertIndex, dashboardUID, dashboardFile string, exported, written map[string]bool, result *exportResult) {
+	uids, err := index.alertUIDs(dashboardUID)
+	if err != nil {
+		if !index.reported {
+			index.reported = true
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to list alert rules: %v", err))
+		}
+		return
+	}
+
+	alertsPath := strings.TrimSuffix(dashboardFile, ".json") + ".alerts"
+	for _, uid := range uids {
+		if exported[uid] {
+			continue
+		}
+		if err := exportAlertRule(ctx, uid, alertsPath, written, result); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		exported[uid] = true
+	}
+}
+
+// exportAlertRule writes the alert rule uid to dir as <title>.json. Titles
+// need not be unique; a rule whose file the export already wrote gets its UID
+// appended, and the file is marked in written.
+func exportAlertRule(ctx context.Context, uid, dir string, written map[string]bool, result *exportResult) error {
+	var alert map[string]interface{}
+	if err := fetchAlertRules(ctx, uid, &alert); err != nil {
+		return fmt.Errorf("Failed to fetch alert %s: %v", uid, err)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("Failed to create alerts folder: %v", err)
+	}
+
+	alertTitle, ok := alert["title"].(string)
+	if !ok {
+		alertTitle = uid
+	}
+
+	filename, err := safePath(dir, sanitizePath(alertTitle)+".json")
+	if err == nil && written[filename] {
+		filename, err = safePath(dir, sanitizePath(alertTitle+" "+uid)+".json")
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid filename for alert %s: %v", uid, err)
+	}
+	alertJSON, err := json.MarshalIndent(alert, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to marshal alert %s: %v", uid, err)
+	}
+
+	if err := os.WriteFile(filename, alertJSON, 0644); err != nil {
+		return fmt.Errorf("Failed to write alert %s: %v", uid, err)
+	}
+	written[filename] = true
+
+	result.ExportedAlerts++
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var alertsTestRoutes = map[string]any{
+	"/api/search":                `[{"id":11,"uid":"dash-1","title":"Service","type":"dash-db"}]`,
+	"/api/dashboards/uid/dash-1": `{"dashboard":{"id":11,"uid":"dash-1","title":"Service","panels":[]},"meta":{"folderId":0}}`,
+	"/api/v1/provisioning/alert-rules": `[
+		{"uid":"rule-linked","title":"High error rate","annotations":{"__dashboardUid__":"dash-1","__panelId__":"2"}},
+		{"uid":"rule-other","title":"Disk full","annotations":{"summary":"Disk is full"}}
+	]`,
+	"/api/v1/provisioning/alert-rules/rule-linked": `{"uid":"rule-linked","title":"High error rate","annotations":{"__dashboardUid__":"dash-1","__panelId__":"2"}}`,
+	"/api/v1/provisioning/alert-rules/rule-other":  `{"uid":"rule-other","title":"Disk full"}`,
+}
+
+func TestExportLinkedAlerts(t *testing.T) {
+	grafana := newFakeGrafana(alertsTestRoutes)
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: grafana.URL, ExportDirectory: t.TempDir()}
+	metaCache = newMetadataCache(time.Minute)
+
+	// The linked rule is also selected, but only written next to its dashboard
+	e := echo.New()
+	body := `{"dashboardUIDs":["dash-1"],"alertUIDs":["rule-linked","rule-other"],"includeAlerts":true,"includeLinkedAlerts":true}`
+	req := httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, exportDashboards(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var result exportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 2, result.ExportedAlerts)
+
+	data, err := os.ReadFile(filepath.Join(result.ExportPath, "General", "Service.alerts", "High error rate.json"))
+	assert.NoError(t, err)
+	var rule map[string]interface{}
+	json.Unmarshal(data, &rule)
+	assert.Equal(t, "rule-linked", rule["uid"])
+
+	assert.FileExists(t, filepath.Join(result.ExportPath, "Alerts", "Disk full.json"))
+	assert.NoFileExists(t, filepath.Join(result.ExportPath, "Alerts", "High error rate.json"))
+}
+
+func TestExportAlertsOfTheSameTitle(t *testing.T) {
+	grafana := newFakeGrafana(map[string]any{
+		"/api/search":                alertsTestRoutes["/api/search"],
+		"/api/dashboards/uid/dash-1": alertsTestRoutes["/api/dashboards/uid/dash-1"],
+		"/api/v1/provisioning/alert-rules": `[
+			{"uid":"rule-eu","title":"High error rate","annotations":{"__dashboardUid__":"dash-1"}},
+			{"uid":"rule-us","title":"High error rate","annotations":{"__dashboardUid__":"dash-1"}}
+		]`,
+		"/api/v1/provisioning/alert-rules/rule-eu": `{"uid":"rule-eu","title":"High error rate"}`,
+		"/api/v1/provisioning/alert-rules/rule-us": `{"uid":"rule-us","title":"High error rate"}`,
+	})
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: grafana.URL, ExportDirectory: t.TempDir()}
+	metaCache = newMetadataCache(time.Minute)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(`{"dashboardUIDs":["dash-1"],"includeLinkedAlerts":true}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, exportDashboards(e.NewContext(req, rec)))
+
+	var result exportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 2, result.ExportedAlerts)
+
+	// The second rule gets its UID appended instead of overwriting the first
+	alertsPath := filepath.Join(result.ExportPath, "General", "Service.alerts")
+	data, err := os.ReadFile(filepath.Join(alertsPath, "High error rate.json"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "rule-eu")
+	data, err = os.ReadFile(filepath.Join(alertsPath, "High error rate rule-us.json"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "rule-us")
+}
+
+func TestGetAlertsShowsLinkedDashboards(t *testing.T) {
+	grafana := newFakeGrafana(alertsTestRoutes)
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: grafana.URL}
+	metaCache = newMetadataCache(time.Minute)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	assert.NoError(t, getAlerts(e.NewContext(httptest.NewRequest(http.MethodGet, "/api/alerts", nil), rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response AlertResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	if assert.Len(t, response.Alerts, 2) {
+		assert.Equal(t, "dash-1", response.Alerts[0].DashboardUID)
+		assert.Equal(t, "Service", response.Alerts[0].DashboardTitle)
+		assert.Empty(t, response.Alerts[1].DashboardUID)
+	}
+}
+
+func TestLinkedDashboardUID(t *testing.T) {
+	assert.Equal(t, "legacy", linkedDashboardUID("legacy", map[string]string{"__dashboardUid__": "unified"}))
+	assert.Equal(t, "unified", linkedDashboardUID("", map[string]string{"__dashboardUid__": "unified"}))
+	assert.Empty(t, linkedDashboardUID("", nil))
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// annotationsPageLimit is how many annotations are asked for per request.
+	annotationsPageLimit = 1000
+
+	// orgAnnotationsFile holds the annotations not tied to a dashboard, at
+	// the root of an export or of an organization's subtree.
+	orgAnnotationsFile = "_org.annotations.json"
+)
+
+// grafanaAnnotation is an annotation as /api/annotations returns it.
+type grafanaAnnotation struct {
+	ID           int             `json:"id"`
+	DashboardID  int             `json:"dashboardId"`
+	DashboardUID string          `json:"dashboardUID"`
+	PanelID      int             `json:"panelId"`
+	Time         int64           `json:"time"`
+	TimeEnd      int64           `json:"timeEnd"`
+	Text         string          `json:"text"`
+	Tags         []string        `json:"tags"`
+	Login        string          `json:"login"`
+	Data         json.RawMessage `json:"data,omitempty"`
+}
+
+// exportedAnnotation is how an annotation is stored in an export, and what
+// an import reads back. Login is informational: imported annotations are
+// made by the exporter's Grafana credentials.
+type exportedAnnotation struct {
+	Time    int64           `json:"time"`
+	TimeEnd int64           `json:"timeEnd,omitempty"`
+	PanelID int             `json:"panelId,omitempty"`
+	Text    string          `json:"text"`
+	Tags    []string        `json:"tags,omitempty"`
+	Login   string          `json:"login,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// importResult reports an import like exportResult reports an export.
+type importResult struct {
+	ImportedAnnotations int      `json:"importedAnnotations"`
+	SkippedAnnotations  int      `json:"skippedAnnotations"` // Already in Grafana
+	Errors              []string `json:"errors"`
+}
+
+// annotationsQuery returns the /api/annotations filter for the time range of
+// opts. Alert annotations are left out; they are recreated by the alerts.
+func annotationsQuery(opts exportOptions) url.Values {
+	query := url.Values{"type": {"annotation"}}
+	if opts.AnnotationsFrom > 0 {
+		query.Set("from", strconv.FormatInt(opts.AnnotationsFrom, 10))
+	}
+	if opts.AnnotationsTo > 0 {
+		query.Set("to", strconv.FormatInt(opts.AnnotationsTo, 10))
+	}
+	return query
+}
+
+// withDashboardFilter narrows query to the annotations of dash. Grafanas
+// that know dashboardUID ignore dashboardId, older ones only know the ID.
+func withDashboardFilter(query url.Values, dash Dashboard) url.Values {
+	filtered := url.Values{}
+	for key, values := range query {
+		filtered[key] = append([]string(nil), values...)
+	}
+	filtered.Set("dashboardUID", dash.UID)
+	if dash.ID != 0 {
+		filtered.Set("dashboardId", strconv.Itoa(dash.ID))
+	}
+	return filtered
+}
+
+// fetchAnnotations returns the annotations matching query, newest first.
+// Grafana pages without an offset, so every further page asks for the
+// annotations up to the oldest one seen and skips those already returned.
+// Annotations beyond a page of the same time cannot be reached that way;
+// then the ones fetched are returned with an error.
+func fetchAnnotations(ctx context.Context, query url.Values) ([]grafanaAnnotation, error) {
+	page := url.Values{}
+	for key, values := range query {
+		page[key] = values
+	}
+	page.Set("limit", strconv.Itoa(annotationsPageLimit))
+
+	annotations := []grafanaAnnotation{}
+	seen := make(map[int]bool)
+	for {
+		var batch []grafanaAnnotation
+		if err := fetchAPIRaw(ctx, currentConfig().GrafanaURL+"/api/annotations?"+page.Encode(), &batch); err != nil {
+			return nil, err
+		}
+
+		added := 0
+		oldest := int64(0)
+		for i, annotation := range batch {
+			if i == 0 || annotation.Time < oldest {
+				oldest = annotation.Time
+			}
+			if seen[annotation.ID] {
+				continue
+			}
+			seen[annotation.ID] = true
+			annotations = append(annotations, annotation)
+			added++
+		}
+
+		if len(batch) < annotationsPageLimit {
+			return annotations, nil
+		}
+		if added == 0 {
+			return annotations, fmt.Errorf("more than %d annotations at %s, the others could not be fetched",
+				annotationsPageLimit, time.UnixMilli(oldest).UTC().Format(time.RFC3339))
+		}
+		page.Set("to", strconv.FormatInt(oldest, 10))
+	}
+}
+
+// exportDashboardAnnotations stores the annotations of a dashboard in the
+// time range of opts next to its file, as <title>.annotations.json.
+func exportDashboardAnnotations(ctx context.Context, dash Dashboard, dashboardFile string, opts exportOptions, result *exportResult) {
+	annotations, err := fetchAnnotations(ctx, withDashboardFilter(annotationsQuery(opts), dash))
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to fetch annotations of dashboard %s: %v", dash.UID, err))
+	}
+	if len(annotations) == 0 {
+		return
+	}
+
+	path := strings.TrimSuffix(dashboardFile, ".json") + ".annotations.json"
+	if err := writeAnnotations(path, annotations); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to write annotations of dashboard %s: %v", dash.UID, err))
+		return
+	}
+	result.ExportedAnnotations += len(annotations)
+}
+
+// exportOrgAnnotations stores the annotations in the time range of opts that
+// are not tied to a dashboard in exportPath.
+func exportOrgAnnotations(ctx context.Context, exportPath string, opts exportOptions, result *exportResult) {
+	annotations, err := fetchAnnotations(ctx, annotationsQuery(opts))
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to fetch organization annotations: %v", err))
+	}
+
+	orgAnnotations := []grafanaAnnotation{}
+	for _, annotation := range annotations {
+		if annotation.DashboardUID == "" && annotation.DashboardID == 0 {
+			orgAnnotations = append(orgAnnotations, annotation)
+		}
+	}
+	if len(orgAnnotations) == 0 {
+		return
+	}
+
+	if err := writeAnnotations(filepath.Join(exportPath, orgAnnotationsFile), orgAnnotations); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to write organization annotations: %v", err))
+		return
+	}
+	result.ExportedAnnotations += len(orgAnnotations)
+}
+
+func writeAnnotations(path string, annotations []grafanaAnnotation) error {
+	exported := make([]exportedAnnotation, 0, len(annotations))
+	for _, annotation := range annotations {
+		exported = append(exported, exportedAnnotation{
+			Time:    annotation.Time,
+			TimeEnd: annotation.TimeEnd,
+			PanelID: annotation.PanelID,
+			Text:    annotation.Text,
+			Tags:    annotation.Tags,
+			Login:   annotation.Login,
+			Data:    annotation.Data,
+		})
+	}
+
+	data, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// annotationKey identifies an annotation across Grafana instances, where
+// IDs differ. Point annotations have timeEnd equal to time, or unset.
+func annotationKey(panelID int, time, timeEnd int64, text string) string {
+	if timeEnd == 0 {
+		timeEnd = time
+	}
+	return fmt.Sprintf("%d|%d|%d|%s", panelID, time, timeEnd, text)
+}
+
+// importAnnotations creates the annotations of an exported annotations file
+// in Grafana: on the dashboard ?dashboardUID, or for the organization without
+// it. Annotations that already exist are skipped, so a file can be imported
+// again after a partial failure.
+func importAnnotations(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	audit := newAuditEntry(c, auditActionImport)
+	defer func() {
+		audit.Status = c.Response().Status
+		auditLogger.Record(audit)
+	}()
+
+	dashboardUID := c.QueryParam("dashboardUID")
+	audit.UIDs = map[string][]string{}
+	if dashboardUID != "" {
+		audit.UIDs["dashboards"] = []string{dashboardUID}
+	}
+
+	var annotations []exportedAnnotation
+	if err := json.NewDecoder(c.Request().Body).Decode(&annotations); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Expected a JSON array of annotations"})
+	}
+	if len(annotations) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No annotations to import"})
+	}
+
+	result := importAnnotationList(ctx, dashboardUID, annotations)
+	audit.Counts = map[string]int{"annotations": result.ImportedAnnotations}
+	audit.Errors = result.Errors
+	return c.JSON(http.StatusOK, result)
+}
+
+func importAnnotationList(ctx context.Context, dashboardUID string, annotations []exportedAnnotation) importResult {
+	result := importResult{Errors: []string{}}
+
+	var dash Dashboard
+	if dashboardUID != "" {
+		ref, _, err := fetchDashboardRef(ctx, dashboardUID)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to fetch dashboard %s: %v", dashboardUID, err))
+			return result
+		}
+		dash = ref
+	}
+
+	// Read what Grafana already has in the time range of the file
+	opts := exportOptions{AnnotationsFrom: annotations[0].Time, AnnotationsTo: annotations[0].Time}
+	for _, annotation := range annotations {
+		opts.AnnotationsFrom = min(opts.AnnotationsFrom, annotation.Time)
+		opts.AnnotationsTo = max(opts.AnnotationsTo, annotation.Time, annotation.TimeEnd)
+	}
+	query := annotationsQuery(opts)
+	if dashboardUID != "" {
+		query = withDashboardFilter(query, dash)
+	}
+	existing, err := fetchAnnotations(ctx, query)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to fetch existing annotations: %v", err))
+		return result
+	}
+	known := make(map[string]bool, len(existing))
+	for _, annotation := range existing {
+		if dashboardUID == "" && (annotation.DashboardUID != "" || annotation.DashboardID != 0) {
+			continue
+		}
+		known[annotationKey(annotation.PanelID, annotation.Time, annotation.TimeEnd, annotation.Text)] = true
+	}
+
+	for _, annotation := range annotations {
+		key := annotationKey(annotation.PanelID, annotation.Time, annotation.TimeEnd, annotation.Text)
+		if known[key] {
+			result.SkippedAnnotations++
+			continue
+		}
+
+		payload := map[string]interface{}{
+			"time":    annotation.Time,
+			"timeEnd": annotation.TimeEnd,
+			"text":    annotation.Text,
+			"tags":    annotation.Tags,
+		}
+		if dashboardUID != "" {
+			payload["dashboardUID"] = dash.UID
+			payload["dashboardId"] = dash.ID
+			payload["panelId"] = annotation.PanelID
+		}
+		if len(annotation.Data) > 0 {
+			payload["data"] = annotation.Data
+		}
+
+		if err := sendAPI(ctx, http.MethodPost, currentConfig().GrafanaURL+"/api/annotations", payload, nil); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to import annotation at %d: %v", annotation.Time, err))
+			continue
+		}
+		known[key] = true
+		result.ImportedAnnotations++
+	}
+
+	return result
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// annotationsTestGrafana keeps annotations like Grafana: newest first,
+// filtered by dashboard and time range, and answering at most limit.
+type annotationsTestGrafana struct {
+	mu          sync.Mutex
+	annotations []grafanaAnnotation
+	requests    int
+}
+
+// start serves the annotations next to dashboard dash-1.
+func (g *annotationsTestGrafana) start() *httptest.Server {
+	return newFakeGrafana(map[string]any{
+		"/api/dashboards/uid/dash-1": `{"dashboard":{"id":11,"uid":"dash-1","title":"Service","version":1},"meta":{"folderId":0}}`,
+		"/api/annotations":           http.HandlerFunc(g.serveAnnotations),
+	})
+}
+
+func (g *annotationsTestGrafana) serveAnnotations(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		g.requests++
+		query := r.URL.Query()
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		from, _ := strconv.ParseInt(query.Get("from"), 10, 64)
+		to, _ := strconv.ParseInt(query.Get("to"), 10, 64)
+
+		page := []grafanaAnnotation{}
+		for i := len(g.annotations) - 1; i >= 0 && len(page) < limit; i-- {
+			annotation := g.annotations[i]
+			if uid := query.Get("dashboardUID"); uid != "" && annotation.DashboardUID != uid {
+				continue
+			}
+			if (from > 0 && annotation.TimeEnd < from) || (to > 0 && annotation.Time > to) {
+				continue
+			}
+			page = append(page, annotation)
+		}
+		json.NewEncoder(w).Encode(page)
+	case http.MethodPost:
+		var annotation grafanaAnnotation
+		json.NewDecoder(r.Body).Decode(&annotation)
+		annotation.ID = len(g.annotations) + 1
+		g.annotations = append(g.annotations, annotation)
+		w.Write([]byte(`{"message":"Annotation added","id":` + strconv.Itoa(annotation.ID) + `}`))
+	default:
+		http.Error(w, `{"message":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestFetchAnnotationsPages(t *testing.T) {
+	// More annotations than fit on a page, two of them at the same time
+	grafana := &annotationsTestGrafana{}
+	for i := 1; i <= annotationsPageLimit+5; i++ {
+		at := int64(i * 1000)
+		if i == 6 {
+			at = 5000
+		}
+		grafana.annotations = append(grafana.annotations, grafanaAnnotation{ID: i, Time: at, TimeEnd: at, Text: "deploy"})
+	}
+	server := grafana.start()
+	defer server.Close()
+
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	config = Config{GrafanaURL: server.URL}
+
+	annotations, err := fetchAnnotations(t.Context(), annotationsQuery(exportOptions{}))
+	assert.NoError(t, err)
+	assert.Len(t, annotations, annotationsPageLimit+5)
+	assert.Equal(t, 2, grafana.requests)
+
+	// Paging by time cannot get past a full page of the same time
+	grafana.annotations = nil
+	for i := 1; i <= annotationsPageLimit+1; i++ {
+		grafana.annotations = append(grafana.annotations, grafanaAnnotation{ID: i, Time: 5000, TimeEnd: 5000, Text: "deploy"})
+	}
+	annotations, err = fetchAnnotations(t.Context(), annotationsQuery(exportOptions{}))
+	assert.ErrorContains(t, err, "the others could not be fetched")
+	assert.Len(t, annotations, annotationsPageLimit)
+}
+
+func TestExportAnnotations(t *testing.T) {
+	grafana := &annotationsTestGrafana{annotations: []grafanaAnnotation{
+		{ID: 1, DashboardUID: "dash-1", DashboardID: 11, PanelID: 2, Time: 1000, TimeEnd: 1000, Text: "too old"},
+		{ID: 2, DashboardUID: "dash-1", DashboardID: 11, PanelID: 2, Time: 5000, TimeEnd: 6000, Text: "incident", Tags: []string{"sev1"}, Login: "alice"},
+		{ID: 3, Time: 7000, TimeEnd: 7000, Text: "release 1.2", Tags: []string{"deploy"}},
+		{ID: 4, DashboardUID: "other", DashboardID: 12, Time: 7000, TimeEnd: 7000, Text: "elsewhere"},
+	}}
+	server := grafana.start()
+	defer server.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: server.URL, ExportDirectory: t.TempDir()}
+	metaCache = newMetadataCache(time.Minute)
+
+	e := echo.New()
+	body := `{"dashboardUIDs":["dash-1"],"includeAnnotations":true,"annotationsFrom":2000}`
+	req := httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, exportDashboards(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var result exportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 2, result.ExportedAnnotations)
+
+	var dashboardAnnotations []exportedAnnotation
+	data, err := os.ReadFile(filepath.Join(result.ExportPath, "General", "Service.annotations.json"))
+	assert.NoError(t, err)
+	json.Unmarshal(data, &dashboardAnnotations)
+	assert.Equal(t, []exportedAnnotation{
+		{Time: 5000, TimeEnd: 6000, PanelID: 2, Text: "incident", Tags: []string{"sev1"}, Login: "alice"},
+	}, dashboardAnnotations)
+
+	var orgAnnotations []exportedAnnotation
+	data, err = os.ReadFile(filepath.Join(result.ExportPath, orgAnnotationsFile))
+	assert.NoError(t, err)
+	json.Unmarshal(data, &orgAnnotations)
+	assert.Equal(t, []exportedAnnotation{{Time: 7000, TimeEnd: 7000, Text: "release 1.2", Tags: []string{"deploy"}}}, orgAnnotations)
+
+	// Without a time range a selection leaves the organization's annotations out
+	config.ExportDirectory = t.TempDir()
+	req = httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(`{"dashboardUIDs":["dash-1"],"includeAnnotations":true}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	assert.NoError(t, exportDashboards(e.NewContext(req, rec)))
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Equal(t, 2, result.ExportedAnnotations)
+	_, err = os.Stat(filepath.Join(result.ExportPath, orgAnnotationsFile))
+	assert.True(t, os.IsNotExist(err))
+
+	req = httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(`{"dashboardUIDs":["dash-1"],"annotationsFrom":5,"annotationsTo":4}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	assert.NoError(t, exportDashboards(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestImportAnnotations(t *testing.T) {
+	grafana := &annotationsTestGrafana{annotations: []grafanaAnnotation{
+		{ID: 1, DashboardUID: "dash-1", DashboardID: 11, PanelID: 2, Time: 5000, TimeEnd: 6000, Text: "incident"},
+	}}
+	server := grafana.start()
+	defer server.Close()
+
+	originalConfig := config
+	originalAudit := auditLogger
+	defer func() {
+		config = originalConfig
+		auditLogger = originalAudit
+	}()
+	config = Config{GrafanaURL: server.URL}
+	var err error
+	auditLogger, err = openAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+	assert.NoError(t, err)
+
+	e := echo.New()
+	e.POST("/api/annotations/import", importAnnotations)
+
+	body := `[
+		{"time":5000,"timeEnd":6000,"panelId":2,"text":"incident"},
+		{"time":8000,"panelId":3,"text":"rollback","tags":["deploy"]}
+	]`
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/annotations/import?dashboardUID=dash-1", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var result importResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Equal(t, importResult{ImportedAnnotations: 1, SkippedAnnotations: 1, Errors: []string{}}, result)
+
+	// The new annotation is on the dashboard, by UID and ID
+	assert.Len(t, grafana.annotations, 2)
+	added := grafana.annotations[1]
+	assert.Equal(t, "dash-1", added.DashboardUID)
+	assert.Equal(t, 11, added.DashboardID)
+	assert.Equal(t, 3, added.PanelID)
+	assert.Equal(t, []string{"deploy"}, added.Tags)
+
+	for _, body := range []string{`[]`, `{"annotations":[]}`} {
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/annotations/import", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	}
+
+	entries, _, err := auditLogger.Query(auditFilter{Action: auditActionImport, Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
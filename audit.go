@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Audited operations.
+const (
+	auditActionExport   = "export"
+	auditActionSettings = "settings"
+	auditActionRestore  = "restore"
+	auditActionImport   = "import"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// auditEntry records one operation that reads from or changes Grafana on
+// behalf of a user. UIDs and Counts are keyed by object kind, e.g.
+// "dashboards" or "alerts", so that every operation can use the same shape.
+type auditEntry struct {
+	Time       time.Time           `json:"time"`
+	Action     string              `json:"action"`
+	User       string              `json:"user"`
+	Provider   string              `json:"provider"`
+	ClientIP   string              `json:"clientIp"`
+	UIDs       map[string][]string `json:"uids,omitempty"`
+	Counts     map[string]int      `json:"counts,omitempty"`
+	Errors     []string            `json:"errors,omitempty"`
+	ExportPath string              `json:"exportPath,omitempty"`
+	SizeBytes  int64               `json:"sizeBytes,omitempty"`
+	Settings   []string            `json:"settings,omitempty"` // Names of changed settings
+	Status     int                 `json:"status"`
+}
+
+func newAuditEntry(c echo.Context, action string) *auditEntry {
+	user := currentUser(c)
+	return &auditEntry{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		User:     user.Name,
+		Provider: user.Provider,
+		ClientIP: c.RealIP(),
+	}
+}
+
+// clientIPExtractor decides where the client address of audit entries comes
+// from. X-Forwarded-For is only believed when the request comes through one
+// of the TRUSTED_PROXIES; otherwise anyone could write any address into the
+// audit log, so the address of the connection is used.
+func clientIPExtractor(cfg Config) echo.IPExtractor {
+	proxies, err := parseProxyList(cfg.TrustedProxies)
+	if err != nil || len(proxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range proxies {
+		options = append(options, echo.TrustIPRange(proxy))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// parseProxyList parses a comma separated list of IP addresses and CIDR
+// ranges.
+func parseProxyList(value string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address or CIDR range", entry)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 128
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, proxy, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", entry)
+		}
+		proxies = append(proxies, proxy)
+	}
+	return proxies, nil
+}
+
+// auditLog appends entries as JSON lines to a file that is only ever opened
+// for appending, and reads them back for /api/audit.
+type auditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+var auditLogger *auditLog
+
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	return &auditLog{path: path, file: file}, nil
+}
+
+// Record appends the entry. Failing to write the audit log is logged but
+// does not fail the request, which has already been answered.
+func (a *auditLog) Record(entry *auditEntry) {
+	if a == nil {
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error: Could not encode audit entry: %v", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Error: Could not write audit log: %v", err)
+		return
+	}
+	if err := a.file.Sync(); err != nil {
+		log.Printf("Error: Could not sync audit log: %v", err)
+	}
+}
+
+// auditFilter selects entries; zero fields match everything.
+type auditFilter struct {
+	User   string
+	Action string
+	UID    string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+func (f auditFilter) matches(entry auditEntry) bool {
+	if f.User != "" && entry.User != f.User {
+		return false
+	}
+	if f.Action != "" && entry.Action != f.Action {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && entry.Time.After(f.Until) {
+		return false
+	}
+	if f.UID != "" {
+		for _, uids := range entry.UIDs {
+			if slices.Contains(uids, f.UID) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Query returns the newest entries matching the filter, newest first, and
+// the total number of matches.
+func (a *auditLog) Query(filter auditFilter) ([]auditEntry, int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	file, err := os.Open(a.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var matches []auditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A torn last line must not hide the rest of the log
+			continue
+		}
+		if filter.matches(entry) {
+			matches = append(matches, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	total := len(matches)
+	slices.Reverse(matches)
+	if len(matches) > filter.Limit {
+		matches = matches[:filter.Limit]
+	}
+	return matches, total, nil
+}
+
+func getAuditLog(c echo.Context) error {
+	if auditLogger == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Audit log is disabled"})
+	}
+
+	filter := auditFilter{
+		User:   c.QueryParam("user"),
+		Action: c.QueryParam("action"),
+		UID:    c.QueryParam("uid"),
+		Limit:  defaultAuditLimit,
+	}
+
+	for param, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := c.QueryParam(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid " + param + ", expected RFC 3339 time"})
+			}
+			*target = parsed
+		}
+	}
+
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit"})
+		}
+		filter.Limit = min(limit, maxAuditLimit)
+	}
+
+	entries, total, err := auditLogger.Query(filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read audit log: " + err.Error()})
+	}
+	if entries == nil {
+		entries = []auditEntry{}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"entries": entries,
+		"total":   total,
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLogQuery(t *testing.T) {
+	logger, err := openAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+	assert.NoError(t, err)
+
+	e := echo.New()
+	record := func(user string, at time.Time, dashboards ...string) {
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/api/export", nil), httptest.NewRecorder())
+		c.Set(userContextKey, &User{Name: user, Provider: "basic"})
+		entry := newAuditEntry(c, auditActionExport)
+		entry.Time = at
+		entry.UIDs = map[string][]string{"dashboards": dashboards}
+		logger.Record(entry)
+	}
+
+	start := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	record("alice", start, "d1", "d2")
+	record("bob", start.Add(time.Hour), "d2")
+	record("alice", start.Add(2*time.Hour), "d3")
+
+	entries, total, err := logger.Query(auditFilter{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, []string{"d3"}, entries[0].UIDs["dashboards"], "newest first")
+
+	entries, total, _ = logger.Query(auditFilter{User: "alice", Limit: 1})
+	assert.Equal(t, 2, total)
+	assert.Len(t, entries, 1)
+
+	entries, _, _ = logger.Query(auditFilter{UID: "d2", Limit: 10})
+	assert.Len(t, entries, 2)
+
+	entries, _, _ = logger.Query(auditFilter{Since: start.Add(30 * time.Minute), Until: start.Add(90 * time.Minute), Limit: 10})
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "bob", entries[0].User)
+}
+
+func TestExportIsAudited(t *testing.T) {
+	originalConfig := config
+	originalCache := metaCache
+	originalAudit := auditLogger
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+		auditLogger = originalAudit
+	}()
+
+	ts := newFakeGrafana(map[string]any{
+		"/api/dashboards/uid/audited": `{"dashboard":{"title":"Audited"},"meta":{"folderId":0}}`,
+	})
+	defer ts.Close()
+
+	tempDir := t.TempDir()
+	config = Config{GrafanaURL: ts.URL, ExportDirectory: tempDir}
+	metaCache = newMetadataCache(time.Minute)
+
+	var err error
+	auditLogger, err = openAuditLog(filepath.Join(tempDir, "audit.log"))
+	assert.NoError(t, err)
+
+	// Requests come through a proxy at httptest's 192.0.2.1
+	e := echo.New()
+	e.IPExtractor = clientIPExtractor(Config{TrustedProxies: "192.0.2.0/24"})
+	e.GET("/api/audit", getAuditLog)
+	e.POST("/api/export", exportDashboards, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(userContextKey, &User{Name: "alice", Provider: "oidc", Role: roleAdmin})
+			return next(c)
+		}
+	})
+
+	for _, body := range []string{`{"dashboardUIDs":["audited","missing"]}`, `{"dashboardUIDs":[]}`} {
+		req := httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.7")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// The log is plain JSON lines
+	content, err := os.ReadFile(filepath.Join(tempDir, "audit.log"))
+	assert.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(content)), "\n"), 2)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/audit?uid=audited", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Entries []auditEntry `json:"entries"`
+		Total   int          `json:"total"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.Total)
+
+	entry := response.Entries[0]
+	assert.Equal(t, "alice", entry.User)
+	assert.Equal(t, "203.0.113.7", entry.ClientIP)
+	assert.Equal(t, http.StatusOK, entry.Status)
+	assert.Equal(t, 1, entry.Counts["dashboards"])
+	assert.Len(t, entry.Errors, 1)
+	assert.True(t, strings.HasPrefix(entry.ExportPath, tempDir))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/audit?since=yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAuditIgnoresForwardedForWithoutTrustedProxies(t *testing.T) {
+	var recorded []string
+	e := echo.New()
+	e.IPExtractor = clientIPExtractor(Config{})
+	e.GET("/api/ping", func(c echo.Context) error {
+		recorded = append(recorded, newAuditEntry(c, auditActionExport).ClientIP)
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.7")
+	req.Header.Set(echo.HeaderXRealIP, "203.0.113.8")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	// A proxy that is not trusted is the client as far as the log goes
+	e.IPExtractor = clientIPExtractor(Config{TrustedProxies: "10.0.0.1"})
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, []string{"192.0.2.1", "192.0.2.1"}, recorded)
+
+	_, err := parseProxyList("10.0.0.0/8, 192.168.1.1,::1")
+	assert.NoError(t, err)
+	_, err = parseProxyList("proxy.local")
+	assert.Error(t, err)
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	sessionCookieName = "exporter_session"
+	userContextKey    = "user"
+	defaultSessionTTL = 12 * time.Hour
+)
+
+// User is the identity of whoever is calling the exporter's own API.
+type User struct {
+	Name     string   `json:"name"`
+	Email    string   `json:"email,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	Provider string   `json:"provider"` // basic, token, oidc, grafana or anonymous
+	Role     string   `json:"role"`
+
+	// grafana is set when the user calls Grafana with their own credentials
+	grafana *grafanaCredentials
+}
+
+// anonymousUser is everyone when authentication is disabled, so it may do
+// everything, as before roles existed.
+var anonymousUser = &User{Name: "anonymous", Provider: "anonymous", Role: roleAdmin}
+
+// dummyPasswordHash is compared against for unknown user names so that a
+// failed login takes the same time whether or not the user exists.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+type session struct {
+	user      *User
+	expiresAt time.Time
+}
+
+// sessionStore keeps browser sessions created by interactive logins in memory.
+type sessionStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*session
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{ttl: ttl, sessions: make(map[string]*session)}
+}
+
+func (s *sessionStore) Create(user *User) (string, error) {
+	id, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for existingID, existing := range s.sessions {
+		if now.After(existing.expiresAt) {
+			delete(s.sessions, existingID)
+		}
+	}
+	expiresAt := now.Add(s.ttl)
+	if user.grafana != nil && !user.grafana.expiresAt.IsZero() && user.grafana.expiresAt.Before(expiresAt) {
+		// The session is useless once Grafana stops accepting its token
+		expiresAt = user.grafana.expiresAt
+	}
+	s.sessions[id] = &session{user: user, expiresAt: expiresAt}
+	return id, nil
+}
+
+func (s *sessionStore) Get(id string) (*session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(existing.expiresAt) {
+		delete(s.sessions, id)
+		return nil, false
+	}
+	return existing, true
+}
+
+func (s *sessionStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+}
+
+// authenticator protects the exporter's API. Callers authenticate with a
+// static basic-auth user, a bearer token meant for automation, or a browser
+// session created through OIDC login. When none of these are configured the
+// API stays open, as it was before authentication existed.
+//
+// With GRAFANA_CREDENTIALS=user, callers may also authenticate with their own
+// Grafana credentials (basic auth or a Grafana token), and OIDC sessions keep
+// the user's token. Those users call Grafana as themselves, so listings and
+// exports follow their Grafana permissions.
+type authenticator struct {
+	basicUsers     map[string]string // user name -> plain password or bcrypt hash
+	tokens         map[string]string // token -> name of the automation client
+	oidc           *oidcProvider
+	sessions       *sessionStore
+	passThrough    bool
+	oidcTokenType  string // which OIDC token is forwarded to Grafana
+	verifiedLogins *verifiedLogins
+	roles          *roleMapper
+}
+
+func newAuthenticator(cfg Config) (*authenticator, error) {
+	basicUsers, err := parseCredentialList(cfg.AuthBasicUsers, "AUTH_BASIC_USERS")
+	if err != nil {
+		return nil, err
+	}
+
+	namedTokens, err := parseCredentialList(cfg.AuthBearerTokens, "AUTH_BEARER_TOKENS")
+	if err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]string, len(namedTokens))
+	for name, token := range namedTokens {
+		tokens[token] = name
+	}
+
+	sessionTTL := cfg.SessionTTL
+	if sessionTTL <= 0 {
+		sessionTTL = defaultSessionTTL
+	}
+
+	roles, err := newRoleMapper(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &authenticator{
+		roles:          roles,
+		basicUsers:     basicUsers,
+		tokens:         tokens,
+		sessions:       newSessionStore(sessionTTL),
+		oidcTokenType:  cfg.OIDCGrafanaToken,
+		verifiedLogins: newVerifiedLogins(),
+	}
+
+	switch cfg.GrafanaCredentials {
+	case "", grafanaCredentialsShared:
+	case grafanaCredentialsUser:
+		a.passThrough = true
+	default:
+		return nil, fmt.Errorf("invalid GRAFANA_CREDENTIALS %q, expected %s or %s",
+			cfg.GrafanaCredentials, grafanaCredentialsShared, grafanaCredentialsUser)
+	}
+
+	switch a.oidcTokenType {
+	case "":
+		a.oidcTokenType = "access_token"
+	case "access_token", "id_token":
+	default:
+		return nil, fmt.Errorf("invalid OIDC_GRAFANA_TOKEN %q, expected access_token or id_token", a.oidcTokenType)
+	}
+
+	if cfg.OIDCIssuerURL != "" {
+		if cfg.OIDCClientID == "" || cfg.OIDCRedirectURL == "" {
+			return nil, fmt.Errorf("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER_URL is set")
+		}
+		a.oidc = newOIDCProvider(cfg)
+	}
+
+	return a, nil
+}
+
+// parseCredentialList parses "name:secret,name2:secret2".
+func parseCredentialList(value, setting string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, secret, ok := strings.Cut(item, ":")
+		if !ok || name == "" || secret == "" {
+			return nil, fmt.Errorf("invalid %s entry %q, expected name:secret", setting, item)
+		}
+		result[name] = secret
+	}
+	return result, nil
+}
+
+func (a *authenticator) Enabled() bool {
+	return len(a.basicUsers) > 0 || len(a.tokens) > 0 || a.oidc != nil || a.passThrough
+}
+
+// Middleware authenticates every /api/ request. Static files and the /auth/
+// login flow stay public so that the UI can load and redirect to the login.
+func (a *authenticator) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !a.Enabled() {
+				c.Set(userContextKey, anonymousUser)
+				return next(c)
+			}
+
+			if !strings.HasPrefix(c.Request().URL.Path, "/api/") {
+				return next(c)
+			}
+
+			user, err := a.authenticate(c)
+			if err != nil {
+				return a.unauthorized(c, err.Error())
+			}
+			if user == nil {
+				return a.unauthorized(c, "Authentication required")
+			}
+
+			// Users are shared between requests, so the role goes on a copy
+			withRole := *user
+			withRole.Role = a.roles.RoleFor(user)
+			c.Set(userContextKey, &withRole)
+
+			if user.grafana != nil {
+				request := c.Request()
+				c.SetRequest(request.WithContext(withGrafanaCredentials(request.Context(), user.grafana)))
+			}
+			return next(c)
+		}
+	}
+}
+
+// authenticate returns the caller's identity, nil when no credentials were
+// presented, or an error when the presented credentials are wrong.
+func (a *authenticator) authenticate(c echo.Context) (*User, error) {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		for known, name := range a.tokens {
+			if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+				return &User{Name: name, Provider: "token"}, nil
+			}
+		}
+		if a.passThrough {
+			return a.verifiedLogins.Verify(c.Request().Context(), &grafanaCredentials{token: token})
+		}
+		return nil, fmt.Errorf("invalid bearer token")
+	}
+
+	if username, password, ok := c.Request().BasicAuth(); ok {
+		if a.checkBasicPassword(username, password) {
+			return &User{Name: username, Provider: "basic"}, nil
+		}
+		if a.passThrough {
+			return a.verifiedLogins.Verify(c.Request().Context(), &grafanaCredentials{username: username, password: password})
+		}
+		return nil, fmt.Errorf("invalid username or password")
+	}
+
+	if cookie, err := c.Cookie(sessionCookieName); err == nil {
+		if existing, ok := a.sessions.Get(cookie.Value); ok {
+			return existing.user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (a *authenticator) checkBasicPassword(username, password string) bool {
+	expected, ok := a.basicUsers[username]
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return false
+	}
+
+	if strings.HasPrefix(expected, "$2") {
+		return bcrypt.CompareHashAndPassword([]byte(expected), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
+
+func (a *authenticator) unauthorized(c echo.Context, message string) error {
+	response := map[string]string{"error": message}
+
+	if a.oidc != nil {
+		response["loginUrl"] = "/auth/login"
+	} else if len(a.basicUsers) > 0 || a.passThrough {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="grafana-exporter"`)
+	}
+
+	return c.JSON(http.StatusUnauthorized, response)
+}
+
+// RegisterRoutes adds the login flow and the current-user endpoint.
+func (a *authenticator) RegisterRoutes(e *echo.Echo) {
+	e.GET("/api/me", a.getCurrentUser)
+	// A POST, so that other sites cannot log users out with a link or image
+	e.POST("/auth/logout", a.logout)
+
+	if a.oidc != nil {
+		e.GET("/auth/login", a.oidcLogin)
+		e.GET("/auth/callback", a.oidcCallback)
+	}
+}
+
+func (a *authenticator) getCurrentUser(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"user":        currentUser(c),
+		"authEnabled": a.Enabled(),
+	})
+}
+
+func (a *authenticator) logout(c echo.Context) error {
+	if cookie, err := c.Cookie(sessionCookieName); err == nil {
+		a.sessions.Delete(cookie.Value)
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	return c.Redirect(http.StatusFound, "/")
+}
+
+func (a *authenticator) startSession(c echo.Context, user *User) error {
+	id, err := a.sessions.Create(user)
+	if err != nil {
+		return err
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookieName,
+		Value:    id,
+		Path:     "/",
+		Expires:  time.Now().Add(a.sessions.ttl),
+		HttpOnly: true,
+		Secure:   c.Request().TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// currentUser returns the identity set by the auth middleware.
+func currentUser(c echo.Context) *User {
+	if user, ok := c.Get(userContextKey).(*User); ok {
+		return user
+	}
+	return anonymousUser
+}
+
+// corsMiddleware allows cross-origin calls only from the configured origins.
+// Without an allowlist no CORS headers are sent and only the exporter's own
+// UI can call the API from a browser.
+func corsMiddleware(cfg Config) echo.MiddlewareFunc {
+	var origins []string
+	for _, origin := range strings.Split(cfg.CORSAllowedOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	if len(origins) == 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	}
+
+	allowCredentials := true
+	for _, origin := range origins {
+		if origin == "*" {
+			log.Println("Warning: CORS_ALLOWED_ORIGINS contains *, credentials will not be sent cross-origin")
+			allowCredentials = false
+		}
+	}
+
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:     origins,
+		AllowCredentials: allowCredentials,
+	})
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newAuthTestServer wires an authenticator into an Echo instance with a
+// protected /api/ping endpoint and a public static page.
+func newAuthTestServer(t *testing.T, cfg Config) (*echo.Echo, *authenticator) {
+	auth, err := newAuthenticator(cfg)
+	assert.NoError(t, err)
+
+	e := echo.New()
+	e.Use(corsMiddleware(cfg))
+	e.Use(auth.Middleware())
+	auth.RegisterRoutes(e)
+	e.GET("/api/ping", func(c echo.Context) error {
+		return c.String(http.StatusOK, currentUser(c).Name)
+	})
+	e.GET("/index.html", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ui")
+	})
+	return e, auth
+}
+
+func serve(e *echo.Echo, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func findCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestAuthDisabledAllowsEverything(t *testing.T) {
+	e, auth := newAuthTestServer(t, Config{})
+	assert.False(t, auth.Enabled())
+
+	rec := serve(e, httptest.NewRequest(http.MethodGet, "/api/ping", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "anonymous", rec.Body.String())
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	e, _ := newAuthTestServer(t, Config{AuthBasicUsers: "alice:plain-pass,bob:" + string(hash)})
+
+	rec := serve(e, httptest.NewRequest(http.MethodGet, "/api/ping", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Basic")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.SetBasicAuth("alice", "plain-pass")
+	rec = serve(e, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "alice", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.SetBasicAuth("bob", "s3cret")
+	rec = serve(e, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "bob", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.SetBasicAuth("bob", "wrong")
+	rec = serve(e, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.SetBasicAuth("mallory", "plain-pass")
+	rec = serve(e, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// Static files stay public so the UI can load
+	rec = serve(e, httptest.NewRequest(http.MethodGet, "/index.html", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestBearerTokenAuth(t *testing.T) {
+	e, _ := newAuthTestServer(t, Config{AuthBearerTokens: "ci:token-1,backup:token-2"})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.Header.Set("Authorization", "Bearer token-2")
+	rec := serve(e, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "backup", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.Header.Set("Authorization", "Bearer nope")
+	rec = serve(e, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, rec.Header().Get("WWW-Authenticate"))
+}
+
+func TestInvalidCredentialList(t *testing.T) {
+	_, err := newAuthenticator(Config{AuthBasicUsers: "alice"})
+	assert.Error(t, err)
+
+	_, err = newAuthenticator(Config{OIDCIssuerURL: "http://idp"})
+	assert.Error(t, err)
+}
+
+func TestCORSAllowlist(t *testing.T) {
+	e, _ := newAuthTestServer(t, Config{CORSAllowedOrigins: "https://allowed.example"})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.Header.Set("Origin", "https://allowed.example")
+	rec := serve(e, req)
+	assert.Equal(t, "https://allowed.example", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	rec = serve(e, req)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	// No allowlist means no CORS headers at all
+	e, _ = newAuthTestServer(t, Config{})
+	req = httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.Header.Set("Origin", "https://allowed.example")
+	rec = serve(e, req)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestSessionStoreExpiry(t *testing.T) {
+	store := newSessionStore(20 * time.Millisecond)
+	id, err := store.Create(&User{Name: "alice"})
+	assert.NoError(t, err)
+
+	_, ok := store.Get(id)
+	assert.True(t, ok)
+
+	time.Sleep(40 * time.Millisecond)
+	_, ok = store.Get(id)
+	assert.False(t, ok)
+}
+
+// mockIdP is a minimal OpenID Connect provider for tests.
+type mockIdP struct {
+	server   *httptest.Server
+	clientID string
+	claims   map[string]interface{}
+	verifier string
+}
+
+func newMockIdP(clientID string, claims map[string]interface{}) *mockIdP {
+	idp := &mockIdP{clientID: clientID, claims: claims}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			UserinfoEndpoint:      idp.server.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good-code" || r.Form.Get("client_id") != idp.clientID {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		idp.verifier = r.Form.Get("code_verifier")
+
+		idClaims := map[string]interface{}{
+			"iss": idp.server.URL,
+			"aud": idp.clientID,
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"sub": "user-1",
+		}
+		for key, value := range idp.claims {
+			idClaims[key] = value
+		}
+		payload, _ := json.Marshal(idClaims)
+		idToken := "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+
+		json.NewEncoder(w).Encode(oidcTokenResponse{AccessToken: "idp-access-token", IDToken: idToken, ExpiresIn: 3600})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer idp-access-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"email": "alice@example.com"})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	idp := newMockIdP("exporter", map[string]interface{}{
+		"preferred_username": "alice",
+		"groups":             []string{"ops"},
+	})
+	defer idp.server.Close()
+
+	e, _ := newAuthTestServer(t, Config{
+		OIDCIssuerURL:   idp.server.URL,
+		OIDCClientID:    "exporter",
+		OIDCRedirectURL: "http://exporter.local/auth/callback",
+	})
+
+	rec := serve(e, httptest.NewRequest(http.MethodGet, "/api/ping", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "/auth/login")
+
+	rec = serve(e, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	assert.Equal(t, http.StatusFound, rec.Code)
+	stateCookie := findCookie(rec, oidcStateCookieName)
+	if assert.NotNil(t, stateCookie) {
+		assert.True(t, stateCookie.HttpOnly)
+		assert.Equal(t, http.SameSiteLaxMode, stateCookie.SameSite)
+	}
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, idp.server.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	assert.Equal(t, "exporter", location.Query().Get("client_id"))
+	assert.Equal(t, "S256", location.Query().Get("code_challenge_method"))
+	state := location.Query().Get("state")
+	assert.NotEmpty(t, state)
+	assert.Equal(t, state, stateCookie.Value)
+
+	callback := func(state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/auth/callback?state="+state+"&code=good-code", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		return serve(e, req)
+	}
+
+	// A forged state is rejected
+	rec = callback("forged", stateCookie)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// So is a callback URL opened in another browser, which does not use up
+	// the login
+	rec = callback(state, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, idp.verifier)
+
+	rec = callback(state, stateCookie)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.NotEmpty(t, idp.verifier)
+
+	session := findCookie(rec, sessionCookieName)
+	if !assert.NotNil(t, session) {
+		return
+	}
+	assert.True(t, session.HttpOnly)
+	assert.Equal(t, -1, findCookie(rec, oidcStateCookieName).MaxAge)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.AddCookie(session)
+	rec = serve(e, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var me struct {
+		User User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &me))
+	assert.Equal(t, "alice", me.User.Name)
+	assert.Equal(t, "alice@example.com", me.User.Email)
+	assert.Equal(t, []string{"ops"}, me.User.Groups)
+	assert.Equal(t, "oidc", me.User.Provider)
+
+	// The state can only be used once
+	rec = callback(state, stateCookie)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// Logging out takes a POST, which other sites cannot send with the cookie
+	req = httptest.NewRequest(http.MethodGet, "/auth/logout", nil)
+	req.AddCookie(session)
+	rec = serve(e, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.AddCookie(session)
+	rec = serve(e, req)
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.AddCookie(session)
+	rec = serve(e, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestOIDCRejectsWrongAudience(t *testing.T) {
+	idp := newMockIdP("exporter", map[string]interface{}{"aud": "someone-else"})
+	defer idp.server.Close()
+
+	provider := newOIDCProvider(Config{
+		OIDCIssuerURL:   idp.server.URL,
+		OIDCClientID:    "exporter",
+		OIDCRedirectURL: "http://exporter.local/auth/callback",
+	})
+
+	_, state, err := provider.AuthCodeURL()
+	assert.NoError(t, err)
+
+	_, _, err = provider.Exchange(state, "good-code")
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "audience"))
+}
+
+func TestOIDCDiscoveryFailure(t *testing.T) {
+	provider := newOIDCProvider(Config{
+		OIDCIssuerURL:   "http://localhost:1",
+		OIDCClientID:    "exporter",
+		OIDCRedirectURL: "http://exporter.local/auth/callback",
+	})
+
+	_, _, err := provider.AuthCodeURL()
+	assert.Error(t, err)
+}
+
+// newPassThroughGrafana fakes a Grafana where alice and bob see different
+// dashboards, and records the Authorization header of every search.
+func newPassThroughGrafana(searchAuth *[]string) *httptest.Server {
+	logins := map[string]string{
+		"Basic " + base64.StdEncoding.EncodeToString([]byte("alice:grafana-pass")): "alice",
+		"Bearer bob-grafana-token": "bob",
+		"Bearer idp-access-token":  "carol",
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		login, ok := logins[r.Header.Get("Authorization")]
+		if !ok {
+			http.Error(w, `{"message":"Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/user":
+			json.NewEncoder(w).Encode(map[string]string{"login": login, "email": login + "@example.com"})
+		case "/api/search":
+			*searchAuth = append(*searchAuth, r.Header.Get("Authorization"))
+			json.NewEncoder(w).Encode([]Dashboard{{UID: login + "-dash", Title: login + "'s dashboard", Type: "dash-db"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestGrafanaCredentialPassThrough(t *testing.T) {
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+
+	var searchAuth []string
+	grafana := newPassThroughGrafana(&searchAuth)
+	defer grafana.Close()
+
+	config = Config{GrafanaURL: grafana.URL, GrafanaAPIKey: "shared-key", GrafanaCredentials: grafanaCredentialsUser}
+	metaCache = newMetadataCache(time.Minute)
+
+	e, auth := newAuthTestServer(t, config)
+	assert.True(t, auth.Enabled())
+	e.GET("/api/dashboards", getDashboards)
+
+	listDashboards := func(req *http.Request) []Dashboard {
+		rec := serve(e, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var response DashboardResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		return response.Dashboards
+	}
+
+	// Browsers are asked for their Grafana login
+	rec := serve(e, httptest.NewRequest(http.MethodGet, "/api/dashboards?wait=true", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Basic")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/dashboards?wait=true", nil)
+	req.SetBasicAuth("alice", "grafana-pass")
+	dashboards := listDashboards(req)
+	assert.Len(t, dashboards, 1)
+	assert.Equal(t, "alice-dash", dashboards[0].UID)
+
+	// Bob's listing is not served from alice's cache entry
+	req = httptest.NewRequest(http.MethodGet, "/api/dashboards?wait=true", nil)
+	req.Header.Set("Authorization", "Bearer bob-grafana-token")
+	dashboards = listDashboards(req)
+	assert.Len(t, dashboards, 1)
+	assert.Equal(t, "bob-dash", dashboards[0].UID)
+
+	assert.Equal(t, []string{
+		"Basic " + base64.StdEncoding.EncodeToString([]byte("alice:grafana-pass")),
+		"Bearer bob-grafana-token",
+	}, searchAuth)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.SetBasicAuth("alice", "grafana-pass")
+	rec = serve(e, req)
+	assert.Contains(t, rec.Body.String(), `"provider":"grafana"`)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/dashboards?wait=true", nil)
+	req.SetBasicAuth("alice", "wrong")
+	rec = serve(e, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestOIDCPassThroughForwardsToken(t *testing.T) {
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+
+	var searchAuth []string
+	grafana := newPassThroughGrafana(&searchAuth)
+	defer grafana.Close()
+
+	idp := newMockIdP("exporter", map[string]interface{}{"preferred_username": "carol"})
+	defer idp.server.Close()
+
+	config = Config{
+		GrafanaURL:         grafana.URL,
+		GrafanaCredentials: grafanaCredentialsUser,
+		OIDCIssuerURL:      idp.server.URL,
+		OIDCClientID:       "exporter",
+		OIDCRedirectURL:    "http://exporter.local/auth/callback",
+	}
+	metaCache = newMetadataCache(time.Minute)
+
+	e, _ := newAuthTestServer(t, config)
+	e.GET("/api/dashboards", getDashboards)
+
+	rec := serve(e, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	stateCookie := findCookie(rec, oidcStateCookieName)
+	req := httptest.NewRequest(http.MethodGet, "/auth/callback?state="+stateCookie.Value+"&code=good-code", nil)
+	req.AddCookie(stateCookie)
+	rec = serve(e, req)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	session := findCookie(rec, sessionCookieName)
+	if !assert.NotNil(t, session) {
+		return
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/dashboards?wait=true", nil)
+	req.AddCookie(session)
+	rec = serve(e, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "carol-dash")
+	assert.Equal(t, []string{"Bearer idp-access-token"}, searchAuth)
+}
+
+func TestInvalidGrafanaCredentialsMode(t *testing.T) {
+	_, err := newAuthenticator(Config{GrafanaCredentials: "everyone"})
+	assert.Error(t, err)
+
+	_, err = newAuthenticator(Config{OIDCGrafanaToken: "refresh_token"})
+	assert.Error(t, err)
+}
@@ -39,7 +39,8 @@ cat > build/.env.example << EOF
 GRAFANA_URL=http://localhost:3000
 GRAFANA_API_KEY=your-api-key-here
 SKIP_TLS_VERIFY=false
-GRAFANA_VERSION=11.1
+# Leave empty to detect the Grafana version
+GRAFANA_VERSION=
 
 # Application settings
 EXPORT_DIRECTORY=./exported
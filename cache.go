@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Cache namespaces for the Grafana metadata kept between requests.
+const (
+	cacheFolders           = "folders"
+	cacheDashboardSearch   = "search"
+	cacheDashboardDetails  = "dashboards"
+	cacheDashboardVersions = "versions"
+
+	// What dashboards and library panels refer to, for the dependency graph
+	cacheDashboardReferences = "references"
+)
+
+const defaultCacheTTL = 5 * time.Minute
+
+type cacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// metadataCache is a concurrency-safe cache for Grafana metadata. Entries are
+// grouped by namespace so that one kind of object can be invalidated without
+// dropping the others, and expire after the configured TTL. A TTL of zero
+// disables caching.
+type metadataCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]map[string]cacheEntry
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+}
+
+type cacheStats struct {
+	TTL        string         `json:"ttl"`
+	Hits       uint64         `json:"hits"`
+	Misses     uint64         `json:"misses"`
+	Namespaces map[string]int `json:"namespaces"`
+}
+
+var metaCache = newMetadataCache(defaultCacheTTL)
+
+func newMetadataCache(ttl time.Duration) *metadataCache {
+	return &metadataCache{
+		ttl:     ttl,
+		entries: make(map[string]map[string]cacheEntry),
+	}
+}
+
+func (c *metadataCache) Get(namespace, key string) (interface{}, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[namespace][key]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.hits.Add(1)
+	return entry.value, true
+}
+
+func (c *metadataCache) Set(namespace, key string, value interface{}) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries[namespace] == nil {
+		c.entries[namespace] = make(map[string]cacheEntry)
+	}
+	c.entries[namespace][key] = cacheEntry{value: value, expiresAt: time.Now().Add(c.ttl)}
+}
+
+func (c *metadataCache) Delete(namespace, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries[namespace], key)
+}
+
+// Invalidate drops every entry of a namespace and returns how many were removed.
+func (c *metadataCache) Invalidate(namespace string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := len(c.entries[namespace])
+	delete(c.entries, namespace)
+	return removed
+}
+
+// Flush drops every entry and returns how many were removed.
+func (c *metadataCache) Flush() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for _, entries := range c.entries {
+		removed += len(entries)
+	}
+	c.entries = make(map[string]map[string]cacheEntry)
+	return removed
+}
+
+// Stats reports hit/miss counters and the number of live entries per namespace.
+// Expired entries are pruned as a side effect.
+func (c *metadataCache) Stats() cacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	namespaces := make(map[string]int)
+	for namespace, entries := range c.entries {
+		for key, entry := range entries {
+			if now.After(entry.expiresAt) {
+				delete(entries, key)
+			}
+		}
+		namespaces[namespace] = len(entries)
+	}
+
+	return cacheStats{
+		TTL:        c.ttl.String(),
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		Namespaces: namespaces,
+	}
+}
+
+// scopedCacheKey prefixes key with the identity and organization Grafana is
+// called with, so that users calling Grafana with their own credentials never
+// see entries fetched with somebody else's permissions, nor from another
+// organization.
+func scopedCacheKey(ctx context.Context, key string) string {
+	if scope := credentialScope(ctx); scope != "" {
+		return scope + "|" + key
+	}
+	return key
+}
+
+func cachedFolderTitle(ctx context.Context, uid string) (string, bool) {
+	value, ok := metaCache.Get(cacheFolders, scopedCacheKey(ctx, uid))
+	if !ok {
+		return "", false
+	}
+	title, ok := value.(string)
+	return title, ok
+}
+
+func cacheFolderTitle(ctx context.Context, uid, title string) {
+	metaCache.Set(cacheFolders, scopedCacheKey(ctx, uid), title)
+}
+
+// lookupFolderTitle resolves a folder UID to its title, using the cache when
+// possible and falling back to /api/folders/{uid}.
+func lookupFolderTitle(ctx context.Context, uid string) (string, error) {
+	if title, ok := cachedFolderTitle(ctx, uid); ok {
+		return title, nil
+	}
+
+	folderURL := fmt.Sprintf("%s/api/folders/%s", currentConfig().GrafanaURL, uid)
+	folder, err := fetchAPI[Folder](ctx, folderURL)
+	if err != nil {
+		return "", err
+	}
+
+	cacheFolderTitle(ctx, uid, folder.Title)
+	return folder.Title, nil
+}
+
+func getCacheStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, metaCache.Stats())
+}
+
+func flushCache(c echo.Context) error {
+	namespace := c.QueryParam("namespace")
+
+	var removed int
+	switch namespace {
+	case "":
+		removed = metaCache.Flush()
+	case cacheFolders, cacheDashboardSearch, cacheDashboardDetails, cacheDashboardVersions, cacheDashboardReferences:
+		removed = metaCache.Invalidate(namespace)
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown cache namespace: " + namespace})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"namespace": namespace,
+		"removed":   removed,
+	})
+}
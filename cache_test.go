@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadataCacheGetSet(t *testing.T) {
+	cache := newMetadataCache(time.Minute)
+
+	_, ok := cache.Get(cacheFolders, "missing")
+	assert.False(t, ok)
+
+	cache.Set(cacheFolders, "f1", "Folder 1")
+	value, ok := cache.Get(cacheFolders, "f1")
+	assert.True(t, ok)
+	assert.Equal(t, "Folder 1", value)
+
+	// Same key in another namespace is independent
+	_, ok = cache.Get(cacheDashboardDetails, "f1")
+	assert.False(t, ok)
+
+	stats := cache.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, 1, stats.Namespaces[cacheFolders])
+}
+
+func TestMetadataCacheExpiry(t *testing.T) {
+	cache := newMetadataCache(20 * time.Millisecond)
+	cache.Set(cacheFolders, "f1", "Folder 1")
+
+	time.Sleep(40 * time.Millisecond)
+
+	_, ok := cache.Get(cacheFolders, "f1")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Stats().Namespaces[cacheFolders])
+}
+
+func TestMetadataCacheDisabled(t *testing.T) {
+	cache := newMetadataCache(0)
+	cache.Set(cacheFolders, "f1", "Folder 1")
+
+	_, ok := cache.Get(cacheFolders, "f1")
+	assert.False(t, ok)
+}
+
+func TestMetadataCacheInvalidation(t *testing.T) {
+	cache := newMetadataCache(time.Minute)
+	cache.Set(cacheFolders, "f1", "Folder 1")
+	cache.Set(cacheFolders, "f2", "Folder 2")
+	cache.Set(cacheDashboardDetails, "d1", Dashboard{UID: "d1"})
+
+	cache.Delete(cacheFolders, "f1")
+	_, ok := cache.Get(cacheFolders, "f1")
+	assert.False(t, ok)
+
+	assert.Equal(t, 1, cache.Invalidate(cacheFolders))
+	_, ok = cache.Get(cacheDashboardDetails, "d1")
+	assert.True(t, ok)
+
+	assert.Equal(t, 1, cache.Flush())
+	_, ok = cache.Get(cacheDashboardDetails, "d1")
+	assert.False(t, ok)
+}
+
+func TestMetadataCacheConcurrentAccess(t *testing.T) {
+	cache := newMetadataCache(time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("f%d", i%5)
+			cache.Set(cacheFolders, key, key)
+			cache.Get(cacheFolders, key)
+			cache.Stats()
+			if i%7 == 0 {
+				cache.Invalidate(cacheFolders)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLookupFolderTitle(t *testing.T) {
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+
+	var calls atomic.Int32
+	ts := newFakeGrafana(map[string]any{
+		"/api/folders/folder-1": countRequests(&calls, `{"id":1,"uid":"folder-1","title":"Looked Up"}`),
+	})
+	defer ts.Close()
+
+	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
+	metaCache = newMetadataCache(time.Minute)
+
+	title, err := lookupFolderTitle(context.Background(), "folder-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Looked Up", title)
+
+	title, err = lookupFolderTitle(context.Background(), "folder-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Looked Up", title)
+	assert.Equal(t, int32(1), calls.Load())
+
+	_, err = lookupFolderTitle(context.Background(), "missing")
+	assert.Error(t, err)
+}
+
+func TestFetchAllDashboardsCached(t *testing.T) {
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+
+	var calls atomic.Int32
+	ts := newFakeGrafana(map[string]any{
+		"/api/search": countRequests(&calls, `[{"uid":"d1","title":"Dash 1"}]`),
+	})
+	defer ts.Close()
+
+	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
+	metaCache = newMetadataCache(time.Minute)
+
+	first, err := fetchAllDashboards(context.Background())
+	assert.NoError(t, err)
+	first[0].Title = "mutated by caller"
+
+	second, err := fetchAllDashboards(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Dash 1", second[0].Title)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestGetDashboardsRefreshBypassesCache(t *testing.T) {
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+
+	var searchCalls atomic.Int32
+	ts := newFakeGrafana(map[string]any{
+		"/api/search": countRequests(&searchCalls, `[{"uid":"d1","title":"Dash 1","type":"dash-db"}]`),
+	})
+	defer ts.Close()
+
+	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
+	metaCache = newMetadataCache(time.Minute)
+
+	e := echo.New()
+	for _, target := range []string{"/api/dashboards?wait=true", "/api/dashboards?wait=true", "/api/dashboards?wait=true&refresh=true"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, getDashboards(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	assert.Equal(t, int32(2), searchCalls.Load())
+}
+
+func TestRefreshNeedsAdmin(t *testing.T) {
+	grafana := newFakeGrafana(map[string]any{
+		"/api/folders": `[]`,
+		"/api/search":  `[]`,
+	})
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	e, _ := newAuthTestServer(t, Config{
+		AuthBasicUsers: "viewer:pass,admin:pass",
+		AuthUserRoles:  "admin:admin",
+	})
+	e.GET("/api/folders", getFolders)
+	e.GET("/api/dashboards", getDashboards)
+	config = Config{GrafanaURL: grafana.URL}
+	metaCache = newMetadataCache(time.Minute)
+
+	for _, target := range []string{"/api/folders?refresh=true", "/api/dashboards?refresh=true"} {
+		request := func(user string) int {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.SetBasicAuth(user, "pass")
+			return serve(e, req).Code
+		}
+
+		// Another user's cached search results survive a viewer's refresh
+		metaCache.Set(cacheDashboardSearch, "other-user|all", []Dashboard{})
+		assert.Equal(t, http.StatusOK, request("viewer"), target)
+		_, ok := metaCache.Get(cacheDashboardSearch, "other-user|all")
+		assert.True(t, ok, target)
+
+		assert.Equal(t, http.StatusOK, request("admin"), target)
+		_, ok = metaCache.Get(cacheDashboardSearch, "other-user|all")
+		assert.False(t, ok, target)
+	}
+}
+
+func TestCacheEndpoints(t *testing.T) {
+	originalCache := metaCache
+	defer func() { metaCache = originalCache }()
+
+	metaCache = newMetadataCache(time.Minute)
+	cacheFolderTitle(context.Background(), "f1", "Folder 1")
+	metaCache.Set(cacheDashboardDetails, "d1", Dashboard{UID: "d1"})
+
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/cache", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, getCacheStatus(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var stats cacheStats
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	assert.Equal(t, "1m0s", stats.TTL)
+	assert.Equal(t, 1, stats.Namespaces[cacheFolders])
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/cache?namespace=folders", nil)
+	rec = httptest.NewRecorder()
+	assert.NoError(t, flushCache(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	_, ok := cachedFolderTitle(context.Background(), "f1")
+	assert.False(t, ok)
+	_, ok = metaCache.Get(cacheDashboardDetails, "d1")
+	assert.True(t, ok)
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/cache?namespace=bogus", nil)
+	rec = httptest.NewRecorder()
+	assert.NoError(t, flushCache(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/cache", nil)
+	rec = httptest.NewRecorder()
+	assert.NoError(t, flushCache(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	_, ok = metaCache.Get(cacheDashboardDetails, "d1")
+	assert.False(t, ok)
+}
@@ -0,0 +1,576 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const configWatchInterval = 5 * time.Second
+
+// envFilePath is the dotenv file read next to the config file. It is a
+// variable so that tests can point it elsewhere.
+var envFilePath = ".env"
+
+// configSetting describes one configuration value. It is read from the
+// environment variable name, or from the config file under the same name in
+// lower case (grafana_url for GRAFANA_URL).
+type configSetting struct {
+	name     string
+	fallback string
+	field    func(cfg *Config) any // Pointer to the string, bool or duration the setting fills
+	validate func(value string) error
+	secret   bool // May be read from the file named by <name>_FILE
+	restart  bool // Changes take effect only after a restart
+	security bool // Protects the exporter; an invalid value stops the server instead of falling back
+}
+
+var configSettings = []configSetting{
+	{name: "GRAFANA_URL", fallback: "http://localhost:3000", field: func(c *Config) any { return &c.GrafanaURL }, validate: validateHTTPURL},
+	{name: "GRAFANA_API_KEY", field: func(c *Config) any { return &c.GrafanaAPIKey }, secret: true},
+	{name: "GRAFANA_AUTH", fallback: grafanaAuthBearer, field: func(c *Config) any { return &c.GrafanaAuth }, validate: validateChoice(grafanaAuthBearer, grafanaAuthBasic, grafanaAuthProxy)},
+	{name: "GRAFANA_USERNAME", field: func(c *Config) any { return &c.GrafanaUsername }},
+	{name: "GRAFANA_PASSWORD", field: func(c *Config) any { return &c.GrafanaPassword }, secret: true},
+	{name: "GRAFANA_AUTH_PROXY_USER", field: func(c *Config) any { return &c.GrafanaAuthProxyUser }},
+	{name: "GRAFANA_AUTH_PROXY_HEADER", fallback: "X-WEBAUTH-USER", field: func(c *Config) any { return &c.GrafanaAuthProxyHeader }, validate: validateNotEmpty},
+	{name: "GRAFANA_ORG_API_KEYS", field: func(c *Config) any { return &c.GrafanaOrgAPIKeys }, validate: validateOrgKeyList, secret: true},
+	{name: "GRAFANA_HEADERS", field: func(c *Config) any { return &c.GrafanaHeaders }, validate: validateHeaderList, secret: true},
+	{name: "GRAFANA_COOKIES", field: func(c *Config) any { return &c.GrafanaCookies }, validate: validateCookieList, secret: true},
+	{name: "GRAFANA_VERSION", field: func(c *Config) any { return &c.GrafanaVersion }, validate: validateGrafanaVersion},
+	{name: "SKIP_TLS_VERIFY", fallback: "false", field: func(c *Config) any { return &c.SkipTLSVerify }},
+	{name: "GRAFANA_CA_CERT", field: func(c *Config) any { return &c.GrafanaCACert }},
+	{name: "GRAFANA_CLIENT_CERT", field: func(c *Config) any { return &c.GrafanaClientCert }},
+	{name: "GRAFANA_CLIENT_KEY", field: func(c *Config) any { return &c.GrafanaClientKey }},
+	{name: "GRAFANA_TLS_SERVER_NAME", field: func(c *Config) any { return &c.GrafanaTLSServerName }},
+	{name: "GRAFANA_TLS_MIN_VERSION", fallback: "1.2", field: func(c *Config) any { return &c.GrafanaTLSMinVersion }, validate: validateChoice("1.0", "1.1", "1.2", "1.3")},
+	{name: "EXPORT_DIRECTORY", fallback: "./exported", field: func(c *Config) any { return &c.ExportDirectory }, validate: validateNotEmpty},
+	{name: "FORCE_ENABLE_ZIP_EXPORT", fallback: "false", field: func(c *Config) any { return &c.ForceEnableZipExport }},
+	{name: "SERVER_HOST", fallback: "127.0.0.1", field: func(c *Config) any { return &c.ServerHost }, restart: true},
+	{name: "SERVER_PORT", fallback: "8080", field: func(c *Config) any { return &c.ServerPort }, validate: validatePort, restart: true},
+	{name: "CACHE_TTL", fallback: defaultCacheTTL.String(), field: func(c *Config) any { return &c.CacheTTL }, restart: true},
+	{name: "AUDIT_LOG_FILE", fallback: "./audit.log", field: func(c *Config) any { return &c.AuditLogFile }, restart: true},
+	{name: "HEALTH_CHECK_INTERVAL", fallback: defaultHealthCheckInterval.String(), field: func(c *Config) any { return &c.HealthCheckInterval }, validate: validatePositiveDuration, restart: true},
+	{name: "AUTH_BASIC_USERS", field: func(c *Config) any { return &c.AuthBasicUsers }, validate: validateCredentialList("AUTH_BASIC_USERS"), secret: true, restart: true, security: true},
+	{name: "AUTH_BEARER_TOKENS", field: func(c *Config) any { return &c.AuthBearerTokens }, validate: validateCredentialList("AUTH_BEARER_TOKENS"), secret: true, restart: true, security: true},
+	{name: "OIDC_ISSUER_URL", field: func(c *Config) any { return &c.OIDCIssuerURL }, validate: validateOptionalHTTPURL, restart: true, security: true},
+	{name: "OIDC_CLIENT_ID", field: func(c *Config) any { return &c.OIDCClientID }, restart: true, security: true},
+	{name: "OIDC_CLIENT_SECRET", field: func(c *Config) any { return &c.OIDCClientSecret }, secret: true, restart: true, security: true},
+	{name: "OIDC_REDIRECT_URL", field: func(c *Config) any { return &c.OIDCRedirectURL }, validate: validateOptionalHTTPURL, restart: true, security: true},
+	{name: "OIDC_SCOPES", fallback: "openid profile email", field: func(c *Config) any { return &c.OIDCScopes }, restart: true},
+	{name: "OIDC_GRAFANA_TOKEN", fallback: "access_token", field: func(c *Config) any { return &c.OIDCGrafanaToken }, validate: validateChoice("access_token", "id_token"), restart: true, security: true},
+	{name: "SESSION_TTL", fallback: defaultSessionTTL.String(), field: func(c *Config) any { return &c.SessionTTL }, validate: validatePositiveDuration, restart: true},
+	{name: "AUTH_USER_ROLES", field: func(c *Config) any { return &c.AuthUserRoles }, validate: validateRoleList("AUTH_USER_ROLES"), restart: true, security: true},
+	{name: "AUTH_GROUP_ROLES", field: func(c *Config) any { return &c.AuthGroupRoles }, validate: validateRoleList("AUTH_GROUP_ROLES"), restart: true, security: true},
+	{name: "AUTH_DEFAULT_ROLE", fallback: roleViewer, field: func(c *Config) any { return &c.AuthDefaultRole }, validate: validateChoice(roleNone, roleViewer, roleExporter, roleAdmin), restart: true, security: true},
+	{name: "CORS_ALLOWED_ORIGINS", field: func(c *Config) any { return &c.CORSAllowedOrigins }, validate: validateOriginList, restart: true, security: true},
+	{name: "TRUSTED_PROXIES", field: func(c *Config) any { return &c.TrustedProxies }, validate: validateProxyList, restart: true, security: true},
+	{name: "GRAFANA_CREDENTIALS", fallback: grafanaCredentialsShared, field: func(c *Config) any { return &c.GrafanaCredentials }, validate: validateChoice(grafanaCredentialsShared, grafanaCredentialsUser), restart: true, security: true},
+}
+
+func (s configSetting) set(cfg *Config, value string) error {
+	if s.validate != nil {
+		if err := s.validate(value); err != nil {
+			return err
+		}
+	}
+
+	switch field := s.field(cfg).(type) {
+	case *string:
+		*field = value
+	case *bool:
+		parsed, ok := parseConfigBool(value)
+		if !ok {
+			return fmt.Errorf("%q is not a boolean, expected true or false", value)
+		}
+		*field = parsed
+	case *time.Duration:
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("%q is not a duration such as 30s or 5m", value)
+		}
+		*field = parsed
+	}
+	return nil
+}
+
+func (s configSetting) get(cfg *Config) string {
+	switch field := s.field(cfg).(type) {
+	case *string:
+		return *field
+	case *bool:
+		return strconv.FormatBool(*field)
+	case *time.Duration:
+		return field.String()
+	}
+	return ""
+}
+
+func parseConfigBool(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "true", "1", "yes":
+		return true, true
+	case "false", "0", "no":
+		return false, true
+	}
+	return false, false
+}
+
+func validateNotEmpty(value string) error {
+	if value == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	return nil
+}
+
+func validateHTTPURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", value)
+	}
+	return nil
+}
+
+func validateOptionalHTTPURL(value string) error {
+	if value == "" {
+		return nil
+	}
+	return validateHTTPURL(value)
+}
+
+func validatePort(value string) error {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("%q is not a port number", value)
+	}
+	return nil
+}
+
+func validatePositiveDuration(value string) error {
+	if parsed, err := time.ParseDuration(value); err == nil && parsed <= 0 {
+		return fmt.Errorf("must be longer than 0")
+	}
+	return nil
+}
+
+func validateGrafanaVersion(value string) error {
+	if _, ok := parseGrafanaVersion(value); value != "" && !ok {
+		return fmt.Errorf("%q is not a version such as 10.4", value)
+	}
+	return nil
+}
+
+func validateChoice(choices ...string) func(string) error {
+	return func(value string) error {
+		if !slices.Contains(choices, value) {
+			return fmt.Errorf("%q is not one of %s", value, strings.Join(choices, ", "))
+		}
+		return nil
+	}
+}
+
+func validateCredentialList(setting string) func(string) error {
+	return func(value string) error {
+		_, err := parseCredentialList(value, setting)
+		return err
+	}
+}
+
+// validateOriginList checks a comma separated list of origins such as
+// https://grafana.example.com, or *.
+func validateOriginList(value string) error {
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "" || origin == "*" {
+			continue
+		}
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || strings.TrimSuffix(parsed.Path, "/") != "" {
+			return fmt.Errorf("%q is not an origin such as https://grafana.example.com", origin)
+		}
+	}
+	return nil
+}
+
+func validateProxyList(value string) error {
+	_, err := parseProxyList(value)
+	return err
+}
+
+func validateRoleList(setting string) func(string) error {
+	return func(value string) error {
+		_, err := parseRoleList(value, setting)
+		return err
+	}
+}
+
+// configSource is one layer of settings keyed by setting name.
+type configSource struct {
+	name   string
+	values map[string]string
+}
+
+// lookup returns the value of a setting in this source, reading secrets
+// from the file named by <name>_FILE.
+func (s configSource) lookup(setting configSetting) (string, bool, error) {
+	value, hasValue := s.values[setting.name]
+	if !setting.secret {
+		return value, hasValue, nil
+	}
+
+	path, hasFile := s.values[setting.name+"_FILE"]
+	if !hasFile {
+		return value, hasValue, nil
+	}
+	if hasValue {
+		return "", false, fmt.Errorf("set either %s or %s_FILE, not both", setting.name, setting.name)
+	}
+
+	secret, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("could not read %s_FILE: %v", setting.name, err)
+	}
+	return strings.TrimRight(string(secret), "\r\n"), true, nil
+}
+
+// loadedConfig is the result of reading every configuration source.
+type loadedConfig struct {
+	Config       Config
+	File         string            // Config file in use, empty if none
+	SettingsFile string            // File the settings page saves to
+	HasEnvFile   bool              // Whether .env was found
+	Configured   bool              // Whether any source sets GRAFANA_URL
+	Sources      map[string]string // Setting name -> source its value came from
+	Problems     []string          // Every invalid value; those settings keep their default
+	Unsafe       []string          // The problems of security settings, whose default would be unsafe
+}
+
+// loadConfig reads the settings from, in increasing precedence, their
+// defaults, the config file named by CONFIG_FILE, the settings saved from the
+// web UI, the .env file and the process environment. It reports all problems
+// instead of stopping at the first one.
+func loadConfig() loadedConfig {
+	loaded := loadedConfig{Sources: make(map[string]string)}
+
+	environment := environmentSource()
+	dotenv, err := dotenvSource()
+	if err == nil {
+		loaded.HasEnvFile = true
+	} else if !os.IsNotExist(err) {
+		loaded.Problems = append(loaded.Problems, fmt.Sprintf("%s: %v", envFilePath, err))
+	}
+
+	// Where the configuration itself lives can only come from these two
+	bootstrap := func(name string) string {
+		if value := environment.values[name]; value != "" {
+			return value
+		}
+		return dotenv.values[name]
+	}
+
+	loaded.SettingsFile = bootstrap("SETTINGS_FILE")
+	if loaded.SettingsFile == "" {
+		loaded.SettingsFile = defaultSettingsFile
+	}
+	key := settingsKeySource{environment: environment, dotenv: dotenv, keyFile: loaded.SettingsFile + ".key"}
+	settings, problems := readSettingsFile(loaded.SettingsFile, key)
+	loaded.Problems = append(loaded.Problems, problems...)
+
+	sources := []configSource{{name: loaded.SettingsFile, values: settings}, dotenv, environment}
+
+	loaded.File = bootstrap("CONFIG_FILE")
+	if loaded.File != "" {
+		values, problems := readConfigFile(loaded.File)
+		loaded.Problems = append(loaded.Problems, problems...)
+		sources = append([]configSource{{name: loaded.File, values: values}}, sources...)
+	}
+
+	for _, setting := range configSettings {
+		setting.set(&loaded.Config, setting.fallback)
+
+		for _, source := range sources {
+			value, ok, err := source.lookup(setting)
+			if err == nil && ok {
+				if err = setting.set(&loaded.Config, value); err == nil {
+					loaded.Sources[setting.name] = source.name
+				}
+			}
+			if err != nil {
+				problem := fmt.Sprintf("%s (%s): %v", setting.name, source.name, err)
+				loaded.Problems = append(loaded.Problems, problem)
+				if setting.security {
+					loaded.Unsafe = append(loaded.Unsafe, problem)
+				}
+			}
+		}
+	}
+
+	for _, source := range sources {
+		if _, ok := source.values["GRAFANA_URL"]; ok {
+			loaded.Configured = true
+		}
+	}
+
+	// The certificate files are only checked once all layers are applied,
+	// since the certificate and its key may come from different ones
+	if _, err := grafanaTLSConfig(loaded.Config); err != nil {
+		loaded.Problems = append(loaded.Problems, fmt.Sprintf("Grafana TLS: %v", err))
+	}
+	// Without an API key the exporter still starts and asks for one, but
+	// the other modes cannot work with half their settings
+	if missing := grafanaAuthMissing(loaded.Config); missing != "" && loaded.Config.GrafanaAuth != grafanaAuthBearer {
+		loaded.Problems = append(loaded.Problems, fmt.Sprintf("GRAFANA_AUTH=%s: %s", loaded.Config.GrafanaAuth, missing))
+	}
+
+	return loaded
+}
+
+func environmentSource() configSource {
+	environment := configSource{name: "environment", values: make(map[string]string)}
+	for _, entry := range os.Environ() {
+		if name, value, ok := strings.Cut(entry, "="); ok {
+			environment.values[name] = value
+		}
+	}
+	return environment
+}
+
+// dotenvSource reads .env; it is empty when the file cannot be read.
+func dotenvSource() (configSource, error) {
+	values, err := godotenv.Read(envFilePath)
+	if err != nil {
+		values = map[string]string{}
+	}
+	return configSource{name: envFilePath, values: values}, err
+}
+
+// readConfigFile reads a flat YAML mapping of setting names to values.
+func readConfigFile(path string) (map[string]string, []string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("Could not read config file: %v", err)}
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, []string{fmt.Sprintf("%s: %v", path, err)}
+	}
+
+	known := make(map[string]bool)
+	for _, setting := range configSettings {
+		known[setting.name] = true
+		if setting.secret {
+			known[setting.name+"_FILE"] = true
+		}
+	}
+
+	values := make(map[string]string)
+	var problems []string
+	for key, value := range raw {
+		name := strings.ToUpper(key)
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			problems = append(problems, fmt.Sprintf("%s (%s): must be a single value", name, path))
+			continue
+		case nil:
+			value = ""
+		}
+		if !known[name] {
+			problems = append(problems, fmt.Sprintf("%s: unknown setting %q", path, key))
+			continue
+		}
+		values[name] = fmt.Sprint(value)
+	}
+	slices.Sort(problems)
+
+	return values, problems
+}
+
+// configState is what /api/config-status reports about the configuration.
+type configState struct {
+	File            string            `json:"configFile,omitempty"`
+	SettingsFile    string            `json:"settingsFile"`
+	Configured      bool              `json:"configured"`
+	Sources         map[string]string `json:"sources"` // Setting name -> where its value comes from
+	LoadedAt        time.Time         `json:"loadedAt"`
+	Problems        []string          `json:"problems"`
+	RestartRequired []string          `json:"restartRequired"` // Changed settings that need a restart
+}
+
+var (
+	configMu      sync.RWMutex
+	startupConfig Config // The config the server started with
+	configStatus  configState
+)
+
+// currentConfig returns the configuration in effect. Reloads replace it
+// while requests are served, so read it once per use.
+func currentConfig() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	return config
+}
+
+func currentConfigStatus() configState {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	return configStatus
+}
+
+// startConfig installs the configuration read at startup. Invalid settings
+// keep their default so that the UI can come up and show the problems,
+// except security settings: falling back could disable authentication or
+// widen access, so the configuration is refused instead.
+func startConfig(loaded loadedConfig) error {
+	for _, problem := range loaded.Problems {
+		log.Printf("Configuration problem: %s", problem)
+	}
+	if len(loaded.Unsafe) > 0 {
+		return fmt.Errorf("invalid security settings: %s", strings.Join(loaded.Unsafe, "; "))
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	config = loaded.Config
+	startupConfig = loaded.Config
+	configStatus = configState{
+		File:            loaded.File,
+		SettingsFile:    loaded.SettingsFile,
+		Configured:      loaded.Configured,
+		Sources:         loaded.Sources,
+		LoadedAt:        time.Now().UTC(),
+		Problems:        append([]string{}, loaded.Problems...),
+		RestartRequired: []string{},
+	}
+	return nil
+}
+
+// reloadConfig reads the configuration again and applies it when it is
+// valid. Settings marked restart keep their startup value and are reported
+// until the server is restarted. An invalid configuration is not applied at
+// all; the running one stays in effect and the problems are returned.
+func reloadConfig(ctx context.Context) []string {
+	loaded := loadConfig()
+
+	if len(loaded.Problems) == 0 && loaded.Config.ExportDirectory != currentConfig().ExportDirectory {
+		if err := os.MkdirAll(loaded.Config.ExportDirectory, os.ModePerm); err != nil {
+			loaded.Problems = append(loaded.Problems, fmt.Sprintf("EXPORT_DIRECTORY: %v", err))
+		}
+	}
+
+	if len(loaded.Problems) > 0 {
+		for _, problem := range loaded.Problems {
+			log.Printf("Configuration problem: %s", problem)
+		}
+		log.Printf("Warning: configuration not reloaded, keeping the running configuration")
+
+		configMu.Lock()
+		configStatus.File = loaded.File
+		configStatus.Problems = loaded.Problems
+		configMu.Unlock()
+		return loaded.Problems
+	}
+
+	configMu.Lock()
+	next := loaded.Config
+	restartRequired := []string{}
+	for _, setting := range configSettings {
+		if setting.restart && setting.get(&next) != setting.get(&startupConfig) {
+			restartRequired = append(restartRequired, setting.name)
+			setting.set(&next, setting.get(&startupConfig))
+		}
+	}
+	previous := config
+	config = next
+	configStatus = configState{
+		File:            loaded.File,
+		SettingsFile:    loaded.SettingsFile,
+		Configured:      loaded.Configured,
+		Sources:         loaded.Sources,
+		LoadedAt:        time.Now().UTC(),
+		Problems:        []string{},
+		RestartRequired: restartRequired,
+	}
+	configMu.Unlock()
+
+	log.Printf("Configuration reloaded")
+	for _, name := range restartRequired {
+		log.Printf("Warning: %s changed, restart the server to apply it", name)
+	}
+
+	if next.GrafanaURL != previous.GrafanaURL || grafanaIdentityChanged(previous, next) {
+		// Cached folders and dashboards may belong to another Grafana or key
+		log.Printf("Grafana connection changed, flushed %d cache entries", metaCache.Flush())
+	}
+	if next.GrafanaVersion != previous.GrafanaVersion || next.GrafanaURL != previous.GrafanaURL {
+		pinGrafanaVersion(next.GrafanaVersion)
+		if next.GrafanaVersion == "" {
+			detectGrafanaVersion(ctx)
+		}
+	}
+	// Certificate files may have been rotated in place
+	resetGrafanaClient()
+	health.Check(ctx)
+	return nil
+}
+
+// watchConfig reloads the configuration on SIGHUP and whenever the config
+// file or .env changes, until ctx ends.
+func watchConfig(ctx context.Context, interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	stamp := configFilesStamp()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			log.Printf("Received SIGHUP, reloading configuration")
+		case <-ticker.C:
+			if configFilesStamp() == stamp {
+				continue
+			}
+			log.Printf("Configuration files changed, reloading configuration")
+		}
+
+		reloadConfig(ctx)
+		stamp = configFilesStamp()
+	}
+}
+
+// configFilesStamp summarizes the modification time and size of the files
+// the configuration is read from.
+func configFilesStamp() string {
+	var stamp strings.Builder
+	status := currentConfigStatus()
+	for _, path := range []string{status.File, status.SettingsFile, envFilePath} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&stamp, "%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+		} else {
+			fmt.Fprintf(&stamp, "%s:missing;", path)
+		}
+	}
+	return stamp.String()
+}
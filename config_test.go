@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useConfigFiles points the config loader at a config file and .env in a
+// temporary directory.
+func useConfigFiles(t *testing.T, configFile, dotenv string) {
+	dir := t.TempDir()
+
+	originalEnvFile := envFilePath
+	t.Cleanup(func() { envFilePath = originalEnvFile })
+	envFilePath = filepath.Join(dir, ".env")
+	if dotenv != "" {
+		assert.NoError(t, os.WriteFile(envFilePath, []byte(dotenv), 0o600))
+	}
+
+	path := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(configFile), 0o600))
+	t.Setenv("CONFIG_FILE", path)
+}
+
+func TestParseConfigBool(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   bool
+		wantOK bool
+	}{
+		{"true", true, true},
+		{"yes", true, true},
+		{"1", true, true},
+		{"false", false, true},
+		{"no", false, true},
+		{"0", false, true},
+		{"invalid", false, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseConfigBool(tt.value)
+		assert.Equal(t, tt.want, got, tt.value)
+		assert.Equal(t, tt.wantOK, ok, tt.value)
+	}
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "api-key")
+	assert.NoError(t, os.WriteFile(keyFile, []byte("secret-key\n"), 0o600))
+
+	useConfigFiles(t, `
+grafana_url: http://from-file:3000
+cache_ttl: 2m
+skip_tls_verify: true
+server_port: 9000
+grafana_api_key_file: `+keyFile+`
+`, "GRAFANA_URL=http://from-dotenv:3000\n")
+	t.Setenv("SERVER_PORT", "9100")
+
+	loaded := loadConfig()
+	assert.Empty(t, loaded.Problems)
+	assert.True(t, loaded.HasEnvFile)
+	assert.True(t, loaded.Configured)
+
+	// .env overrides the file, the environment overrides both
+	assert.Equal(t, "http://from-dotenv:3000", loaded.Config.GrafanaURL)
+	assert.Equal(t, "9100", loaded.Config.ServerPort)
+	assert.Equal(t, 2*time.Minute, loaded.Config.CacheTTL)
+	assert.True(t, loaded.Config.SkipTLSVerify)
+	assert.Equal(t, "secret-key", loaded.Config.GrafanaAPIKey)
+
+	// Settings nobody sets keep their defaults
+	assert.Equal(t, "./exported", loaded.Config.ExportDirectory)
+	assert.Equal(t, roleViewer, loaded.Config.AuthDefaultRole)
+	assert.Equal(t, defaultHealthCheckInterval, loaded.Config.HealthCheckInterval)
+}
+
+func TestLoadConfigReportsAllProblems(t *testing.T) {
+	useConfigFiles(t, `
+grafana_url: not-a-url
+grafana_token: abc
+auth_default_role: superuser
+`, "")
+	t.Setenv("CACHE_TTL", "five minutes")
+	t.Setenv("SERVER_PORT", "http")
+	t.Setenv("SKIP_TLS_VERIFY", "maybe")
+	t.Setenv("AUTH_BASIC_USERS", "alice")
+	t.Setenv("GRAFANA_API_KEY", "key")
+	t.Setenv("GRAFANA_API_KEY_FILE", "/nonexistent")
+
+	loaded := loadConfig()
+	assert.Len(t, loaded.Problems, 8)
+	problems := strings.Join(loaded.Problems, "\n")
+	for _, expected := range []string{
+		"GRAFANA_URL", `unknown setting "grafana_token"`, "AUTH_DEFAULT_ROLE", "CACHE_TTL",
+		"SERVER_PORT", "SKIP_TLS_VERIFY", "AUTH_BASIC_USERS", "GRAFANA_API_KEY_FILE",
+	} {
+		assert.Contains(t, problems, expected)
+	}
+
+	// Invalid values keep their defaults, except where that would be unsafe
+	assert.Len(t, loaded.Unsafe, 2)
+	assert.Equal(t, "http://localhost:3000", loaded.Config.GrafanaURL)
+	assert.Equal(t, defaultCacheTTL, loaded.Config.CacheTTL)
+	assert.Equal(t, "8080", loaded.Config.ServerPort)
+	assert.False(t, loaded.HasEnvFile)
+}
+
+func TestReloadConfig(t *testing.T) {
+	originalConfig := config
+	originalStartup := startupConfig
+	originalStatus := configStatus
+	originalHealth := health
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		startupConfig = originalStartup
+		configStatus = originalStatus
+		health = originalHealth
+		metaCache = originalCache
+		pinGrafanaVersion("")
+	}()
+
+	useConfigFiles(t, "grafana_url: http://127.0.0.1:1\nserver_port: 8080\n", "")
+	health = newHealthChecker(time.Minute)
+	metaCache = newMetadataCache(time.Minute)
+
+	assert.NoError(t, startConfig(loadConfig()))
+	metaCache.Set(cacheFolders, "f1", "Folder 1")
+
+	exportDir := filepath.Join(t.TempDir(), "exports")
+	assert.NoError(t, os.WriteFile(os.Getenv("CONFIG_FILE"), []byte(
+		"grafana_url: http://127.0.0.2:1\nserver_port: 9000\nexport_directory: "+exportDir+"\n",
+	), 0o600))
+	reloadConfig(context.Background())
+
+	cfg := currentConfig()
+	assert.Equal(t, "http://127.0.0.2:1", cfg.GrafanaURL)
+	assert.Equal(t, exportDir, cfg.ExportDirectory)
+	assert.DirExists(t, exportDir)
+	// The port needs a restart and keeps its startup value
+	assert.Equal(t, "8080", cfg.ServerPort)
+	assert.Equal(t, []string{"SERVER_PORT"}, currentConfigStatus().RestartRequired)
+	// A new Grafana URL invalidates everything cached about the old one
+	assert.Equal(t, 0, metaCache.Stats().Namespaces[cacheFolders])
+
+	// An invalid file is reported and leaves the running config alone
+	assert.NoError(t, os.WriteFile(os.Getenv("CONFIG_FILE"), []byte("grafana_url: nope\n"), 0o600))
+	reloadConfig(context.Background())
+	assert.Equal(t, "http://127.0.0.2:1", currentConfig().GrafanaURL)
+	assert.Len(t, currentConfigStatus().Problems, 1)
+}
+
+func TestInvalidSecuritySettingsRefuseToStart(t *testing.T) {
+	originalConfig := config
+	originalStartup := startupConfig
+	originalStatus := configStatus
+	defer func() {
+		config = originalConfig
+		startupConfig = originalStartup
+		configStatus = originalStatus
+	}()
+
+	useConfigFiles(t, "grafana_url: http://127.0.0.1:1\n", "")
+	config = Config{}
+
+	// Falling back to the defaults would disable authentication, drop every
+	// role mapping or call Grafana with the shared key
+	for name, value := range map[string]string{
+		"AUTH_BASIC_USERS":     "alice",
+		"AUTH_USER_ROLES":      "alice:admin,bob",
+		"GRAFANA_CREDENTIALS":  "per-user",
+		"CORS_ALLOWED_ORIGINS": "https://grafana.example.com/dashboards",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			err := startConfig(loadConfig())
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), name)
+			}
+			assert.Empty(t, currentConfig().GrafanaURL, "nothing is installed")
+		})
+	}
+
+	// A reload with one keeps the running configuration
+	t.Setenv("AUTH_BASIC_USERS", "alice:secret")
+	assert.NoError(t, startConfig(loadConfig()))
+	t.Setenv("AUTH_BASIC_USERS", "alice")
+	reloadConfig(context.Background())
+	assert.Equal(t, "alice:secret", currentConfig().AuthBasicUsers)
+}
+
+func TestConfigFilesStamp(t *testing.T) {
+	originalStatus := configStatus
+	defer func() { configStatus = originalStatus }()
+
+	useConfigFiles(t, "grafana_url: http://localhost:3000\n", "")
+	configStatus.File = os.Getenv("CONFIG_FILE")
+
+	before := configFilesStamp()
+	assert.Equal(t, before, configFilesStamp())
+
+	assert.NoError(t, os.WriteFile(envFilePath, []byte("SERVER_PORT=9000\n"), 0o600))
+	assert.NotEqual(t, before, configFilesStamp())
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// dashboardEnricher fetches dashboard versions and update timestamps in the
+// background so that /api/dashboards can answer straight from the search
+// results. Every enriched dashboard is published to the subscribers of
+// /api/dashboards/updates. Work and subscribers are grouped by credential
+// scope so that users calling Grafana with their own credentials only see
+// their own dashboards.
+type dashboardEnricher struct {
+	mu          sync.Mutex
+	inFlight    map[string]map[string]bool // scope -> dashboard UID
+	subscribers map[chan Dashboard]string  // subscriber -> scope
+	semaphore   chan struct{}
+}
+
+var enricher = newDashboardEnricher(10)
+
+func newDashboardEnricher(concurrency int) *dashboardEnricher {
+	return &dashboardEnricher{
+		inFlight:    make(map[string]map[string]bool),
+		subscribers: make(map[chan Dashboard]string),
+		semaphore:   make(chan struct{}, concurrency),
+	}
+}
+
+// Enqueue schedules the given dashboards for enrichment and returns how many
+// are still pending, including ones already queued by an earlier request.
+// The work outlives the request, but keeps its Grafana credentials.
+func (e *dashboardEnricher) Enqueue(ctx context.Context, dashboards []Dashboard) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	scope := credentialScope(ctx)
+	ctx = context.WithoutCancel(ctx)
+	if e.inFlight[scope] == nil {
+		e.inFlight[scope] = make(map[string]bool)
+	}
+
+	pending := 0
+	for _, dash := range dashboards {
+		pending++
+		if e.inFlight[scope][dash.UID] {
+			continue
+		}
+		e.inFlight[scope][dash.UID] = true
+
+		go func(dash Dashboard) {
+			e.semaphore <- struct{}{}
+			enriched := fetchDashboardDetail(ctx, dash)
+			<-e.semaphore
+
+			e.finish(scope, enriched)
+		}(dash)
+	}
+
+	if pending > 0 {
+		log.Printf("Enriching %d dashboards in the background", pending)
+	}
+	return pending
+}
+
+func (e *dashboardEnricher) finish(scope string, dash Dashboard) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.inFlight[scope], dash.UID)
+	if len(e.inFlight[scope]) == 0 {
+		delete(e.inFlight, scope)
+	}
+
+	for subscriber, subscriberScope := range e.subscribers {
+		if subscriberScope != scope {
+			continue
+		}
+		select {
+		case subscriber <- dash:
+		default:
+			// Slow subscriber; it can still pick the value up from the cache on reload
+		}
+	}
+}
+
+// Pending reports how many dashboards of the caller's scope are currently
+// being enriched.
+func (e *dashboardEnricher) Pending(ctx context.Context) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return len(e.inFlight[credentialScope(ctx)])
+}
+
+func (e *dashboardEnricher) Subscribe(ctx context.Context) chan Dashboard {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	subscriber := make(chan Dashboard, 256)
+	e.subscribers[subscriber] = credentialScope(ctx)
+	return subscriber
+}
+
+func (e *dashboardEnricher) Unsubscribe(subscriber chan Dashboard) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.subscribers, subscriber)
+}
+
+// streamDashboardUpdates pushes enriched dashboards to the browser as
+// server-sent events until the client disconnects.
+func streamDashboardUpdates(c echo.Context) error {
+	ctx := c.Request().Context()
+	subscriber := enricher.Subscribe(ctx)
+	defer enricher.Unsubscribe(subscriber)
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	response.Header().Set(echo.HeaderConnection, "keep-alive")
+	response.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(response, "event: pending\ndata: %d\n\n", enricher.Pending(ctx))
+	response.Flush()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			fmt.Fprint(response, ": heartbeat\n\n")
+			response.Flush()
+		case dash := <-subscriber:
+			payload, err := json.Marshal(map[string]interface{}{
+				"uid":     dash.UID,
+				"updated": dash.Updated,
+				"version": dash.Version,
+				"pending": enricher.Pending(ctx),
+			})
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(response, "event: dashboard\ndata: %s\n\n", payload)
+			response.Flush()
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEnrichmentTestServer(detailCalls, versionCalls *atomic.Int32) *httptest.Server {
+	detail := `{"dashboard":{"version":4},"meta":{"folderId":0}}`
+	version := `{"version":4,"created":"2026-05-01T00:00:00Z"}`
+	return newFakeGrafana(map[string]any{
+		"/api/search": `[
+			{"id":1,"uid":"async-1","title":"Async 1","type":"dash-db"},
+			{"id":2,"uid":"async-2","title":"Async 2","type":"dash-db"}
+		]`,
+		"/api/dashboards/uid/async-1":            countRequests(detailCalls, detail),
+		"/api/dashboards/uid/async-2":            countRequests(detailCalls, detail),
+		"/api/dashboards/uid/async-1/versions/4": countRequests(versionCalls, version),
+		"/api/dashboards/uid/async-2/versions/4": countRequests(versionCalls, version),
+	})
+}
+
+func TestGetDashboardsReturnsBeforeEnrichment(t *testing.T) {
+	originalConfig := config
+	originalCache := metaCache
+	originalEnricher := enricher
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+		enricher = originalEnricher
+	}()
+
+	var detailCalls, versionCalls atomic.Int32
+	ts := newEnrichmentTestServer(&detailCalls, &versionCalls)
+	defer ts.Close()
+
+	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
+	metaCache = newMetadataCache(time.Minute)
+	enricher = newDashboardEnricher(2)
+
+	subscriber := enricher.Subscribe(context.Background())
+	defer enricher.Unsubscribe(subscriber)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/dashboards", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, getDashboards(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response DashboardResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Len(t, response.Dashboards, 2)
+	assert.Equal(t, 2, response.Pending)
+
+	received := map[string]Dashboard{}
+	timeout := time.After(2 * time.Second)
+	for len(received) < 2 {
+		select {
+		case dash := <-subscriber:
+			received[dash.UID] = dash
+		case <-timeout:
+			t.Fatal("timed out waiting for enrichment")
+		}
+	}
+	assert.Equal(t, 4, received["async-1"].Version)
+	assert.Equal(t, "2026-05-01T00:00:00Z", received["async-2"].Updated)
+
+	// The second listing is served entirely from the cache
+	rec = httptest.NewRecorder()
+	assert.NoError(t, getDashboards(e.NewContext(httptest.NewRequest(http.MethodGet, "/api/dashboards", nil), rec)))
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, 0, response.Pending)
+	assert.Equal(t, 4, response.Dashboards[0].Version)
+	assert.Equal(t, int32(2), detailCalls.Load())
+}
+
+func TestFetchDashboardDetailUsesVersionCache(t *testing.T) {
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+
+	var detailCalls, versionCalls atomic.Int32
+	ts := newEnrichmentTestServer(&detailCalls, &versionCalls)
+	defer ts.Close()
+
+	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
+	metaCache = newMetadataCache(time.Minute)
+
+	dash := fetchDashboardDetail(context.Background(), Dashboard{UID: "async-1"})
+	assert.Equal(t, "2026-05-01T00:00:00Z", dash.Updated)
+
+	// Expire the details but keep the version timestamp
+	metaCache.Invalidate(cacheDashboardDetails)
+	dash = fetchDashboardDetail(context.Background(), Dashboard{UID: "async-1"})
+	assert.Equal(t, "2026-05-01T00:00:00Z", dash.Updated)
+	assert.Equal(t, int32(2), detailCalls.Load())
+	assert.Equal(t, int32(1), versionCalls.Load())
+}
+
+func TestEnqueueSkipsInFlightDashboards(t *testing.T) {
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+
+	release := make(chan struct{})
+	var calls atomic.Int32
+	ts := newFakeGrafana(map[string]any{
+		"/api/dashboards/uid/slow": countRequests(&calls, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			http.NotFound(w, r)
+		})),
+	})
+	defer ts.Close()
+
+	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
+	metaCache = newMetadataCache(time.Minute)
+	testEnricher := newDashboardEnricher(2)
+
+	subscriber := testEnricher.Subscribe(context.Background())
+	defer testEnricher.Unsubscribe(subscriber)
+
+	assert.Equal(t, 1, testEnricher.Enqueue(context.Background(), []Dashboard{{UID: "slow"}}))
+	assert.Equal(t, 1, testEnricher.Enqueue(context.Background(), []Dashboard{{UID: "slow"}}))
+	assert.Equal(t, 1, testEnricher.Pending(context.Background()))
+
+	close(release)
+	select {
+	case dash := <-subscriber:
+		assert.Equal(t, "slow", dash.UID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for enrichment")
+	}
+	assert.Equal(t, 0, testEnricher.Pending(context.Background()))
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestStreamDashboardUpdates(t *testing.T) {
+	originalEnricher := enricher
+	defer func() { enricher = originalEnricher }()
+
+	enricher = newDashboardEnricher(1)
+
+	e := echo.New()
+	e.GET("/api/dashboards/updates", streamDashboardUpdates)
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/dashboards/updates", nil)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "event: pending\n", line)
+
+	// The handler subscribes before writing the first event
+	enricher.finish("", Dashboard{UID: "pushed", Version: 3, Updated: "2026-05-01T00:00:00Z"})
+
+	var event string
+	for !strings.HasPrefix(event, "data: {") {
+		event, err = reader.ReadString('\n')
+		assert.NoError(t, err)
+	}
+
+	var payload map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(event), "data: ")), &payload))
+	assert.Equal(t, "pushed", payload["uid"])
+	assert.Equal(t, float64(3), payload["version"])
+}
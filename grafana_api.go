@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// grafanaVersionState holds the Grafana version the exporter talks to. It is
+// pinned by GRAFANA_VERSION, or detected from /api/health at startup and
+// refreshed by every health probe, so that an upgrade of Grafana is picked up
+// without a restart.
+type grafanaVersionState struct {
+	mu      sync.RWMutex
+	version float64
+	pinned  bool
+}
+
+var detectedGrafanaVersion grafanaVersionState
+
+// pinGrafanaVersion makes a configured version such as "10.4" override
+// detection. An empty version forgets any version and detects it again.
+func pinGrafanaVersion(configured string) error {
+	var version float64
+	if configured != "" {
+		parsed, ok := parseGrafanaVersion(configured)
+		if !ok {
+			return fmt.Errorf("invalid GRAFANA_VERSION %q, expected major.minor", configured)
+		}
+		version = parsed
+	}
+
+	detectedGrafanaVersion.mu.Lock()
+	defer detectedGrafanaVersion.mu.Unlock()
+
+	detectedGrafanaVersion.version = version
+	detectedGrafanaVersion.pinned = version > 0
+	return nil
+}
+
+// rememberGrafanaVersion records a version string reported by Grafana, such
+// as "11.1.0" or "10.4.2-security-01". Unparsable versions are ignored.
+func rememberGrafanaVersion(reported string) {
+	version, ok := parseGrafanaVersion(reported)
+	if !ok {
+		return
+	}
+
+	detectedGrafanaVersion.mu.Lock()
+	defer detectedGrafanaVersion.mu.Unlock()
+
+	if detectedGrafanaVersion.pinned || detectedGrafanaVersion.version == version {
+		return
+	}
+	detectedGrafanaVersion.version = version
+	log.Printf("Detected Grafana version %s", reported)
+}
+
+// parseGrafanaVersion turns "major.minor.patch..." into major.minor.
+func parseGrafanaVersion(reported string) (float64, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(reported, "v"), ".", 3)
+	if len(parts) < 2 {
+		return 0, false
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, false
+	}
+	minor, err := strconv.Atoi(strings.TrimFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	if err != nil {
+		return 0, false
+	}
+
+	// Minor versions go up to two digits, e.g. 9.10 must sort after 9.9
+	return float64(major) + float64(minor)/100, true
+}
+
+// detectGrafanaVersion asks Grafana for its version at startup.
+func detectGrafanaVersion(ctx context.Context) {
+	code, body, err := probeGrafanaEndpoint(ctx, currentConfig(), "/api/health", false)
+	if err != nil || code != http.StatusOK {
+		log.Printf("Warning: Could not detect the Grafana version, trying endpoints for all versions")
+		return
+	}
+
+	var healthResponse struct {
+		Version string `json:"version"`
+	}
+	if json.Unmarshal(body, &healthResponse) == nil {
+		rememberGrafanaVersion(healthResponse.Version)
+	}
+}
+
+// grafanaAPI picks the endpoints that exist in one Grafana version. The
+// version is major + minor/100, e.g. 9.1 is 9.01. A zero version is unknown:
+// callers then try the newest endpoint first and fall back to older ones.
+type grafanaAPI struct {
+	version float64
+}
+
+func currentGrafanaAPI() grafanaAPI {
+	detectedGrafanaVersion.mu.RLock()
+	defer detectedGrafanaVersion.mu.RUnlock()
+
+	return grafanaAPI{version: detectedGrafanaVersion.version}
+}
+
+func (a grafanaAPI) atLeast(major, minor int) bool {
+	return a.version == 0 || a.version >= float64(major)+float64(minor)/100
+}
+
+func (a grafanaAPI) String() string {
+	if a.version == 0 {
+		return "unknown"
+	}
+	major := int(a.version)
+	return fmt.Sprintf("%d.%d", major, int((a.version-float64(major))*100+0.5))
+}
+
+// NestedFolders reports whether folders can have subfolders, listed with
+// parentUid. They arrived behind a feature toggle in 10.0.
+func (a grafanaAPI) NestedFolders() bool {
+	return a.atLeast(10, 0)
+}
+
+// LibraryElements reports whether /api/library-elements exists (8.0+).
+func (a grafanaAPI) LibraryElements() bool {
+	return a.atLeast(8, 0)
+}
+
+// ServiceAccounts reports whether /api/serviceaccounts exists (9.0+).
+func (a grafanaAPI) ServiceAccounts() bool {
+	return a.atLeast(9, 0)
+}
+
+// PublicDashboards reports whether dashboards can be shared publicly, which
+// became generally available in 10.0.
+func (a grafanaAPI) PublicDashboards() bool {
+	return a.atLeast(10, 0)
+}
+
+// QueryHistory reports whether /api/query-history exists (9.0+).
+func (a grafanaAPI) QueryHistory() bool {
+	return a.atLeast(9, 0)
+}
+
+// DashboardVersionsURL returns the URL listing the saved versions of a
+// dashboard, addressed like DashboardVersionURL.
+func (a grafanaAPI) DashboardVersionsURL(dash Dashboard) string {
+	if !a.atLeast(9, 0) && dash.ID != 0 {
+		return fmt.Sprintf("%s/api/dashboards/id/%d/versions", currentConfig().GrafanaURL, dash.ID)
+	}
+	return fmt.Sprintf("%s/api/dashboards/uid/%s/versions", currentConfig().GrafanaURL, dash.UID)
+}
+
+// DashboardVersionURL returns the URL of one saved version of a dashboard.
+// Versions are addressed by dashboard UID from 9.0 and by numeric ID before.
+func (a grafanaAPI) DashboardVersionURL(dash Dashboard, version int) string {
+	if !a.atLeast(9, 0) && dash.ID != 0 {
+		return fmt.Sprintf("%s/api/dashboards/id/%d/versions/%d", currentConfig().GrafanaURL, dash.ID, version)
+	}
+	return fmt.Sprintf("%s/api/dashboards/uid/%s/versions/%d", currentConfig().GrafanaURL, dash.UID, version)
+}
+
+// DashboardRestoreURL returns the endpoint restoring a saved version of a
+// dashboard, addressed like DashboardVersionURL.
+func (a grafanaAPI) DashboardRestoreURL(dash Dashboard) string {
+	if !a.atLeast(9, 0) && dash.ID != 0 {
+		return fmt.Sprintf("%s/api/dashboards/id/%d/restore", currentConfig().GrafanaURL, dash.ID)
+	}
+	return fmt.Sprintf("%s/api/dashboards/uid/%s/restore", currentConfig().GrafanaURL, dash.UID)
+}
+
+// AlertRuleURLs returns the endpoints listing alert rules, or fetching the
+// rule uid when it is not empty, in the order they should be tried. The
+// provisioning API of unified alerting exists from 9.1; legacy alerting can
+// still be enabled until it was removed in 11.0.
+func (a grafanaAPI) AlertRuleURLs(uid string) []string {
+	provisioning := currentConfig().GrafanaURL + "/api/v1/provisioning/alert-rules"
+	legacy := currentConfig().GrafanaURL + "/api/alerts"
+	if uid != "" {
+		provisioning += "/" + uid
+		legacy += "/" + uid
+	}
+
+	switch {
+	case !a.atLeast(9, 1):
+		return []string{legacy}
+	case a.version >= 11:
+		return []string{provisioning}
+	default:
+		return []string{provisioning, legacy}
+	}
+}
+
+// fetchAlertRules fetches from the first alert endpoint that answers.
+func fetchAlertRules(ctx context.Context, uid string, target interface{}) error {
+	var err error
+	for _, url := range currentGrafanaAPI().AlertRuleURLs(uid) {
+		if err = fetchAPIRaw(ctx, url, target); err == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGrafanaVersion(t *testing.T) {
+	for reported, expected := range map[string]float64{
+		"11.1.0":             11.01,
+		"10.4.2-security-01": 10.04,
+		"9.10.1":             9.10,
+		"v8.5.27":            8.05,
+		"12.0.0-pre":         12.00,
+	} {
+		version, ok := parseGrafanaVersion(reported)
+		assert.True(t, ok, reported)
+		assert.InDelta(t, expected, version, 0.0001, reported)
+	}
+
+	for _, reported := range []string{"", "11", "main", "x.y"} {
+		_, ok := parseGrafanaVersion(reported)
+		assert.False(t, ok, reported)
+	}
+
+	// 9.10 is newer than 9.9
+	nine, _ := parseGrafanaVersion("9.9.0")
+	ten, _ := parseGrafanaVersion("9.10.0")
+	assert.Less(t, nine, ten)
+}
+
+func TestGrafanaAPIEndpoints(t *testing.T) {
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	config = Config{GrafanaURL: "http://grafana"}
+
+	unknown := grafanaAPI{}
+	assert.True(t, unknown.NestedFolders())
+	assert.True(t, unknown.LibraryElements())
+	assert.Equal(t, []string{
+		"http://grafana/api/v1/provisioning/alert-rules",
+		"http://grafana/api/alerts",
+	}, unknown.AlertRuleURLs(""))
+	assert.Equal(t, "unknown", unknown.String())
+
+	v11 := grafanaAPI{version: 11.01}
+	assert.Equal(t, []string{"http://grafana/api/v1/provisioning/alert-rules/r1"}, v11.AlertRuleURLs("r1"))
+	assert.Equal(t, "11.1", v11.String())
+
+	v10 := grafanaAPI{version: 10.04}
+	assert.Len(t, v10.AlertRuleURLs(""), 2)
+	assert.True(t, v10.NestedFolders())
+
+	v9 := grafanaAPI{version: 9.00}
+	assert.Equal(t, []string{"http://grafana/api/alerts/7"}, v9.AlertRuleURLs("7"))
+	assert.False(t, v9.NestedFolders())
+
+	v7 := grafanaAPI{version: 7.05}
+	assert.False(t, v7.LibraryElements())
+	dash := Dashboard{ID: 42, UID: "abc"}
+	assert.Equal(t, "http://grafana/api/dashboards/id/42/versions/3", v7.DashboardVersionURL(dash, 3))
+	assert.Equal(t, "http://grafana/api/dashboards/uid/abc/versions/3", v9.DashboardVersionURL(dash, 3))
+}
+
+func TestGrafanaVersionDetection(t *testing.T) {
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	defer pinGrafanaVersion("")
+
+	version := "9.0.3"
+	ts := newFakeGrafana(map[string]any{
+		"/api/health": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]string{"database": "ok", "version": version})
+		}),
+	})
+	defer ts.Close()
+	config = Config{GrafanaURL: ts.URL}
+
+	pinGrafanaVersion("")
+	detectGrafanaVersion(context.Background())
+	assert.Equal(t, "9.0", currentGrafanaAPI().String())
+
+	// Health probes pick up an upgrade
+	version = "11.2.0"
+	probeGrafana(context.Background())
+	assert.Equal(t, "11.2", currentGrafanaAPI().String())
+
+	// A configured version wins over detection
+	assert.NoError(t, pinGrafanaVersion("10.3"))
+	detectGrafanaVersion(context.Background())
+	assert.Equal(t, "10.3", currentGrafanaAPI().String())
+}
+
+func TestGetAlertsUsesLegacyAPIOnOldGrafana(t *testing.T) {
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	defer pinGrafanaVersion("")
+
+	var unified atomic.Int32
+	ts := newFakeGrafana(map[string]any{
+		"/api/alerts":                      `[{"id":1,"uid":"legacy","title":"Legacy Alert"}]`,
+		"/api/v1/provisioning/alert-rules": countRequests(&unified, `[]`),
+	})
+	defer ts.Close()
+
+	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "test-key"}
+	metaCache = newMetadataCache(0)
+	pinGrafanaVersion("8.5")
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/alerts", nil), rec)
+	assert.NoError(t, getAlerts(c))
+
+	var response AlertResponse
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.Len(t, response.Alerts, 1)
+	assert.Zero(t, unified.Load())
+}
+
+func TestGetAlertsFolderOfUnifiedRule(t *testing.T) {
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+
+	ts := newFakeGrafana(map[string]any{
+		// Unified alert rules have a folderUID but no folderId
+		"/api/v1/provisioning/alert-rules": `[{"uid":"r1","title":"Rule","folderUID":"f1"}]`,
+		"/api/folders/f1":                  `{"uid":"f1","title":"Team"}`,
+	})
+	defer ts.Close()
+
+	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "test-key"}
+	metaCache = newMetadataCache(0)
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/alerts", nil), rec)
+	assert.NoError(t, getAlerts(c))
+
+	var response AlertResponse
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.Len(t, response.Alerts, 1)
+	assert.Equal(t, "Team", response.Alerts[0].FolderTitle)
+}
+
+func TestPinGrafanaVersionRejectsGarbage(t *testing.T) {
+	defer pinGrafanaVersion("")
+
+	assert.Error(t, pinGrafanaVersion("eleven"))
+	assert.Equal(t, "unknown", currentGrafanaAPI().String())
+}
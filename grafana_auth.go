@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Values for GRAFANA_AUTH.
+const (
+	grafanaAuthBearer = "bearer" // GRAFANA_API_KEY as a bearer token
+	grafanaAuthBasic  = "basic"  // GRAFANA_USERNAME and GRAFANA_PASSWORD
+	grafanaAuthProxy  = "proxy"  // GRAFANA_AUTH_PROXY_USER in GRAFANA_AUTH_PROXY_HEADER
+)
+
+// grafanaOrgKey carries the Grafana organization a request is made in.
+type grafanaOrgKey struct{}
+
+// withGrafanaOrg makes the Grafana requests of ctx run in the given
+// organization instead of the default one of the credentials.
+func withGrafanaOrg(ctx context.Context, orgID int) context.Context {
+	return context.WithValue(ctx, grafanaOrgKey{}, orgID)
+}
+
+// grafanaOrgFrom returns the organization of ctx, or 0 for the default one.
+func grafanaOrgFrom(ctx context.Context) int {
+	orgID, _ := ctx.Value(grafanaOrgKey{}).(int)
+	return orgID
+}
+
+// applyGrafanaAuth authenticates req with the shared credentials of cfg:
+// the organization's own service account token when GRAFANA_ORG_API_KEYS has
+// one, otherwise the GRAFANA_AUTH mode. The extra headers and cookies are
+// added as well.
+func applyGrafanaAuth(req *http.Request, cfg Config, orgID int) {
+	applyGrafanaExtras(req, cfg)
+
+	if orgID > 0 {
+		req.Header.Set("X-Grafana-Org-Id", strconv.Itoa(orgID))
+		orgKeys, _ := parseOrgKeyList(cfg.GrafanaOrgAPIKeys)
+		if key, ok := orgKeys[orgID]; ok {
+			req.Header.Set("Authorization", "Bearer "+key)
+			return
+		}
+	}
+
+	switch cfg.GrafanaAuth {
+	case grafanaAuthBasic:
+		req.SetBasicAuth(cfg.GrafanaUsername, cfg.GrafanaPassword)
+	case grafanaAuthProxy:
+		req.Header.Set(cfg.GrafanaAuthProxyHeader, cfg.GrafanaAuthProxyUser)
+	default:
+		if cfg.GrafanaAPIKey != "" {
+			req.Header.Set("Authorization", "Bearer "+cfg.GrafanaAPIKey)
+		}
+	}
+}
+
+// applyGrafanaExtras adds the extra headers and cookies of cfg, which a
+// proxy in front of Grafana may need even for unauthenticated requests.
+func applyGrafanaExtras(req *http.Request, cfg Config) {
+	headers, _ := parseHeaderList(cfg.GrafanaHeaders)
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	cookies, _ := http.ParseCookie(cfg.GrafanaCookies)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+}
+
+// grafanaAuthMissing describes what is missing for the shared credentials of
+// cfg to be usable, or returns an empty string when nothing is.
+func grafanaAuthMissing(cfg Config) string {
+	switch cfg.GrafanaAuth {
+	case grafanaAuthBasic:
+		if cfg.GrafanaUsername == "" {
+			return "GRAFANA_USERNAME is not set"
+		}
+	case grafanaAuthProxy:
+		if cfg.GrafanaAuthProxyUser == "" {
+			return "GRAFANA_AUTH_PROXY_USER is not set"
+		}
+	default:
+		if cfg.GrafanaAPIKey == "" {
+			return "GRAFANA_API_KEY is not set"
+		}
+	}
+	return ""
+}
+
+// grafanaIdentityChanged reports whether Grafana sees the shared
+// credentials of next as someone else than those of previous.
+func grafanaIdentityChanged(previous, next Config) bool {
+	return previous.GrafanaAuth != next.GrafanaAuth ||
+		previous.GrafanaAPIKey != next.GrafanaAPIKey ||
+		previous.GrafanaUsername != next.GrafanaUsername ||
+		previous.GrafanaAuthProxyUser != next.GrafanaAuthProxyUser ||
+		previous.GrafanaOrgAPIKeys != next.GrafanaOrgAPIKeys
+}
+
+// grafanaAuthName names the shared credentials of cfg in messages.
+func grafanaAuthName(cfg Config) string {
+	switch cfg.GrafanaAuth {
+	case grafanaAuthBasic:
+		return "basic auth credentials"
+	case grafanaAuthProxy:
+		return "auth proxy user"
+	}
+	return "API key"
+}
+
+// parseHeaderList parses "Name: value" pairs, comma separated.
+func parseHeaderList(value string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, headerValue, ok := strings.Cut(item, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid GRAFANA_HEADERS entry %q, expected Name: value", item)
+		}
+		headers.Add(name, strings.TrimSpace(headerValue))
+	}
+	return headers, nil
+}
+
+// parseOrgKeyList parses orgId:token pairs, comma separated.
+func parseOrgKeyList(value string) (map[int]string, error) {
+	keys, err := parseCredentialList(value, "GRAFANA_ORG_API_KEYS")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]string, len(keys))
+	for org, key := range keys {
+		orgID, err := strconv.Atoi(org)
+		if err != nil || orgID < 1 {
+			return nil, fmt.Errorf("invalid organization ID %q in GRAFANA_ORG_API_KEYS", org)
+		}
+		result[orgID] = key
+	}
+	return result, nil
+}
+
+func validateHeaderList(value string) error {
+	_, err := parseHeaderList(value)
+	return err
+}
+
+func validateCookieList(value string) error {
+	if value == "" {
+		return nil
+	}
+	_, err := http.ParseCookie(value)
+	return err
+}
+
+func validateOrgKeyList(value string) error {
+	_, err := parseOrgKeyList(value)
+	return err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordGrafanaRequests answers every request with an empty object and
+// keeps the last request for inspection.
+func recordGrafanaRequests(last **http.Request) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*last = r
+		w.Write([]byte(`{}`))
+	}))
+}
+
+func TestGrafanaAuthModes(t *testing.T) {
+	var last *http.Request
+	grafana := recordGrafanaRequests(&last)
+	defer grafana.Close()
+
+	originalConfig := config
+	defer func() { config = originalConfig }()
+
+	fetch := func(ctx context.Context, cfg Config) *http.Request {
+		cfg.GrafanaURL = grafana.URL
+		config = cfg
+		var result map[string]interface{}
+		assert.NoError(t, fetchAPIRaw(ctx, grafana.URL+"/api/org", &result))
+		return last
+	}
+
+	req := fetch(context.Background(), Config{GrafanaAuth: grafanaAuthBearer, GrafanaAPIKey: "glsa_shared"})
+	assert.Equal(t, "Bearer glsa_shared", req.Header.Get("Authorization"))
+
+	req = fetch(context.Background(), Config{GrafanaAuth: grafanaAuthBasic, GrafanaUsername: "backup", GrafanaPassword: "s3cret"})
+	username, password, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "backup", username)
+	assert.Equal(t, "s3cret", password)
+
+	req = fetch(context.Background(), Config{
+		GrafanaAuth:            grafanaAuthProxy,
+		GrafanaAuthProxyUser:   "exporter",
+		GrafanaAuthProxyHeader: "X-WEBAUTH-USER",
+		GrafanaHeaders:         "X-Proxy-Secret: abc, X-Tenant: ops",
+		GrafanaCookies:         "session=xyz; lb=2",
+	})
+	assert.Equal(t, "exporter", req.Header.Get("X-WEBAUTH-USER"))
+	assert.Empty(t, req.Header.Get("Authorization"))
+	assert.Equal(t, "abc", req.Header.Get("X-Proxy-Secret"))
+	assert.Equal(t, "ops", req.Header.Get("X-Tenant"))
+	cookie, err := req.Cookie("session")
+	assert.NoError(t, err)
+	assert.Equal(t, "xyz", cookie.Value)
+
+	// Organizations with their own service account token use it
+	cfg := Config{GrafanaAuth: grafanaAuthBearer, GrafanaAPIKey: "glsa_shared", GrafanaOrgAPIKeys: "2:glsa_org2"}
+	req = fetch(withGrafanaOrg(context.Background(), 2), cfg)
+	assert.Equal(t, "Bearer glsa_org2", req.Header.Get("Authorization"))
+	assert.Equal(t, "2", req.Header.Get("X-Grafana-Org-Id"))
+
+	req = fetch(withGrafanaOrg(context.Background(), 3), cfg)
+	assert.Equal(t, "Bearer glsa_shared", req.Header.Get("Authorization"))
+	assert.Equal(t, "3", req.Header.Get("X-Grafana-Org-Id"))
+
+	// Per-user credentials replace the shared ones, the extra headers stay
+	cfg = Config{GrafanaAuth: grafanaAuthBearer, GrafanaAPIKey: "glsa_shared", GrafanaHeaders: "X-Proxy-Secret: abc"}
+	req = fetch(withGrafanaCredentials(context.Background(), &grafanaCredentials{token: "user-token"}), cfg)
+	assert.Equal(t, "Bearer user-token", req.Header.Get("Authorization"))
+	assert.Equal(t, "abc", req.Header.Get("X-Proxy-Secret"))
+}
+
+func TestCheckGrafanaWithBasicAuth(t *testing.T) {
+	grafana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/health" {
+			w.Write([]byte(`{"database":"ok","version":"11.1.0"}`))
+			return
+		}
+		if username, password, _ := r.BasicAuth(); username != "admin" || password != "admin" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id":1,"name":"Main Org."}`))
+	}))
+	defer grafana.Close()
+	defer pinGrafanaVersion("")
+
+	cfg := Config{GrafanaURL: grafana.URL, GrafanaAuth: grafanaAuthBasic, GrafanaUsername: "admin", GrafanaPassword: "admin"}
+	status := checkGrafana(context.Background(), cfg)
+	assert.True(t, status.Ready)
+	assert.Equal(t, "Main Org.", status.Organization)
+
+	cfg.GrafanaPassword = "wrong"
+	status = checkGrafana(context.Background(), cfg)
+	assert.False(t, status.Ready)
+	assert.Contains(t, status.Error, "rejected the basic auth credentials")
+
+	cfg.GrafanaUsername = ""
+	status = checkGrafana(context.Background(), cfg)
+	assert.Equal(t, "GRAFANA_USERNAME is not set", status.Error)
+}
+
+func TestGrafanaAuthSettings(t *testing.T) {
+	useConfigFiles(t, "grafana_auth: proxy\n", "")
+	t.Setenv("GRAFANA_HEADERS", "no colon here")
+	t.Setenv("GRAFANA_ORG_API_KEYS", "main:glsa_x")
+
+	loaded := loadConfig()
+	assert.Len(t, loaded.Problems, 3)
+	assert.Contains(t, loaded.Problems[0], "GRAFANA_ORG_API_KEYS")
+	assert.Contains(t, loaded.Problems[1], "GRAFANA_HEADERS")
+	assert.Contains(t, loaded.Problems[2], "GRAFANA_AUTH_PROXY_USER is not set")
+	assert.Equal(t, "X-WEBAUTH-USER", loaded.Config.GrafanaAuthProxyHeader)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Values for GRAFANA_CREDENTIALS.
+const (
+	grafanaCredentialsShared = "shared" // everyone acts with GRAFANA_API_KEY
+	grafanaCredentialsUser   = "user"   // every user acts with their own Grafana credentials
+)
+
+// verifiedLoginTTL is how long the exporter trusts a Grafana credential check
+// before asking Grafana again.
+const verifiedLoginTTL = time.Minute
+
+// grafanaCredentials are the credentials the exporter presents to Grafana on
+// behalf of one user, instead of the shared API key.
+type grafanaCredentials struct {
+	token     string // OIDC token or the user's own Grafana token
+	username  string
+	password  string
+	scope     string    // identity whose permissions these credentials carry
+	expiresAt time.Time // zero when the credentials do not expire
+}
+
+func (g *grafanaCredentials) apply(req *http.Request) {
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+		return
+	}
+	req.SetBasicAuth(g.username, g.password)
+}
+
+type grafanaCredentialsKey struct{}
+
+func withGrafanaCredentials(ctx context.Context, creds *grafanaCredentials) context.Context {
+	return context.WithValue(ctx, grafanaCredentialsKey{}, creds)
+}
+
+// grafanaCredentialsFrom returns the per-user credentials carried by ctx, or
+// nil when Grafana should be called with the shared API key.
+func grafanaCredentialsFrom(ctx context.Context) *grafanaCredentials {
+	creds, _ := ctx.Value(grafanaCredentialsKey{}).(*grafanaCredentials)
+	return creds
+}
+
+// credentialScope names the Grafana identity and organization ctx calls
+// Grafana with; it is empty for the shared credentials in their default
+// organization.
+func credentialScope(ctx context.Context) string {
+	scope := ""
+	if creds := grafanaCredentialsFrom(ctx); creds != nil {
+		scope = creds.scope
+	}
+	if orgID := grafanaOrgFrom(ctx); orgID > 0 {
+		scope += "@org:" + strconv.Itoa(orgID)
+	}
+	return scope
+}
+
+// newGrafanaRequest builds a request to the Grafana API authenticated with
+// the caller's own credentials when ctx carries them, or the shared ones.
+func newGrafanaRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := grafanaCredentialsFrom(ctx)
+	if creds == nil {
+		applyGrafanaAuth(req, currentConfig(), grafanaOrgFrom(ctx))
+		return req, nil
+	}
+
+	applyGrafanaExtras(req, currentConfig())
+	if orgID := grafanaOrgFrom(ctx); orgID > 0 {
+		req.Header.Set("X-Grafana-Org-Id", strconv.Itoa(orgID))
+	}
+	creds.apply(req)
+	return req, nil
+}
+
+// grafanaSignedInUser is the subset of /api/user the exporter needs.
+type grafanaSignedInUser struct {
+	Login string `json:"login"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// verifyGrafanaCredentials asks Grafana who the credentials belong to, and
+// fills in their scope. Grafana rejecting them is reported as an error.
+func verifyGrafanaCredentials(ctx context.Context, creds *grafanaCredentials) (*grafanaSignedInUser, error) {
+	var signedIn grafanaSignedInUser
+	if err := fetchAPIRaw(withGrafanaCredentials(ctx, creds), currentConfig().GrafanaURL+"/api/user", &signedIn); err != nil {
+		return nil, fmt.Errorf("Grafana rejected the credentials: %v", err)
+	}
+	if signedIn.Login == "" {
+		return nil, fmt.Errorf("Grafana did not report a login for the credentials")
+	}
+
+	creds.scope = "grafana:" + signedIn.Login
+	return &signedIn, nil
+}
+
+type verifiedLogin struct {
+	user      *User
+	expiresAt time.Time
+}
+
+// verifiedLogins remembers recently verified Grafana credentials, keyed by a
+// hash of the credentials, so that API clients sending them on every request
+// do not cost a round trip to Grafana each time.
+type verifiedLogins struct {
+	mu     sync.Mutex
+	logins map[[sha256.Size]byte]verifiedLogin
+}
+
+func newVerifiedLogins() *verifiedLogins {
+	return &verifiedLogins{logins: make(map[[sha256.Size]byte]verifiedLogin)}
+}
+
+func credentialsHash(creds *grafanaCredentials) [sha256.Size]byte {
+	encoded, _ := json.Marshal([]string{creds.token, creds.username, creds.password})
+	return sha256.Sum256(encoded)
+}
+
+// Verify returns the exporter user for the given Grafana credentials,
+// asking Grafana only when they were not verified recently.
+func (v *verifiedLogins) Verify(ctx context.Context, creds *grafanaCredentials) (*User, error) {
+	key := credentialsHash(creds)
+	now := time.Now()
+
+	v.mu.Lock()
+	if login, ok := v.logins[key]; ok && now.Before(login.expiresAt) {
+		v.mu.Unlock()
+		return login.user, nil
+	}
+	v.mu.Unlock()
+
+	signedIn, err := verifyGrafanaCredentials(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+	user := &User{Name: signedIn.Login, Email: signedIn.Email, Provider: "grafana", grafana: creds}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for existing, login := range v.logins {
+		if now.After(login.expiresAt) {
+			delete(v.logins, existing)
+		}
+	}
+	v.logins[key] = verifiedLogin{user: user, expiresAt: now.Add(verifiedLoginTTL)}
+	return user, nil
+}
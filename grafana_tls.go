@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// grafanaTLSVersions are the accepted values of GRAFANA_TLS_MIN_VERSION.
+var grafanaTLSVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// grafanaTLSSettings are the settings a Grafana client is built from.
+type grafanaTLSSettings struct {
+	skipVerify bool
+	caCert     string
+	clientCert string
+	clientKey  string
+	serverName string
+	minVersion string
+}
+
+func grafanaTLSSettingsOf(cfg Config) grafanaTLSSettings {
+	return grafanaTLSSettings{
+		skipVerify: cfg.SkipTLSVerify,
+		caCert:     cfg.GrafanaCACert,
+		clientCert: cfg.GrafanaClientCert,
+		clientKey:  cfg.GrafanaClientKey,
+		serverName: cfg.GrafanaTLSServerName,
+		minVersion: cfg.GrafanaTLSMinVersion,
+	}
+}
+
+// grafanaTLSConfig builds the TLS configuration for Grafana from the CA
+// bundles, client certificate and options in cfg. Certificates are read
+// from disk every time, so that rotated files are picked up by a reload.
+func grafanaTLSConfig(cfg Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.SkipTLSVerify,
+		ServerName:         cfg.GrafanaTLSServerName,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if cfg.GrafanaTLSMinVersion != "" {
+		version, ok := grafanaTLSVersions[cfg.GrafanaTLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q", cfg.GrafanaTLSMinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if cfg.GrafanaCACert != "" {
+		// Internal CAs are trusted in addition to the system ones
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range strings.Split(cfg.GrafanaCACert, ",") {
+			path = strings.TrimSpace(path)
+			if path == "" {
+				continue
+			}
+			pem, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("could not read CA bundle: %v", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no PEM certificates found in %s", path)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (cfg.GrafanaClientCert == "") != (cfg.GrafanaClientKey == "") {
+		return nil, fmt.Errorf("GRAFANA_CLIENT_CERT and GRAFANA_CLIENT_KEY must be set together")
+	}
+	if cfg.GrafanaClientCert != "" {
+		certificate, err := tls.LoadX509KeyPair(cfg.GrafanaClientCert, cfg.GrafanaClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// sharedGrafanaClient is the client every call to the configured Grafana
+// goes through, so that connections are pooled across requests.
+var sharedGrafanaClient struct {
+	mu       sync.Mutex
+	settings grafanaTLSSettings
+	client   *http.Client
+}
+
+// grafanaClient returns an HTTP client for the Grafana in cfg. The client of
+// the running configuration is shared; one for other settings, such as a
+// connection test from the settings page, is built on demand.
+func grafanaClient(cfg Config) (*http.Client, error) {
+	settings := grafanaTLSSettingsOf(cfg)
+
+	sharedGrafanaClient.mu.Lock()
+	defer sharedGrafanaClient.mu.Unlock()
+
+	if sharedGrafanaClient.client != nil && sharedGrafanaClient.settings == settings {
+		return sharedGrafanaClient.client, nil
+	}
+
+	tlsConfig, err := grafanaTLSConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Grafana TLS settings: %v", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client := &http.Client{Transport: transport}
+
+	if settings == grafanaTLSSettingsOf(currentConfig()) {
+		if sharedGrafanaClient.client != nil {
+			sharedGrafanaClient.client.CloseIdleConnections()
+		}
+		sharedGrafanaClient.settings = settings
+		sharedGrafanaClient.client = client
+	}
+	return client, nil
+}
+
+// resetGrafanaClient drops the shared client so that the next call reads
+// the certificate files again.
+func resetGrafanaClient() {
+	sharedGrafanaClient.mu.Lock()
+	defer sharedGrafanaClient.mu.Unlock()
+
+	if sharedGrafanaClient.client != nil {
+		sharedGrafanaClient.client.CloseIdleConnections()
+	}
+	sharedGrafanaClient.client = nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writePEM writes a PEM block to a file in dir and returns its path.
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+// newClientCertificate creates a self-signed client certificate and returns
+// its certificate and key files along with the parsed certificate.
+func newClientCertificate(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "grafana-exporter"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	return writePEM(t, dir, "client.pem", "CERTIFICATE", der),
+		writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyDER),
+		certificate
+}
+
+func newTLSTestGrafana(clientCA *x509.Certificate) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"database":"ok","version":"11.1.0"}`))
+	}))
+	server.TLS = &tls.Config{}
+	if clientCA != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCA)
+		server.TLS.ClientCAs = pool
+		server.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	server.StartTLS()
+	return server
+}
+
+func TestGrafanaClientTrustsCABundle(t *testing.T) {
+	grafana := newTLSTestGrafana(nil)
+	defer grafana.Close()
+	caFile := writePEM(t, t.TempDir(), "ca.pem", "CERTIFICATE", grafana.Certificate().Raw)
+
+	cfg := Config{GrafanaURL: grafana.URL, GrafanaTLSMinVersion: "1.2"}
+	_, _, err := probeGrafanaEndpoint(context.Background(), cfg, "/api/health", false)
+	assert.Error(t, err, "the test certificate is not trusted by default")
+
+	cfg.GrafanaCACert = caFile
+	status, _, err := probeGrafanaEndpoint(context.Background(), cfg, "/api/health", false)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	// The certificate is issued for 127.0.0.1 and example.com only
+	cfg.GrafanaURL = strings.Replace(grafana.URL, "127.0.0.1", "localhost", 1)
+	_, _, err = probeGrafanaEndpoint(context.Background(), cfg, "/api/health", false)
+	assert.Error(t, err)
+
+	cfg.GrafanaTLSServerName = "example.com"
+	_, _, err = probeGrafanaEndpoint(context.Background(), cfg, "/api/health", false)
+	assert.NoError(t, err)
+}
+
+func TestGrafanaClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, clientCert := newClientCertificate(t, dir)
+	grafana := newTLSTestGrafana(clientCert)
+	defer grafana.Close()
+
+	cfg := Config{
+		GrafanaURL:    grafana.URL,
+		GrafanaCACert: writePEM(t, dir, "ca.pem", "CERTIFICATE", grafana.Certificate().Raw),
+	}
+	_, _, err := probeGrafanaEndpoint(context.Background(), cfg, "/api/health", false)
+	assert.Error(t, err, "Grafana requires a client certificate")
+
+	cfg.GrafanaClientCert = certFile
+	cfg.GrafanaClientKey = keyFile
+	status, _, err := probeGrafanaEndpoint(context.Background(), cfg, "/api/health", false)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestGrafanaTLSConfigProblems(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.txt")
+	assert.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+
+	_, err := grafanaTLSConfig(Config{GrafanaCACert: notPEM})
+	assert.ErrorContains(t, err, "no PEM certificates")
+
+	_, err = grafanaTLSConfig(Config{GrafanaCACert: filepath.Join(dir, "missing.pem")})
+	assert.ErrorContains(t, err, "could not read CA bundle")
+
+	_, err = grafanaTLSConfig(Config{GrafanaClientCert: filepath.Join(dir, "client.pem")})
+	assert.ErrorContains(t, err, "must be set together")
+
+	tlsConfig, err := grafanaTLSConfig(Config{GrafanaTLSMinVersion: "1.3"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+
+	// Broken files are reported when the configuration is loaded
+	useConfigFiles(t, "grafana_ca_cert: "+notPEM+"\n", "")
+	loaded := loadConfig()
+	assert.Len(t, loaded.Problems, 1)
+	assert.Contains(t, loaded.Problems[0], "Grafana TLS")
+}
+
+func TestGrafanaClientIsShared(t *testing.T) {
+	originalConfig := config
+	defer func() {
+		config = originalConfig
+		resetGrafanaClient()
+	}()
+	config = Config{GrafanaURL: "https://grafana.example.com", GrafanaTLSMinVersion: "1.2"}
+
+	first, err := grafanaClient(currentConfig())
+	assert.NoError(t, err)
+	second, _ := grafanaClient(currentConfig())
+	assert.Same(t, first, second)
+
+	// Other settings get a client of their own and leave the shared one alone
+	other, _ := grafanaClient(Config{SkipTLSVerify: true})
+	assert.NotSame(t, first, other)
+	again, _ := grafanaClient(currentConfig())
+	assert.Same(t, first, again)
+
+	resetGrafanaClient()
+	rebuilt, _ := grafanaClient(currentConfig())
+	assert.NotSame(t, first, rebuilt)
+}
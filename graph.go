@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Kinds of the nodes in the dependency graph.
+const (
+	nodeDashboard    = "dashboard"
+	nodeLibraryPanel = "library-panel"
+	nodeDatasource   = "datasource"
+	nodeAlertRule    = "alert-rule"
+)
+
+// graphNode is an object in the dependency graph, identified as <kind>:<uid>.
+type graphNode struct {
+	ID      string `json:"id"`
+	Kind    string `json:"kind"`
+	UID     string `json:"uid"`
+	Name    string `json:"name"`
+	Missing bool   `json:"missing,omitempty"` // Referred to but not found in Grafana
+}
+
+// graphEdge points from an object to one it depends on: a dashboard uses a
+// library panel, queries a datasource or links to another dashboard, and an
+// alert rule alerts on a dashboard.
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"` // uses, queries, links or alerts
+}
+
+type dependencyGraph struct {
+	Nodes  []graphNode `json:"nodes"`
+	Edges  []graphEdge `json:"edges"`
+	Errors []string    `json:"errors"`
+}
+
+// graphAlertRule is the part of an alert rule the graph needs, from the
+// provisioning API or, with dashboardUid, from legacy alerting.
+type graphAlertRule struct {
+	UID          string            `json:"uid"`
+	Title        string            `json:"title"`
+	Name         string            `json:"name"`
+	DashboardUID string            `json:"dashboardUid"`
+	Annotations  map[string]string `json:"annotations"`
+	Data         []struct {
+		DatasourceUID string `json:"datasourceUid"`
+	} `json:"data"`
+}
+
+type graphDatasource struct {
+	UID  string `json:"uid"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// expressionDatasources stand for the server-side expressions of an alert
+// rule rather than a datasource.
+var expressionDatasources = map[string]bool{"__expr__": true, "-100": true}
+
+func graphNodeID(kind, uid string) string {
+	return kind + ":" + uid
+}
+
+// graphBuilder collects nodes and edges, each once.
+type graphBuilder struct {
+	graph dependencyGraph
+	nodes map[string]int
+	edges map[graphEdge]bool
+}
+
+func newGraphBuilder() *graphBuilder {
+	return &graphBuilder{
+		graph: dependencyGraph{Nodes: []graphNode{}, Edges: []graphEdge{}, Errors: []string{}},
+		nodes: make(map[string]int),
+		edges: make(map[graphEdge]bool),
+	}
+}
+
+func (b *graphBuilder) addNode(kind, uid, name string) string {
+	id := graphNodeID(kind, uid)
+	if _, ok := b.nodes[id]; !ok {
+		if name == "" {
+			name = uid
+		}
+		b.nodes[id] = len(b.graph.Nodes)
+		b.graph.Nodes = append(b.graph.Nodes, graphNode{ID: id, Kind: kind, UID: uid, Name: name})
+	}
+	return id
+}
+
+// addEdge links from to the object kind:uid, which is added as missing when
+// nothing by that UID was listed.
+func (b *graphBuilder) addEdge(from, kind, uid, edgeKind string) {
+	to := graphNodeID(kind, uid)
+	if _, ok := b.nodes[to]; !ok {
+		b.addNode(kind, uid, "")
+		b.graph.Nodes[b.nodes[to]].Missing = true
+	}
+	edge := graphEdge{From: from, To: to, Kind: edgeKind}
+	if !b.edges[edge] {
+		b.edges[edge] = true
+		b.graph.Edges = append(b.graph.Edges, edge)
+	}
+}
+
+// buildDependencyGraph reads the dashboards, library panels and datasources
+// of the organization of ctx, and the alert rules when includeAlerts is set,
+// and links them by what they refer to. Objects that cannot be read are
+// reported in Errors and left out.
+func buildDependencyGraph(ctx context.Context, includeAlerts bool) dependencyGraph {
+	builder := newGraphBuilder()
+
+	// Datasources are listed first, so that references by name resolve to
+	// their UID. Without the list, every reference is trusted to exist.
+	datasourceUIDs := make(map[string]string)
+	datasources, err := fetchAPI[[]graphDatasource](ctx, currentConfig().GrafanaURL+"/api/datasources")
+	listedDatasources := err == nil
+	if err != nil {
+		builder.graph.Errors = append(builder.graph.Errors, fmt.Sprintf("Failed to list datasources: %v", err))
+	}
+	for _, datasource := range datasources {
+		builder.addNode(nodeDatasource, datasource.UID, datasource.Name)
+		datasourceUIDs[datasource.Name] = datasource.UID
+	}
+	addDatasourceEdges := func(from string, refs []datasourceRef) {
+		for _, ref := range refs {
+			uid := ref.UID
+			if uid == "" {
+				uid = ref.Name
+				if resolved, ok := datasourceUIDs[ref.Name]; ok {
+					uid = resolved
+				}
+			}
+			if !listedDatasources {
+				builder.addNode(nodeDatasource, uid, ref.Name)
+			}
+			builder.addEdge(from, nodeDatasource, uid, "queries")
+		}
+	}
+
+	dashboards, err := fetchAllDashboards(ctx)
+	if err != nil {
+		builder.graph.Errors = append(builder.graph.Errors, fmt.Sprintf("Failed to list dashboards: %v", err))
+	}
+	for _, dash := range dashboards {
+		builder.addNode(nodeDashboard, dash.UID, dash.Title)
+	}
+
+	libraries, err := fetchAllLibraryElements(ctx)
+	if err != nil && !isGrafanaNotFound(err) {
+		builder.graph.Errors = append(builder.graph.Errors, fmt.Sprintf("Failed to list library panels: %v", err))
+	}
+	for _, library := range libraries {
+		builder.addNode(nodeLibraryPanel, library.UID, library.Name)
+	}
+
+	dashboardRefs, errs := fetchReferences(ctx, dashboards, func(dash Dashboard) (string, string) {
+		return "dashboard:" + dash.UID, fmt.Sprintf("%s/api/dashboards/uid/%s", currentConfig().GrafanaURL, dash.UID)
+	})
+	builder.graph.Errors = append(builder.graph.Errors, errs...)
+	for i, dash := range dashboards {
+		from := graphNodeID(nodeDashboard, dash.UID)
+		for _, uid := range dashboardRefs[i].LibraryPanels {
+			builder.addEdge(from, nodeLibraryPanel, uid, "uses")
+		}
+		addDatasourceEdges(from, dashboardRefs[i].Datasources)
+		for _, uid := range dashboardRefs[i].DashboardLinks {
+			if uid != dash.UID {
+				builder.addEdge(from, nodeDashboard, uid, "links")
+			}
+		}
+	}
+
+	libraryRefs, errs := fetchReferences(ctx, libraries, func(library LibraryElement) (string, string) {
+		return "library:" + library.UID, fmt.Sprintf("%s/api/library-elements/%s", currentConfig().GrafanaURL, library.UID)
+	})
+	builder.graph.Errors = append(builder.graph.Errors, errs...)
+	for i, library := range libraries {
+		addDatasourceEdges(graphNodeID(nodeLibraryPanel, library.UID), libraryRefs[i].Datasources)
+	}
+
+	if includeAlerts {
+		var rules []graphAlertRule
+		if err := fetchAlertRules(ctx, "", &rules); err != nil {
+			builder.graph.Errors = append(builder.graph.Errors, fmt.Sprintf("Failed to list alert rules: %v", err))
+		}
+		for _, rule := range rules {
+			if rule.UID == "" {
+				continue
+			}
+			title := rule.Title
+			if title == "" {
+				title = rule.Name
+			}
+			from := builder.addNode(nodeAlertRule, rule.UID, title)
+
+			if dashboardUID := linkedDashboardUID(rule.DashboardUID, rule.Annotations); dashboardUID != "" {
+				builder.addEdge(from, nodeDashboard, dashboardUID, "alerts")
+			}
+			for _, query := range rule.Data {
+				if query.DatasourceUID != "" && !expressionDatasources[query.DatasourceUID] {
+					addDatasourceEdges(from, []datasourceRef{{UID: query.DatasourceUID}})
+				}
+			}
+		}
+	}
+
+	return builder.graph
+}
+
+// fetchReferences reads the model of every object and extracts what it
+// refers to, like fetchDashboardDetails with at most 10 requests at a time.
+// locate returns the cache key and URL of an object; the models of
+// dashboards are below "dashboard", those of library panels below "model".
+func fetchReferences[T any](ctx context.Context, objects []T, locate func(T) (string, string)) ([]dashboardReferences, []string) {
+	refs := make([]dashboardReferences, len(objects))
+	var errs []string
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, 10)
+
+	for i, object := range objects {
+		key, url := locate(object)
+		if cached, ok := metaCache.Get(cacheDashboardReferences, scopedCacheKey(ctx, key)); ok {
+			if cachedRefs, ok := cached.(dashboardReferences); ok {
+				refs[i] = cachedRefs
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			var response struct {
+				Dashboard map[string]interface{} `json:"dashboard"`
+				Result    struct {
+					Model map[string]interface{} `json:"model"`
+				} `json:"result"`
+			}
+			if err := fetchAPIRaw(ctx, url, &response); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Sprintf("Failed to fetch %s: %v", strings.Replace(key, ":", " ", 1), err))
+				mu.Unlock()
+				return
+			}
+
+			model := response.Dashboard
+			if model == nil {
+				model = response.Result.Model
+			}
+			refs[i] = extractReferences(model)
+			metaCache.Set(cacheDashboardReferences, scopedCacheKey(ctx, key), refs[i])
+		}()
+	}
+	wg.Wait()
+
+	slices.Sort(errs)
+	return refs, errs
+}
+
+// dependents returns the part of graph made of the node id and everything
+// that depends on it, directly or through other objects: what breaks when
+// the node is deleted.
+func (g dependencyGraph) dependents(id string) (dependencyGraph, bool) {
+	if !slices.ContainsFunc(g.Nodes, func(node graphNode) bool { return node.ID == id }) {
+		return dependencyGraph{}, false
+	}
+
+	reached := map[string]bool{id: true}
+	queue := []string{id}
+	for len(queue) > 0 {
+		target := queue[0]
+		queue = queue[1:]
+		for _, edge := range g.Edges {
+			if edge.To == target && !reached[edge.From] {
+				reached[edge.From] = true
+				queue = append(queue, edge.From)
+			}
+		}
+	}
+
+	subgraph := dependencyGraph{Nodes: []graphNode{}, Edges: []graphEdge{}, Errors: g.Errors}
+	for _, node := range g.Nodes {
+		if reached[node.ID] {
+			subgraph.Nodes = append(subgraph.Nodes, node)
+		}
+	}
+	for _, edge := range g.Edges {
+		if reached[edge.From] && reached[edge.To] {
+			subgraph.Edges = append(subgraph.Edges, edge)
+		}
+	}
+	return subgraph, true
+}
+
+// dotShapes tells the kinds of nodes apart in Graphviz.
+var dotShapes = map[string]string{
+	nodeDashboard:    "box",
+	nodeLibraryPanel: "component",
+	nodeDatasource:   "cylinder",
+	nodeAlertRule:    "hexagon",
+}
+
+// dot renders the graph in the Graphviz DOT language, edges pointing from
+// the dependent to what it depends on.
+func (g dependencyGraph) dot() string {
+	var b strings.Builder
+	b.WriteString("digraph dependencies {\n\trankdir=LR;\n")
+	for _, node := range g.Nodes {
+		style := ""
+		if node.Missing {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "\t%s [label=%s, shape=%s%s];\n", dotQuote(node.ID), dotQuote(node.Name), dotShapes[node.Kind], style)
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n", dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.Kind))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// getDependencyGraph serves the dependency graph of the organization as JSON,
+// or as Graphviz DOT with ?format=dot. ?dependents=<kind>:<uid> narrows it to
+// the objects depending on one object, and ?refresh=true reads every model
+// again. Refreshing empties the cache for everyone, so like flushing it only
+// admins may; alert rules are only included for admins, who alone may list
+// them.
+func getDependencyGraph(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	format := c.QueryParam("format")
+	if format != "" && format != "json" && format != "dot" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be json or dot"})
+	}
+	admin := hasRole(currentUser(c), roleAdmin)
+	if c.QueryParam("refresh") == "true" && admin {
+		metaCache.Invalidate(cacheDashboardSearch)
+		metaCache.Invalidate(cacheDashboardReferences)
+	}
+
+	graph := buildDependencyGraph(ctx, admin)
+	if id := c.QueryParam("dependents"); id != "" {
+		subgraph, ok := graph.dependents(id)
+		if !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("No object %s in the graph", id)})
+		}
+		graph = subgraph
+	}
+
+	if format == "dot" {
+		return c.Blob(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(graph.dot()))
+	}
+	return c.JSON(http.StatusOK, graph)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var graphTestRoutes = map[string]any{
+	"/api/datasources": `[{"uid":"prom-1","name":"Prometheus","type":"prometheus"},{"uid":"loki-1","name":"Loki","type":"loki"}]`,
+	"/api/search": `[
+		{"id":11,"uid":"service","title":"Service","type":"dash-db"},
+		{"id":12,"uid":"overview","title":"Overview","type":"dash-db"}
+	]`,
+	"/api/dashboards/uid/service": `{"dashboard":{"uid":"service","title":"Service","panels":[
+		{"type":"row","collapsed":true,"panels":[{"libraryPanel":{"uid":"lib-cpu"}}]},
+		{"datasource":{"type":"loki","uid":"loki-1"}},
+		{"datasource":{"type":"elasticsearch","uid":"deleted-ds"}}
+	]}}`,
+	// Links to the service dashboard and names its datasource like Grafana 7
+	"/api/dashboards/uid/overview": `{"dashboard":{"uid":"overview","title":"Overview","links":[{"url":"/d/service/service"}],"rows":[{"panels":[{"datasource":"Prometheus"}]}]}}`,
+	"/api/library-elements": `{"result":{"totalCount":2,"page":1,"perPage":100,"elements":[
+		{"uid":"lib-cpu","name":"CPU"},{"uid":"lib-unused","name":"Unused"}
+	]}}`,
+	"/api/library-elements/lib-cpu":    `{"result":{"uid":"lib-cpu","name":"CPU","model":{"datasource":{"type":"prometheus","uid":"prom-1"}}}}`,
+	"/api/library-elements/lib-unused": `{"result":{"uid":"lib-unused","name":"Unused","model":{}}}`,
+	"/api/v1/provisioning/alert-rules": `[{"uid":"rule-1","title":"High error rate",
+		"annotations":{"__dashboardUid__":"service","__panelId__":"2"},
+		"data":[{"datasourceUid":"loki-1"},{"datasourceUid":"__expr__"}]}]`,
+}
+
+func TestBuildDependencyGraph(t *testing.T) {
+	grafana := newFakeGrafana(graphTestRoutes)
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: grafana.URL}
+	metaCache = newMetadataCache(time.Minute)
+
+	graph := buildDependencyGraph(t.Context(), true)
+	assert.Empty(t, graph.Errors)
+	assert.ElementsMatch(t, []graphEdge{
+		{From: "dashboard:service", To: "library-panel:lib-cpu", Kind: "uses"},
+		{From: "dashboard:service", To: "datasource:loki-1", Kind: "queries"},
+		{From: "dashboard:service", To: "datasource:deleted-ds", Kind: "queries"},
+		{From: "dashboard:overview", To: "dashboard:service", Kind: "links"},
+		{From: "dashboard:overview", To: "datasource:prom-1", Kind: "queries"},
+		{From: "library-panel:lib-cpu", To: "datasource:prom-1", Kind: "queries"},
+		{From: "alert-rule:rule-1", To: "dashboard:service", Kind: "alerts"},
+		{From: "alert-rule:rule-1", To: "datasource:loki-1", Kind: "queries"},
+	}, graph.Edges)
+
+	names := make(map[string]string)
+	missing := []string{}
+	for _, node := range graph.Nodes {
+		names[node.ID] = node.Name
+		if node.Missing {
+			missing = append(missing, node.ID)
+		}
+	}
+	assert.Equal(t, "High error rate", names["alert-rule:rule-1"])
+	assert.Equal(t, "Prometheus", names["datasource:prom-1"])
+	assert.Contains(t, names, "library-panel:lib-unused")
+	assert.Equal(t, []string{"datasource:deleted-ds"}, missing)
+
+	// Everything that breaks without Prometheus, also through the library panel
+	dependents, ok := graph.dependents("datasource:prom-1")
+	assert.True(t, ok)
+	ids := []string{}
+	for _, node := range dependents.Nodes {
+		ids = append(ids, node.ID)
+	}
+	assert.ElementsMatch(t, []string{
+		"datasource:prom-1", "library-panel:lib-cpu", "dashboard:service", "dashboard:overview", "alert-rule:rule-1",
+	}, ids)
+
+	_, ok = graph.dependents("datasource:nope")
+	assert.False(t, ok)
+}
+
+func TestGetDependencyGraphHandler(t *testing.T) {
+	grafana := newFakeGrafana(graphTestRoutes)
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: grafana.URL}
+	metaCache = newMetadataCache(time.Minute)
+
+	e := echo.New()
+	e.GET("/api/graph", getDependencyGraph)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/graph?dependents=library-panel:lib-cpu", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var graph dependencyGraph
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &graph))
+	assert.Len(t, graph.Nodes, 4) // The panel, both dashboards and the alert rule
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/graph?format=dot&dependents=library-panel:lib-cpu", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), "text/vnd.graphviz"))
+	dot := rec.Body.String()
+	assert.True(t, strings.HasPrefix(dot, "digraph dependencies {"))
+	assert.Contains(t, dot, `"library-panel:lib-cpu" [label="CPU", shape=component];`)
+	assert.Contains(t, dot, `"dashboard:service" -> "library-panel:lib-cpu" [label="uses"];`)
+
+	for _, url := range []string{"/api/graph?format=svg", "/api/graph?dependents=dashboard:nope"} {
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.NotEqual(t, http.StatusOK, rec.Code, url)
+	}
+}
+
+func TestGraphRefreshNeedsAdmin(t *testing.T) {
+	grafana := newFakeGrafana(graphTestRoutes)
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	e, _ := newAuthTestServer(t, Config{
+		AuthBasicUsers: "viewer:pass,admin:pass",
+		AuthUserRoles:  "admin:admin",
+	})
+	e.GET("/api/graph", getDependencyGraph)
+	config = Config{GrafanaURL: grafana.URL}
+	metaCache = newMetadataCache(time.Minute)
+
+	request := func(user string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/graph?refresh=true", nil)
+		req.SetBasicAuth(user, "pass")
+		return serve(e, req).Code
+	}
+
+	// Another user's cached references survive a viewer's refresh
+	metaCache.Set(cacheDashboardReferences, "other-user|dashboard:service", dashboardReferences{})
+	assert.Equal(t, http.StatusOK, request("viewer"))
+	_, ok := metaCache.Get(cacheDashboardReferences, "other-user|dashboard:service")
+	assert.True(t, ok)
+
+	assert.Equal(t, http.StatusOK, request("admin"))
+	_, ok = metaCache.Get(cacheDashboardReferences, "other-user|dashboard:service")
+	assert.False(t, ok)
+}
+
+func TestDotQuote(t *testing.T) {
+	assert.Equal(t, `"say \"hi\"\\n"`, dotQuote(`say "hi"\n`))
+	assert.Equal(t, `"two\nlines"`, dotQuote("two\nlines"))
+}
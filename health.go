@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultHealthCheckInterval = 30 * time.Second
+	healthProbeTimeout         = 10 * time.Second
+)
+
+type permissionProbe struct {
+	path  string
+	needs string
+}
+
+// grafanaPermissionProbes are listed with the shared API key to find out
+// early which exports would fail for lack of permissions. Only endpoints the
+// Grafana version has are probed.
+func grafanaPermissionProbes(api grafanaAPI) []permissionProbe {
+	probes := []permissionProbe{
+		{"/api/search?type=dash-db&limit=1", "dashboards"},
+		{"/api/folders?limit=1", "folders"},
+	}
+	if api.LibraryElements() {
+		probes = append(probes, permissionProbe{"/api/library-elements?perPage=1", "library panels"})
+	}
+	// The URLs are built on the running Grafana URL, which a settings test
+	// does not use
+	alertRules := strings.TrimPrefix(api.AlertRuleURLs("")[0], currentConfig().GrafanaURL)
+	return append(probes, permissionProbe{alertRules, "alert rules"})
+}
+
+// grafanaStatus is the result of one health probe.
+type grafanaStatus struct {
+	Ready         bool      `json:"ready"`
+	CheckedAt     time.Time `json:"checkedAt"`
+	Reachable     bool      `json:"reachable"`
+	Database      string    `json:"database,omitempty"`
+	Version       string    `json:"version,omitempty"`
+	Authenticated bool      `json:"authenticated"`
+	Organization  string    `json:"organization,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Issues        []string  `json:"issues"` // Problems that do not make the exporter unready
+}
+
+// healthChecker probes Grafana in the background and keeps the last result
+// for /readyz and the UI's connection banner.
+type healthChecker struct {
+	interval time.Duration
+
+	mu     sync.RWMutex
+	status grafanaStatus
+}
+
+var health = newHealthChecker(defaultHealthCheckInterval)
+
+func newHealthChecker(interval time.Duration) *healthChecker {
+	return &healthChecker{
+		interval: interval,
+		status:   grafanaStatus{Error: "Grafana has not been checked yet", Issues: []string{}},
+	}
+}
+
+// Run probes Grafana immediately and then on every interval until ctx ends.
+func (h *healthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check probes Grafana once, stores and returns the result. Changes of
+// readiness are logged, so that an outage shows up in the logs once.
+func (h *healthChecker) Check(ctx context.Context) grafanaStatus {
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+
+	status := probeGrafana(ctx)
+
+	h.mu.Lock()
+	previous := h.status
+	h.status = status
+	h.mu.Unlock()
+
+	if status.Ready && !previous.Ready {
+		log.Printf("Grafana %s is ready", status.Version)
+	} else if !status.Ready && (previous.Ready || previous.CheckedAt.IsZero()) {
+		log.Printf("Warning: Grafana is not ready: %s", status.Error)
+	}
+	for _, issue := range status.Issues {
+		if !slices.Contains(previous.Issues, issue) {
+			log.Printf("Warning: %s", issue)
+		}
+	}
+
+	return status
+}
+
+func (h *healthChecker) Status() grafanaStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.status
+}
+
+// probeGrafana checks the Grafana the exporter is configured for and
+// remembers the version it reports.
+func probeGrafana(ctx context.Context) grafanaStatus {
+	status := checkGrafana(ctx, currentConfig())
+	rememberGrafanaVersion(status.Version)
+	return status
+}
+
+// checkGrafana checks whether cfg reaches a healthy Grafana that accepts its
+// API key and lets it read everything an export needs.
+func checkGrafana(ctx context.Context, cfg Config) grafanaStatus {
+	status := grafanaStatus{CheckedAt: time.Now().UTC(), Issues: []string{}}
+
+	code, body, err := probeGrafanaEndpoint(ctx, cfg, "/api/health", false)
+	if err != nil {
+		status.Error = fmt.Sprintf("Could not connect to Grafana: %v", err)
+		return status
+	}
+
+	var healthResponse struct {
+		Database string `json:"database"`
+		Version  string `json:"version"`
+	}
+	json.Unmarshal(body, &healthResponse)
+	status.Reachable = true
+	status.Database = healthResponse.Database
+	status.Version = healthResponse.Version
+
+	if code != http.StatusOK || (status.Database != "" && status.Database != "ok") {
+		status.Error = fmt.Sprintf("Grafana is unhealthy (status %d, database %q)", code, status.Database)
+		return status
+	}
+
+	if missing := grafanaAuthMissing(cfg); missing != "" {
+		if cfg.GrafanaCredentials == grafanaCredentialsUser {
+			// Users bring their own credentials, there is no key to validate
+			status.Ready = true
+			return status
+		}
+		status.Error = missing
+		return status
+	}
+
+	code, body, err = probeGrafanaEndpoint(ctx, cfg, "/api/org", true)
+	if err != nil {
+		status.Error = fmt.Sprintf("Could not validate the %s: %v", grafanaAuthName(cfg), err)
+		return status
+	}
+	if code != http.StatusOK {
+		status.Error = fmt.Sprintf("Grafana rejected the %s (status %d)", grafanaAuthName(cfg), code)
+		return status
+	}
+
+	var org struct {
+		Name string `json:"name"`
+	}
+	json.Unmarshal(body, &org)
+	status.Authenticated = true
+	status.Organization = org.Name
+	status.Ready = true
+
+	for _, probe := range grafanaPermissionProbes(currentGrafanaAPI()) {
+		code, _, err := probeGrafanaEndpoint(ctx, cfg, probe.path, true)
+		switch {
+		case err != nil:
+			status.Issues = append(status.Issues, fmt.Sprintf("Could not check access to %s: %v", probe.needs, err))
+		case code == http.StatusUnauthorized || code == http.StatusForbidden:
+			status.Issues = append(status.Issues, fmt.Sprintf("The %s cannot read %s (status %d)", grafanaAuthName(cfg), probe.needs, code))
+		}
+	}
+
+	return status
+}
+
+// probeGrafanaEndpoint requests a path of the Grafana in cfg, with its
+// credentials when authenticated, and returns the status code and body,
+// whatever the status.
+func probeGrafanaEndpoint(ctx context.Context, cfg Config, path string, authenticated bool) (int, []byte, error) {
+	client, err := grafanaClient(cfg)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	url := strings.TrimSuffix(cfg.GrafanaURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	if authenticated {
+		applyGrafanaAuth(req, cfg, 0)
+	} else {
+		applyGrafanaExtras(req, cfg)
+	}
+
+	resp, err := doGrafanaRequest(client, req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return resp.StatusCode, body, err
+}
+
+// getLiveness reports that the process is up; it does not depend on Grafana
+// so that an orchestrator does not restart the exporter during an outage.
+func getLiveness(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// getReadiness answers 200 when the last probe found Grafana usable and 503
+// otherwise. It needs no authentication, so the body only says whether
+// Grafana is ready and reachable; /api/grafana-status has the details.
+func getReadiness(c echo.Context) error {
+	status := health.Status()
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	return c.JSON(code, map[string]bool{"ready": status.Ready, "reachable": status.Reachable})
+}
+
+// getGrafanaStatus returns the result of the last probe: the Grafana version,
+// the organization of the key, the last error and permission issues.
+func getGrafanaStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, health.Status())
+}
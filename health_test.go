@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// healthTestRoutes serve a Grafana whose database is in the given state and
+// whose API key cannot read alert rules.
+func healthTestRoutes(database string) map[string]any {
+	return map[string]any{
+		"/api/health":                      `{"database":"` + database + `","version":"11.1.0"}`,
+		"/api/org":                         `{"id":1,"name":"Main Org."}`,
+		"/api/search":                      `[]`,
+		"/api/folders":                     `[]`,
+		"/api/library-elements":            `[]`,
+		"/api/v1/provisioning/alert-rules": http.StatusForbidden,
+	}
+}
+
+func TestProbeGrafana(t *testing.T) {
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	defer pinGrafanaVersion("")
+
+	grafana := newFakeGrafanaWithKey("good-key", healthTestRoutes("ok"))
+	defer grafana.Close()
+
+	config = Config{GrafanaURL: grafana.URL, GrafanaAPIKey: "good-key"}
+	status := probeGrafana(context.Background())
+	assert.True(t, status.Ready)
+	assert.True(t, status.Authenticated)
+	assert.Equal(t, "11.1.0", status.Version)
+	assert.Equal(t, "Main Org.", status.Organization)
+	assert.Len(t, status.Issues, 1)
+	assert.Contains(t, status.Issues[0], "alert rules")
+
+	config.GrafanaAPIKey = "bad-key"
+	status = probeGrafana(context.Background())
+	assert.False(t, status.Ready)
+	assert.True(t, status.Reachable)
+	assert.Contains(t, status.Error, "rejected the API key")
+
+	// Without a shared key, user credential mode only needs Grafana itself
+	config = Config{GrafanaURL: grafana.URL, GrafanaCredentials: grafanaCredentialsUser}
+	assert.True(t, probeGrafana(context.Background()).Ready)
+
+	config = Config{GrafanaURL: "http://localhost:1", GrafanaAPIKey: "good-key"}
+	status = probeGrafana(context.Background())
+	assert.False(t, status.Reachable)
+	assert.Contains(t, status.Error, "Could not connect")
+}
+
+func TestProbeGrafanaUnhealthyDatabase(t *testing.T) {
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	defer pinGrafanaVersion("")
+
+	grafana := newFakeGrafanaWithKey("good-key", healthTestRoutes("failing"))
+	defer grafana.Close()
+
+	config = Config{GrafanaURL: grafana.URL, GrafanaAPIKey: "good-key"}
+	status := probeGrafana(context.Background())
+	assert.False(t, status.Ready)
+	assert.Contains(t, status.Error, "database")
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	originalConfig := config
+	originalHealth := health
+	defer func() {
+		config = originalConfig
+		health = originalHealth
+		pinGrafanaVersion("")
+	}()
+
+	grafana := newFakeGrafanaWithKey("good-key", healthTestRoutes("ok"))
+	defer grafana.Close()
+
+	config = Config{GrafanaURL: grafana.URL, GrafanaAPIKey: "bad-key"}
+	health = newHealthChecker(time.Minute)
+
+	e := echo.New()
+	e.GET("/healthz", getLiveness)
+	e.GET("/readyz", getReadiness)
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	// Not ready before the first probe
+	assert.Equal(t, http.StatusServiceUnavailable, ready())
+
+	health.Check(context.Background())
+	assert.Equal(t, http.StatusServiceUnavailable, ready())
+
+	config.GrafanaAPIKey = "good-key"
+	health.Check(context.Background())
+	assert.Equal(t, http.StatusOK, ready())
+
+	// Anyone may ask whether the exporter is ready, but only signed-in users
+	// get the version, organization and issues
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.JSONEq(t, `{"ready":true,"reachable":true}`, rec.Body.String())
+
+	e.GET("/api/grafana-status", getGrafanaStatus)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/grafana-status", nil))
+	var status grafanaStatus
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.True(t, status.Ready)
+	assert.NotEmpty(t, status.Version)
+
+	// Liveness does not depend on Grafana
+	grafana.Close()
+	health.Check(context.Background())
+	assert.Equal(t, http.StatusServiceUnavailable, ready())
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
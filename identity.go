@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/labstack/echo/v4"
+)
+
+// identityDirectory is the section of an export holding teams, users and
+// service accounts.
+const identityDirectory = "Identity"
+
+// exportedTeam is a team with its members, identified by name and login so
+// that it can be recreated on another Grafana.
+type exportedTeam struct {
+	Name    string               `json:"name"`
+	Email   string               `json:"email,omitempty"`
+	Members []exportedTeamMember `json:"members"`
+}
+
+type exportedTeamMember struct {
+	Login string `json:"login"`
+	Email string `json:"email,omitempty"`
+	Admin bool   `json:"admin,omitempty"`
+}
+
+// exportedUser is a user of the organization; credentials are never part
+// of Grafana's answer, and neither of the export.
+type exportedUser struct {
+	Login      string `json:"login"`
+	Email      string `json:"email,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Role       string `json:"role"`
+	Disabled   bool   `json:"disabled,omitempty"`
+	LastSeenAt string `json:"lastSeenAt,omitempty"`
+}
+
+// exportedServiceAccount is a service account without its tokens; Tokens
+// only counts them.
+type exportedServiceAccount struct {
+	Name     string `json:"name"`
+	Login    string `json:"login"`
+	Role     string `json:"role"`
+	Disabled bool   `json:"disabled,omitempty"`
+	Tokens   int    `json:"tokens"`
+}
+
+// identitySnapshot is the identity side of a Grafana organization.
+type identitySnapshot struct {
+	Teams           []exportedTeam           `json:"teams"`
+	Users           []exportedUser           `json:"users"`
+	ServiceAccounts []exportedServiceAccount `json:"serviceAccounts"`
+	Errors          []string                 `json:"errors,omitempty"`
+}
+
+// getIdentity lists the teams, users and service accounts of the organization.
+func getIdentity(c echo.Context) error {
+	return c.JSON(http.StatusOK, fetchIdentity(c.Request().Context()))
+}
+
+// fetchIdentity reads teams with their members, users with their roles and
+// service accounts. Parts the credentials may not read are reported in
+// Errors rather than failing the rest.
+func fetchIdentity(ctx context.Context) identitySnapshot {
+	snapshot := identitySnapshot{
+		Teams:           []exportedTeam{},
+		Users:           []exportedUser{},
+		ServiceAccounts: []exportedServiceAccount{},
+	}
+
+	teams, err := fetchTeams(ctx)
+	if err != nil {
+		snapshot.Errors = append(snapshot.Errors, fmt.Sprintf("Failed to fetch teams: %v", err))
+	}
+	snapshot.Teams = append(snapshot.Teams, teams...)
+
+	var users []struct {
+		Login      string `json:"login"`
+		Email      string `json:"email"`
+		Name       string `json:"name"`
+		Role       string `json:"role"`
+		IsDisabled bool   `json:"isDisabled"`
+		LastSeenAt string `json:"lastSeenAt"`
+	}
+	if err := fetchAPIRaw(ctx, currentConfig().GrafanaURL+"/api/org/users", &users); err != nil {
+		snapshot.Errors = append(snapshot.Errors, fmt.Sprintf("Failed to fetch users: %v", err))
+	}
+	for _, user := range users {
+		snapshot.Users = append(snapshot.Users, exportedUser{
+			Login:      user.Login,
+			Email:      user.Email,
+			Name:       user.Name,
+			Role:       user.Role,
+			Disabled:   user.IsDisabled,
+			LastSeenAt: user.LastSeenAt,
+		})
+	}
+
+	if currentGrafanaAPI().ServiceAccounts() {
+		accounts, err := fetchServiceAccounts(ctx)
+		if err != nil {
+			snapshot.Errors = append(snapshot.Errors, fmt.Sprintf("Failed to fetch service accounts: %v", err))
+		}
+		snapshot.ServiceAccounts = append(snapshot.ServiceAccounts, accounts...)
+	}
+
+	return snapshot
+}
+
+func fetchTeams(ctx context.Context) ([]exportedTeam, error) {
+	var teams []struct {
+		ID    int    `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	if err := fetchSearchPages(ctx, "/api/teams/search", "teams", &teams); err != nil {
+		return nil, err
+	}
+
+	result := make([]exportedTeam, 0, len(teams))
+	for _, team := range teams {
+		var members []struct {
+			Login      string `json:"login"`
+			Email      string `json:"email"`
+			Permission int    `json:"permission"`
+		}
+		url := fmt.Sprintf("%s/api/teams/%d/members", currentConfig().GrafanaURL, team.ID)
+		if err := fetchAPIRaw(ctx, url, &members); err != nil {
+			return result, fmt.Errorf("members of team %s: %v", team.Name, err)
+		}
+
+		exported := exportedTeam{Name: team.Name, Email: team.Email, Members: []exportedTeamMember{}}
+		for _, member := range members {
+			exported.Members = append(exported.Members, exportedTeamMember{
+				Login: member.Login,
+				Email: member.Email,
+				Admin: member.Permission == 4,
+			})
+		}
+		result = append(result, exported)
+	}
+	return result, nil
+}
+
+func fetchServiceAccounts(ctx context.Context) ([]exportedServiceAccount, error) {
+	var accounts []struct {
+		Name       string `json:"name"`
+		Login      string `json:"login"`
+		Role       string `json:"role"`
+		IsDisabled bool   `json:"isDisabled"`
+		Tokens     int    `json:"tokens"`
+	}
+	if err := fetchSearchPages(ctx, "/api/serviceaccounts/search", "serviceAccounts", &accounts); err != nil {
+		return nil, err
+	}
+
+	result := make([]exportedServiceAccount, 0, len(accounts))
+	for _, account := range accounts {
+		result = append(result, exportedServiceAccount{
+			Name:     account.Name,
+			Login:    account.Login,
+			Role:     account.Role,
+			Disabled: account.IsDisabled,
+			Tokens:   account.Tokens,
+		})
+	}
+	return result, nil
+}
+
+// fetchSearchPages walks a Grafana search endpoint that pages with
+// perpage/page and answers {"totalCount": n, "<field>": [...]}, appending
+// the items of every page to target, a pointer to a slice.
+func fetchSearchPages[T any](ctx context.Context, path, field string, target *[]T) error {
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s%s?perpage=%d&page=%d", currentConfig().GrafanaURL, path, identityPerPage, page)
+
+		var response map[string]json.RawMessage
+		if err := fetchAPIRaw(ctx, url, &response); err != nil {
+			return err
+		}
+		var totalCount int
+		json.Unmarshal(response["totalCount"], &totalCount)
+		var items []T
+		if raw, ok := response[field]; ok {
+			if err := json.Unmarshal(raw, &items); err != nil {
+				return fmt.Errorf("JSON decode error on page %d: %v", page, err)
+			}
+		}
+
+		*target = append(*target, items...)
+		if len(items) == 0 || len(*target) >= totalCount {
+			return nil
+		}
+	}
+}
+
+// exportIdentity writes the identity snapshot of the organization of ctx to
+// the Identity/ section below exportPath.
+func exportIdentity(ctx context.Context, exportPath string, result *exportResult) {
+	snapshot := fetchIdentity(ctx)
+	result.Errors = append(result.Errors, snapshot.Errors...)
+
+	dir := filepath.Join(exportPath, identityDirectory)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to create identity folder: %v", err))
+		return
+	}
+
+	for name, records := range map[string]interface{}{
+		"teams.json":            snapshot.Teams,
+		"users.json":            snapshot.Users,
+		"service-accounts.json": snapshot.ServiceAccounts,
+	} {
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, name), data, 0644)
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to write %s: %v", name, err))
+		}
+	}
+	result.ExportedIdentities += len(snapshot.Teams) + len(snapshot.Users) + len(snapshot.ServiceAccounts)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var identityTestRoutes = map[string]any{
+	// Two pages of one team each
+	"/api/teams/search?page=1":    `{"totalCount":2,"teams":[{"id":1,"name":"SRE","email":"sre@example.com"}]}`,
+	"/api/teams/search?page=2":    `{"totalCount":2,"teams":[{"id":2,"name":"Dev"}]}`,
+	"/api/teams/1/members":        `[{"userId":3,"login":"alice","email":"alice@example.com","permission":4},{"userId":4,"login":"bob","permission":0}]`,
+	"/api/teams/2/members":        `[]`,
+	"/api/org/users":              `[{"userId":3,"login":"alice","email":"alice@example.com","role":"Admin","lastSeenAt":"2026-10-01T00:00:00Z"},{"userId":4,"login":"bob","role":"Viewer","isDisabled":true}]`,
+	"/api/serviceaccounts/search": `{"totalCount":1,"serviceAccounts":[{"id":9,"name":"backup","login":"sa-backup","role":"Viewer","tokens":2}]}`,
+}
+
+func TestFetchIdentity(t *testing.T) {
+	grafana := newFakeGrafana(identityTestRoutes)
+	defer grafana.Close()
+
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	config = Config{GrafanaURL: grafana.URL}
+
+	snapshot := fetchIdentity(t.Context())
+	assert.Empty(t, snapshot.Errors)
+	assert.Equal(t, []exportedTeam{
+		{Name: "SRE", Email: "sre@example.com", Members: []exportedTeamMember{
+			{Login: "alice", Email: "alice@example.com", Admin: true},
+			{Login: "bob"},
+		}},
+		{Name: "Dev", Members: []exportedTeamMember{}},
+	}, snapshot.Teams)
+	assert.Equal(t, []exportedUser{
+		{Login: "alice", Email: "alice@example.com", Role: "Admin", LastSeenAt: "2026-10-01T00:00:00Z"},
+		{Login: "bob", Role: "Viewer", Disabled: true},
+	}, snapshot.Users)
+	assert.Equal(t, []exportedServiceAccount{{Name: "backup", Login: "sa-backup", Role: "Viewer", Tokens: 2}}, snapshot.ServiceAccounts)
+}
+
+func TestFetchIdentityReportsUnreadableParts(t *testing.T) {
+	grafana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/org/users" {
+			w.Write([]byte(`[{"login":"alice","role":"Viewer"}]`))
+			return
+		}
+		http.Error(w, `{"message":"Permission denied"}`, http.StatusForbidden)
+	}))
+	defer grafana.Close()
+
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	config = Config{GrafanaURL: grafana.URL}
+
+	snapshot := fetchIdentity(t.Context())
+	assert.Len(t, snapshot.Errors, 2)
+	assert.Len(t, snapshot.Users, 1)
+	assert.Empty(t, snapshot.Teams)
+}
+
+func TestExportIdentity(t *testing.T) {
+	grafana := newFakeGrafana(identityTestRoutes)
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: grafana.URL, ExportDirectory: t.TempDir()}
+	metaCache = newMetadataCache(time.Minute)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(`{"includeIdentity":true}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, exportDashboards(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var result exportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 5, result.ExportedIdentities)
+
+	for _, name := range []string{"teams.json", "users.json", "service-accounts.json"} {
+		assert.FileExists(t, filepath.Join(result.ExportPath, identityDirectory, name))
+	}
+	users, _ := os.ReadFile(filepath.Join(result.ExportPath, identityDirectory, "users.json"))
+	assert.NotContains(t, string(users), "password")
+}
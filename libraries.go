@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// libraryPanelsDirectory holds the library elements exported on their own,
+// rather than next to a dashboard that uses them.
+const libraryPanelsDirectory = "Library panels"
+
+// libraryConnection links a library element to a dashboard using it. Grafana
+// 10 and later name the dashboard by UID, older versions only by ID.
+type libraryConnection struct {
+	ConnectionID  int    `json:"connectionId"`
+	ConnectionUID string `json:"connectionUid"`
+}
+
+type libraryConnectionsResponse struct {
+	Result []libraryConnection `json:"result"`
+}
+
+func fetchLibraryConnections(ctx context.Context, uid string) ([]libraryConnection, error) {
+	url := fmt.Sprintf("%s/api/library-elements/%s/connections", currentConfig().GrafanaURL, uid)
+	response, err := fetchAPI[libraryConnectionsResponse](ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return response.Result, nil
+}
+
+// describeLibraryElements fills in the folder title and the number of
+// dashboards using each element. The count comes with the listing from
+// Grafana 8.3; older versions are asked for the connections of each element.
+func describeLibraryElements(ctx context.Context, elements []LibraryElement) {
+	for i := range elements {
+		element := &elements[i]
+
+		switch {
+		case element.FolderID == 0 && element.FolderUID == "":
+			element.FolderTitle = "General"
+		case element.Meta.FolderName != "":
+			element.FolderTitle = element.Meta.FolderName
+		default:
+			if title, err := lookupFolderTitle(ctx, element.FolderUID); err == nil {
+				element.FolderTitle = title
+			} else {
+				element.FolderTitle = fmt.Sprintf("Folder ID %d", element.FolderID)
+			}
+		}
+
+		if element.Meta.ConnectedDashboards != nil {
+			usedBy := *element.Meta.ConnectedDashboards
+			element.UsedBy = &usedBy
+			continue
+		}
+		connections, err := fetchLibraryConnections(ctx, element.UID)
+		if err != nil {
+			log.Printf("Warning: Could not fetch connections of library element %s: %v", element.UID, err)
+			continue
+		}
+		usedBy := len(connections)
+		element.UsedBy = &usedBy
+	}
+}
+
+// filterLibraryElements keeps the elements whose name contains search,
+// ignoring case, and only those no dashboard uses when unused is set.
+func filterLibraryElements(elements []LibraryElement, search string, unused bool) []LibraryElement {
+	search = strings.ToLower(strings.TrimSpace(search))
+	if search == "" && !unused {
+		return elements
+	}
+
+	filtered := make([]LibraryElement, 0, len(elements))
+	for _, element := range elements {
+		if search != "" && !strings.Contains(strings.ToLower(element.Name), search) {
+			continue
+		}
+		if unused && (element.UsedBy == nil || *element.UsedBy > 0) {
+			continue
+		}
+		filtered = append(filtered, element)
+	}
+	return filtered
+}
+
+// getLibraryConnections lists the dashboards using a library element.
+func getLibraryConnections(c echo.Context) error {
+	ctx := c.Request().Context()
+	uid := c.Param("uid")
+
+	connections, err := fetchLibraryConnections(ctx, uid)
+	if err != nil {
+		if isGrafanaNotFound(err) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("Library element %s not found", uid)})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	dashboards, err := fetchAllDashboards(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	byID := make(map[int]Dashboard, len(dashboards))
+	byUID := make(map[string]Dashboard, len(dashboards))
+	for _, dash := range dashboards {
+		byID[dash.ID] = dash
+		byUID[dash.UID] = dash
+	}
+
+	connected := make([]Dashboard, 0, len(connections))
+	for _, connection := range connections {
+		dash, ok := byUID[connection.ConnectionUID]
+		if !ok {
+			dash, ok = byID[connection.ConnectionID]
+		}
+		if !ok {
+			// Not visible to the exporter's credentials
+			dash = Dashboard{ID: connection.ConnectionID, UID: connection.ConnectionUID}
+		}
+		connected = append(connected, dash)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"dashboards": connected})
+}
+
+// exportLibraryElements writes the given library elements below
+// exportPath/Library panels, grouped by folder, whether or not a dashboard
+// uses them. Elements in exported are skipped.
+func exportLibraryElements(ctx context.Context, exportPath string, uids []string, exported map[string]bool, result *exportResult) {
+	librariesPath, err := safePath(exportPath, libraryPanelsDirectory)
+	if err == nil {
+		err = os.MkdirAll(librariesPath, os.ModePerm)
+	}
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to create library panels folder: %v", err))
+		return
+	}
+
+	for _, uid := range uids {
+		if exported[uid] {
+			continue
+		}
+		if err := exportLibraryElement(ctx, uid, librariesPath, &result.ExportedLibraries, &result.Errors); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		exported[uid] = true
+	}
+}
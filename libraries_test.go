@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var librariesTestRoutes = map[string]any{
+	"/api/search":           `[{"id":11,"uid":"dash-1","title":"Service","type":"dash-db"},{"id":12,"uid":"dash-2","title":"Database","type":"dash-db"}]`,
+	"/api/folders/folder-1": `{"id":5,"uid":"folder-1","title":"Platform"}`,
+	"/api/library-elements": `{"result":{"totalCount":3,"page":1,"perPage":100,"elements":[
+		{"id":1,"uid":"lib-cpu","name":"CPU usage","kind":1,"folderId":0,"meta":{"connectedDashboards":2}},
+		{"id":2,"uid":"lib-errors","name":"Error rate","kind":1,"folderId":5,"folderUid":"folder-1","meta":{"folderName":"Platform","connectedDashboards":0}},
+		{"id":3,"uid":"lib-old","name":"Old CPU","kind":1,"folderId":5,"folderUid":"folder-1","meta":{}}
+	]}}`,
+	// Grafana 10 names the dashboard by UID, older versions by ID only
+	"/api/library-elements/lib-cpu/connections": `{"result":[{"id":1,"kind":1,"elementId":1,"connectionId":11,"connectionUid":"dash-1"},{"id":2,"kind":1,"elementId":1,"connectionId":12}]}`,
+	"/api/library-elements/lib-old/connections": `{"result":[]}`,
+	"/api/library-elements/lib-errors":          `{"result":{"id":2,"uid":"lib-errors","name":"Error rate","kind":1,"folderId":5,"folderUid":"folder-1","model":{"type":"timeseries"}}}`,
+}
+
+func TestGetLibrariesDescribesElements(t *testing.T) {
+	grafana := newFakeGrafana(librariesTestRoutes)
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: grafana.URL}
+	metaCache = newMetadataCache(time.Minute)
+
+	e := echo.New()
+	e.GET("/api/libraries", getLibraries)
+
+	get := func(url string) []LibraryElement {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var response LibraryElementsResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		return response.Result.Elements
+	}
+
+	elements := get("/api/libraries")
+	assert.Len(t, elements, 3)
+	usedBy := make(map[string]int)
+	folders := make(map[string]string)
+	for _, element := range elements {
+		if assert.NotNil(t, element.UsedBy, element.UID) {
+			usedBy[element.UID] = *element.UsedBy
+		}
+		folders[element.UID] = element.FolderTitle
+	}
+	assert.Equal(t, map[string]int{"lib-cpu": 2, "lib-errors": 0, "lib-old": 0}, usedBy)
+	assert.Equal(t, map[string]string{"lib-cpu": "General", "lib-errors": "Platform", "lib-old": "Platform"}, folders)
+
+	names := func(elements []LibraryElement) []string {
+		result := []string{}
+		for _, element := range elements {
+			result = append(result, element.Name)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"CPU usage", "Old CPU"}, names(get("/api/libraries?search=cpu")))
+	assert.Equal(t, []string{"Error rate", "Old CPU"}, names(get("/api/libraries?unused=true")))
+}
+
+func TestGetLibraryConnections(t *testing.T) {
+	grafana := newFakeGrafana(librariesTestRoutes)
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: grafana.URL}
+	metaCache = newMetadataCache(time.Minute)
+
+	e := echo.New()
+	e.GET("/api/libraries/:uid/connections", getLibraryConnections)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/libraries/lib-cpu/connections", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response struct {
+		Dashboards []Dashboard `json:"dashboards"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	if assert.Len(t, response.Dashboards, 2) {
+		assert.Equal(t, "Service", response.Dashboards[0].Title)
+		assert.Equal(t, "dash-2", response.Dashboards[1].UID)
+		assert.Equal(t, "Database", response.Dashboards[1].Title)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/libraries/missing/connections", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestExportLibraryElementsOnTheirOwn(t *testing.T) {
+	grafana := newFakeGrafana(librariesTestRoutes)
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: grafana.URL, ExportDirectory: t.TempDir()}
+	metaCache = newMetadataCache(time.Minute)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(`{"libraryUIDs":["lib-errors"]}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, exportDashboards(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var result exportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 1, result.ExportedLibraries)
+
+	data, err := os.ReadFile(filepath.Join(result.ExportPath, libraryPanelsDirectory, "Platform", "Error rate.json"))
+	assert.NoError(t, err)
+	var library map[string]interface{}
+	json.Unmarshal(data, &library)
+	assert.Equal(t, "lib-errors", library["uid"])
+	assert.Equal(t, map[string]interface{}{"type": "timeseries"}, library["model"])
+}
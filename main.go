@@ -2,9 +2,10 @@ package main
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -17,7 +18,6 @@ import (
 	"time"
 
 	"github.com/alexmullins/zip"
-	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
@@ -26,14 +26,49 @@ import (
 var publicFS embed.FS
 
 type Config struct {
-	GrafanaURL           string
-	GrafanaAPIKey        string
-	ExportDirectory      string
-	ServerHost           string
-	ServerPort           string
-	SkipTLSVerify        bool
-	GrafanaVersion       float64 // Add this field
-	ForceEnableZipExport bool    // Force enable "Export as ZIP" checkbox
+	GrafanaURL             string
+	GrafanaAPIKey          string
+	GrafanaAuth            string // How Grafana is authenticated: bearer, basic or proxy
+	GrafanaUsername        string
+	GrafanaPassword        string
+	GrafanaAuthProxyUser   string // User sent to Grafana's auth proxy
+	GrafanaAuthProxyHeader string // Header Grafana's auth proxy reads the user from
+	GrafanaOrgAPIKeys      string // orgId:token, comma separated; service account tokens per organization
+	GrafanaHeaders         string // Name: value, comma separated; sent with every request
+	GrafanaCookies         string // name=value; ...; sent with every request
+	ExportDirectory        string
+	ServerHost             string
+	ServerPort             string
+	SkipTLSVerify          bool
+	GrafanaCACert          string        // PEM CA bundles trusted for Grafana, comma separated
+	GrafanaClientCert      string        // Client certificate for mutual TLS
+	GrafanaClientKey       string        // Key of the client certificate
+	GrafanaTLSServerName   string        // Name the Grafana certificate is verified against
+	GrafanaTLSMinVersion   string        // Lowest TLS version accepted: 1.0 to 1.3
+	GrafanaVersion         string        // Pins the Grafana version, e.g. "10.4"; empty detects it
+	ForceEnableZipExport   bool          // Force enable "Export as ZIP" checkbox
+	CacheTTL               time.Duration // How long folder and dashboard metadata stays cached
+	AuditLogFile           string        // JSON-lines audit log of exports; empty disables it
+	HealthCheckInterval    time.Duration // How often Grafana is probed for /readyz
+
+	// Authentication for the exporter's own UI and API
+	AuthBasicUsers     string // user:password or user:bcrypt-hash, comma separated
+	AuthBearerTokens   string // name:token, comma separated
+	OIDCIssuerURL      string
+	OIDCClientID       string
+	OIDCClientSecret   string
+	OIDCRedirectURL    string
+	OIDCScopes         string
+	SessionTTL         time.Duration
+	AuthUserRoles      string // user:role, comma separated
+	AuthGroupRoles     string // IdP group:role, comma separated
+	AuthDefaultRole    string // Role of authenticated users without a mapping
+	CORSAllowedOrigins string // Comma separated; empty disables cross-origin access
+	TrustedProxies     string // IPs or CIDR ranges whose X-Forwarded-For is believed, comma separated
+
+	// Whose credentials Grafana is called with: shared (GRAFANA_API_KEY) or user
+	GrafanaCredentials string
+	OIDCGrafanaToken   string // OIDC token forwarded to Grafana: access_token or id_token
 }
 
 type Dashboard struct {
@@ -52,6 +87,8 @@ type Dashboard struct {
 
 type DashboardResponse struct {
 	Dashboards []Dashboard `json:"dashboards"`
+	Total      int         `json:"total"`
+	Pending    int         `json:"pending"` // Dashboards whose timestamps are still being fetched
 }
 
 type Folder struct {
@@ -76,16 +113,32 @@ type Folder struct {
 type FolderResponse []Folder
 
 type LibraryElement struct {
-	ID        int    `json:"id"`
-	UID       string `json:"uid"`
-	Name      string `json:"name"`
-	Kind      int    `json:"kind"`
-	FolderID  int    `json:"folderId"`
-	FolderUID string `json:"folderUid"`
+	ID          int                `json:"id"`
+	UID         string             `json:"uid"`
+	Name        string             `json:"name"`
+	Kind        int                `json:"kind"`
+	FolderID    int                `json:"folderId"`
+	FolderUID   string             `json:"folderUid"`
+	FolderTitle string             `json:"folderTitle,omitempty"`
+	UsedBy      *int               `json:"usedBy,omitempty"` // Dashboards using the element; nil when unknown
+	Meta        libraryElementMeta `json:"meta"`
+}
+
+type libraryElementMeta struct {
+	FolderName          string `json:"folderName,omitempty"`
+	ConnectedDashboards *int   `json:"connectedDashboards,omitempty"`
+	Updated             string `json:"updated,omitempty"`
 }
 
 type LibraryElementsResponse struct {
-	Result []LibraryElement `json:"result"`
+	Result LibraryElementsPage `json:"result"`
+}
+
+type LibraryElementsPage struct {
+	TotalCount int              `json:"totalCount"`
+	Page       int              `json:"page"`
+	PerPage    int              `json:"perPage"`
+	Elements   []LibraryElement `json:"elements"`
 }
 
 type DashboardWithMeta struct {
@@ -114,42 +167,106 @@ type LibraryElementWithMeta struct {
 }
 
 type Alert struct {
-	ID          int    `json:"id"`
-	UID         string `json:"uid"`
-	Title       string `json:"title"`
-	FolderID    int    `json:"folderId"`
-	FolderUID   string `json:"folderUid,omitempty"`
-	FolderTitle string `json:"folderTitle,omitempty"`
+	ID             int               `json:"id"`
+	UID            string            `json:"uid"`
+	Title          string            `json:"title"`
+	FolderID       int               `json:"folderId"`
+	FolderUID      string            `json:"folderUid,omitempty"`
+	FolderTitle    string            `json:"folderTitle,omitempty"`
+	DashboardUID   string            `json:"dashboardUid,omitempty"` // Set by legacy alerting, or from Annotations
+	DashboardTitle string            `json:"dashboardTitle,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty"`
 }
 
 type AlertResponse struct {
 	Alerts []Alert `json:"alerts"`
 }
 
+// Page sizes used when walking Grafana's paginated listing endpoints.
+const (
+	folderPageLimit        = 1000
+	searchPageLimit        = 5000
+	libraryElementsPerPage = 100
+	identityPerPage        = 1000
+)
+
 var config Config
-var folderCache map[string]string
 
 func main() {
 	initializationError := initialize()
+	cfg := currentConfig()
+
+	health = newHealthChecker(cfg.HealthCheckInterval)
+	go health.Run(context.Background())
+	go watchConfig(context.Background(), configWatchInterval)
+
+	auth, err := newAuthenticator(cfg)
+	if err != nil {
+		log.Fatalf("Invalid authentication settings: %v", err)
+	}
+	if !auth.Enabled() {
+		log.Println("Warning: authentication is disabled, anyone who can reach the server can export from Grafana")
+	}
 
 	e := echo.New()
+	e.IPExtractor = clientIPExtractor(cfg)
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
-
-	e.GET("/api/folders", getFolders)
-	e.GET("/api/dashboards", getDashboards)
-	e.GET("/api/libraries", getLibraries)
-	e.GET("/api/alerts", getAlerts)
-	e.POST("/api/export", exportDashboards)
+	e.Use(corsMiddleware(cfg))
+	e.Use(auth.Middleware())
+	e.Use(grafanaOrgMiddleware)
+
+	auth.RegisterRoutes(e)
+
+	viewer := requireRole(roleViewer)
+	exporter := requireRole(roleExporter)
+	admin := requireRole(roleAdmin)
+
+	e.GET("/api/orgs", getOrganizations, viewer)
+	e.GET("/api/folders", getFolders, viewer)
+	e.GET("/api/dashboards", getDashboards, viewer)
+	e.GET("/api/dashboards/updates", streamDashboardUpdates, viewer)
+	e.GET("/api/dashboards/:uid/versions", getDashboardVersions, viewer)
+	e.GET("/api/dashboards/:uid/versions/diff", diffDashboardVersions, exporter)
+	e.GET("/api/dashboards/:uid/versions/:version", getDashboardVersion, exporter)
+	e.POST("/api/dashboards/:uid/versions/:version/restore", restoreDashboardVersion, admin)
+	e.GET("/api/libraries", getLibraries, viewer)
+	e.GET("/api/libraries/:uid/connections", getLibraryConnections, viewer)
+	e.GET("/api/graph", getDependencyGraph, viewer)
+	e.GET("/api/grafana-status", getGrafanaStatus, viewer)
+	e.GET("/api/alerts", getAlerts, admin)
+	e.GET("/api/identity", getIdentity, admin)
+	e.POST("/api/annotations/import", importAnnotations, admin)
+	for _, kind := range objectKinds {
+		e.GET("/api/"+kind.Name, kind.objectsHandler, requireRole(kind.role()))
+	}
+	e.POST("/api/export", exportDashboards, exporter)
+	e.GET("/api/cache", getCacheStatus, admin)
+	e.DELETE("/api/cache", flushCache, admin)
+	e.GET("/api/audit", getAuditLog, admin)
+	e.GET("/api/settings", getSettings, admin)
+	e.PUT("/api/settings", saveSettings, admin)
+	e.POST("/api/settings/test", testSettings, admin)
+	e.GET("/metrics", getMetrics)
+	e.GET("/healthz", getLiveness)
+	e.GET("/readyz", getReadiness)
 
 	e.GET(
 		"/api/config-status", func(c echo.Context) error {
+			status := currentConfigStatus()
+			// Settings saved from the UI configure a server started without any
+			needsSetup := initializationError != nil && !status.Configured
+			errorMessage := ""
+			if needsSetup {
+				errorMessage = getInitErrorMessage(initializationError)
+			}
 			return c.JSON(
 				http.StatusOK, map[string]interface{}{
-					"hasEnvFile":           initializationError == nil,
-					"errorMessage":         getInitErrorMessage(initializationError),
-					"forceEnableZipExport": config.ForceEnableZipExport,
+					"hasEnvFile":           !needsSetup,
+					"errorMessage":         errorMessage,
+					"forceEnableZipExport": currentConfig().ForceEnableZipExport,
+					"authEnabled":          auth.Enabled(),
+					"config":               status,
 				},
 			)
 		},
@@ -157,40 +274,65 @@ func main() {
 
 	setupStaticFiles(e)
 
-	log.Printf("Server started on http://%s:%s", config.ServerHost, config.ServerPort)
-	e.Logger.Fatal(e.Start(config.ServerHost + ":" + config.ServerPort))
+	log.Printf("Server started on http://%s:%s", cfg.ServerHost, cfg.ServerPort)
+	e.Logger.Fatal(e.Start(cfg.ServerHost + ":" + cfg.ServerPort))
 }
 
 func initialize() error {
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning: .env file not found, using environment variables")
+	loaded := loadConfig()
+	if err := startConfig(loaded); err != nil {
+		log.Fatalf("%v", err)
 	}
+	cfg := loaded.Config
 
-	config = Config{
-		GrafanaURL:           getEnv("GRAFANA_URL", "http://localhost:3000"),
-		GrafanaAPIKey:        getEnv("GRAFANA_API_KEY", ""),
-		ExportDirectory:      getEnv("EXPORT_DIRECTORY", "./exported"),
-		ServerHost:           getEnv("SERVER_HOST", "127.0.0.1"),
-		ServerPort:           getEnv("SERVER_PORT", "8080"),
-		SkipTLSVerify:        getEnvBool("SKIP_TLS_VERIFY", false),
-		GrafanaVersion:       getEnvFloat("GRAFANA_VERSION", 11.1),
-		ForceEnableZipExport: getEnvBool("FORCE_ENABLE_ZIP_EXPORT", false),
+	var initErr error
+	if !loaded.HasEnvFile {
+		log.Println("Warning: .env file not found, using environment variables")
+		if !loaded.Configured {
+			// Nothing configures the exporter; the UI explains how to fix this
+			initErr = fmt.Errorf("missing .env file: %s not found and GRAFANA_URL is not set", envFilePath)
+		}
+	}
+	if loaded.File != "" {
+		log.Printf("Config file: %s", loaded.File)
 	}
 
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(cfg.CacheTTL)
+
+	if cfg.AuditLogFile == "" {
+		log.Println("Warning: audit log is disabled")
+	} else {
+		logger, err := openAuditLog(cfg.AuditLogFile)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		auditLogger = logger
+		log.Printf("Audit log: %s", cfg.AuditLogFile)
+	}
 
-	if err := os.MkdirAll(config.ExportDirectory, os.ModePerm); err != nil {
+	if err := os.MkdirAll(cfg.ExportDirectory, os.ModePerm); err != nil {
 		log.Fatalf("Failed to create export directory: %v", err)
 	}
 
-	log.Printf("Initialized with Grafana URL: %s", config.GrafanaURL)
-	log.Printf("Export directory: %s", config.ExportDirectory)
-	log.Printf("Server running on host and port: %s:%s", config.ServerHost, config.ServerPort)
-	log.Printf("Grafana version: %.1f", config.GrafanaVersion)
+	log.Printf("Initialized with Grafana URL: %s", cfg.GrafanaURL)
+	log.Printf("Export directory: %s", cfg.ExportDirectory)
+	log.Printf("Server running on host and port: %s:%s", cfg.ServerHost, cfg.ServerPort)
+	log.Printf("Metadata cache TTL: %s", cfg.CacheTTL)
+	log.Printf("Grafana credentials: %s", cfg.GrafanaCredentials)
+	log.Printf("Grafana authentication: %s", cfg.GrafanaAuth)
 
 	checkGrafanaConnection()
 
-	return nil
+	if err := pinGrafanaVersion(cfg.GrafanaVersion); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	if currentGrafanaAPI().version > 0 {
+		log.Printf("Grafana version: %s (from GRAFANA_VERSION)", cfg.GrafanaVersion)
+	} else {
+		detectGrafanaVersion(context.Background())
+	}
+
+	return initErr
 }
 
 func getInitErrorMessage(err error) string {
@@ -199,44 +341,27 @@ func getInitErrorMessage(err error) string {
 	}
 
 	if strings.Contains(err.Error(), "missing .env file") {
-		return "Configuration file (.env) not found. Please create one based on the .env.example template."
+		return "Configuration file (.env) not found. Please create one based on the .env.example template, or configure the Grafana connection in Settings."
 	}
 
 	return err.Error()
 }
 
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return fallback
-}
-
-func getEnvBool(key string, fallback bool) bool {
-	if value, exists := os.LookupEnv(key); exists {
-		if value == "true" || value == "1" || value == "yes" {
-			return true
-		}
-		if value == "false" || value == "0" || value == "no" {
-			return false
-		}
-	}
-	return fallback
-}
-
 func checkGrafanaConnection() {
-	url := fmt.Sprintf("%s/api/health", config.GrafanaURL)
+	url := fmt.Sprintf("%s/api/health", currentConfig().GrafanaURL)
 
-	client := &http.Client{}
-	if config.SkipTLSVerify {
-		client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
+	if currentConfig().SkipTLSVerify {
 		log.Println("TLS certificate verification is disabled")
 	}
+	client, err := grafanaClient(currentConfig())
+	if err != nil {
+		log.Printf("Warning: Could not connect to Grafana: %v", err)
+		return
+	}
 
 	req, _ := http.NewRequest("GET", url, nil)
-	resp, err := client.Do(req)
+	applyGrafanaExtras(req, currentConfig())
+	resp, err := doGrafanaRequest(client, req)
 
 	if err != nil {
 		log.Printf("Warning: Could not connect to Grafana: %v", err)
@@ -253,10 +378,17 @@ func checkGrafanaConnection() {
 }
 
 func getFolders(c echo.Context) error {
-	url := fmt.Sprintf("%s/api/folders?limit=1000", config.GrafanaURL)
+	ctx := c.Request().Context()
+
+	// Refreshing empties the cache for everyone, so only admins may
+	if c.QueryParam("refresh") == "true" && hasRole(currentUser(c), roleAdmin) {
+		metaCache.Invalidate(cacheFolders)
+		metaCache.Invalidate(cacheDashboardSearch)
+	}
+
+	url := fmt.Sprintf("%s/api/folders", currentConfig().GrafanaURL)
 
-	var topLevelFolders []Folder
-	err := fetchAPIRaw(url, &topLevelFolders)
+	topLevelFolders, err := fetchAllPages[Folder](ctx, url, folderPageLimit)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -267,7 +399,7 @@ func getFolders(c echo.Context) error {
 	copy(allFolders, topLevelFolders)
 
 	for _, folder := range topLevelFolders {
-		folderCache[folder.UID] = folder.Title
+		cacheFolderTitle(ctx, folder.UID, folder.Title)
 	}
 
 	processedFolders := make(map[string]bool)
@@ -278,17 +410,21 @@ func getFolders(c echo.Context) error {
 	foldersToProcess := make([]Folder, len(topLevelFolders))
 	copy(foldersToProcess, topLevelFolders)
 
+	if !currentGrafanaAPI().NestedFolders() {
+		// Folders cannot be nested before Grafana 10
+		foldersToProcess = nil
+	}
+
 	for len(foldersToProcess) > 0 {
 		var nextWave []Folder
 
 		for _, parentFolder := range foldersToProcess {
 			nestedURL := fmt.Sprintf(
-				"%s/api/folders?limit=1000&withParents=true&parentUid=%s",
-				config.GrafanaURL, parentFolder.UID,
+				"%s/api/folders?withParents=true&parentUid=%s",
+				currentConfig().GrafanaURL, parentFolder.UID,
 			)
 
-			var childFolders []Folder
-			childErr := fetchAPIRaw(nestedURL, &childFolders)
+			childFolders, childErr := fetchAllPages[Folder](ctx, nestedURL, folderPageLimit)
 
 			if childErr == nil && len(childFolders) > 0 {
 				log.Printf(
@@ -298,7 +434,7 @@ func getFolders(c echo.Context) error {
 
 				for i := range childFolders {
 					childFolders[i].ParentUID = parentFolder.UID
-					folderCache[childFolders[i].UID] = childFolders[i].Title
+					cacheFolderTitle(ctx, childFolders[i].UID, childFolders[i].Title)
 
 					if !processedFolders[childFolders[i].UID] {
 						allFolders = append(allFolders, childFolders[i])
@@ -331,33 +467,43 @@ func getFolders(c echo.Context) error {
 		len(allFolders), len(topLevelFolders), nestedCount,
 	)
 
-	dashboardsUrl := fmt.Sprintf("%s/api/search?type=dash-db&limit=5000", config.GrafanaURL)
-	var searchResult []Dashboard
-	err = fetchAPIRaw(dashboardsUrl, &searchResult)
+	searchResult, err := fetchAllDashboards(ctx)
 	if err != nil {
 		log.Printf("Warning: Could not get dashboard counts: %v", err)
 	} else {
-		folderDashboardCounts := make(map[int]int)
+		// Search hits carry folderUid from Grafana 8 on, where folderId is
+		// deprecated; older versions only return folderId
+		countsByUID := make(map[string]int)
+		countsByID := make(map[int]int)
 		for _, dash := range searchResult {
-			if dash.Type == "" || dash.Type == "dash-db" {
-				folderDashboardCounts[dash.FolderID]++
+			if dash.Type != "" && dash.Type != "dash-db" {
+				continue
+			}
+			if dash.FolderUID != "" {
+				countsByUID[dash.FolderUID]++
+			} else {
+				countsByID[dash.FolderID]++
 			}
 		}
 
 		for i := range allFolders {
-			count := folderDashboardCounts[allFolders[i].ID]
-			allFolders[i].DashboardCount = count
+			allFolders[i].DashboardCount = countsByUID[allFolders[i].UID] + countsByID[allFolders[i].ID]
 		}
 	}
 
+	c.Response().Header().Set("X-Total-Count", strconv.Itoa(len(allFolders)))
 	return c.JSON(http.StatusOK, allFolders)
 }
 
 func getDashboards(c echo.Context) error {
-	url := fmt.Sprintf("%s/api/search?type=dash-db&limit=5000", config.GrafanaURL)
+	ctx := c.Request().Context()
+
+	if c.QueryParam("refresh") == "true" && hasRole(currentUser(c), roleAdmin) {
+		metaCache.Invalidate(cacheDashboardSearch)
+		metaCache.Invalidate(cacheDashboardDetails)
+	}
 
-	var searchResult []Dashboard
-	err := fetchAPIRaw(url, &searchResult)
+	searchResult, err := fetchAllDashboards(ctx)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -383,12 +529,27 @@ func getDashboards(c echo.Context) error {
 
 	log.Printf("Filtered to %d actual dashboards", len(dashboardsOnly))
 
-	// Fetch detailed dashboard information concurrently to get update timestamps
-	log.Printf("Fetching detailed information for %d dashboards...", len(dashboardsOnly))
-	dashboardsOnly = fetchDashboardDetails(dashboardsOnly)
-
 	response := DashboardResponse{
 		Dashboards: dashboardsOnly,
+		Total:      len(dashboardsOnly),
+	}
+
+	if c.QueryParam("wait") == "true" {
+		// Fetch detailed dashboard information concurrently to get update timestamps
+		log.Printf("Fetching detailed information for %d dashboards...", len(dashboardsOnly))
+		response.Dashboards = fetchDashboardDetails(ctx, dashboardsOnly)
+	} else {
+		// Answer from the search results and cached details right away; the
+		// rest is enriched in the background and pushed to /api/dashboards/updates.
+		var missing []Dashboard
+		for i, dash := range response.Dashboards {
+			if cached, ok := cachedDashboardDetail(ctx, dash); ok {
+				response.Dashboards[i] = cached
+			} else {
+				missing = append(missing, dash)
+			}
+		}
+		response.Pending = enricher.Enqueue(ctx, missing)
 	}
 
 	for i, dash := range response.Dashboards {
@@ -400,19 +561,11 @@ func getDashboards(c echo.Context) error {
 
 		if dash.FolderName == nil || *dash.FolderName == "" {
 			if dash.FolderUID != "" {
-				folderName, ok := folderCache[dash.FolderUID]
-				if ok {
+				if folderName, err := lookupFolderTitle(ctx, dash.FolderUID); err == nil {
 					response.Dashboards[i].FolderName = &folderName
 				} else {
-					folderURL := fmt.Sprintf("%s/api/folders/%s", config.GrafanaURL, dash.FolderUID)
-					var folder Folder
-					if err := fetchAPIRaw(folderURL, &folder); err == nil {
-						folderCache[folder.UID] = folder.Title
-						response.Dashboards[i].FolderName = &folder.Title
-					} else {
-						unknown := fmt.Sprintf("Folder ID %d", dash.FolderID)
-						response.Dashboards[i].FolderName = &unknown
-					}
+					unknown := fmt.Sprintf("Folder ID %d", dash.FolderID)
+					response.Dashboards[i].FolderName = &unknown
 				}
 			} else {
 				unknown := fmt.Sprintf("Folder ID %d", dash.FolderID)
@@ -424,52 +577,102 @@ func getDashboards(c echo.Context) error {
 	return c.JSON(http.StatusOK, response)
 }
 
+// getLibraries lists the library elements with their folder and how many
+// dashboards use them. ?search filters by name, ?unused=true keeps the ones
+// no dashboard uses.
 func getLibraries(c echo.Context) error {
-	url := fmt.Sprintf("%s/api/library-elements?perPage=100", config.GrafanaURL)
+	ctx := c.Request().Context()
 
-	libraries, err := fetchAPI[LibraryElementsResponse](url)
+	elements, err := fetchAllLibraryElements(ctx)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	describeLibraryElements(ctx, elements)
+	elements = filterLibraryElements(elements, c.QueryParam("search"), c.QueryParam("unused") == "true")
+
+	var libraries LibraryElementsResponse
+	libraries.Result.Elements = elements
+	libraries.Result.TotalCount = len(elements)
+	libraries.Result.Page = 1
+	libraries.Result.PerPage = len(elements)
 
 	return c.JSON(http.StatusOK, libraries)
 }
 
-func getAlerts(c echo.Context) error {
-	var alertRules []Alert
-	var err error
-
-	url := fmt.Sprintf("%s/api/v1/provisioning/alert-rules", config.GrafanaURL)
-	err = fetchAPIRaw(url, &alertRules)
+// fetchAllDashboards returns every dashboard visible to the API key by
+// walking /api/search page by page. Results are cached; callers receive
+// their own copy of the slice.
+func fetchAllDashboards(ctx context.Context) ([]Dashboard, error) {
+	if cached, ok := metaCache.Get(cacheDashboardSearch, scopedCacheKey(ctx, "dash-db")); ok {
+		if dashboards, ok := cached.([]Dashboard); ok {
+			return append([]Dashboard(nil), dashboards...), nil
+		}
+	}
 
+	url := fmt.Sprintf("%s/api/search?type=dash-db", currentConfig().GrafanaURL)
+	dashboards, err := fetchAllPages[Dashboard](ctx, url, searchPageLimit)
 	if err != nil {
-		legacyURL := fmt.Sprintf("%s/api/alerts", config.GrafanaURL)
-		err = fetchAPIRaw(legacyURL, &alertRules)
+		return nil, err
+	}
+
+	metaCache.Set(cacheDashboardSearch, scopedCacheKey(ctx, "dash-db"), append([]Dashboard(nil), dashboards...))
+	return dashboards, nil
+}
 
+// fetchAllLibraryElements walks /api/library-elements using page/perPage
+// until totalCount elements have been collected.
+// Grafana versions without library panels have none to list.
+func fetchAllLibraryElements(ctx context.Context) ([]LibraryElement, error) {
+	elements := make([]LibraryElement, 0)
+	if !currentGrafanaAPI().LibraryElements() {
+		return elements, nil
+	}
+
+	for page := 1; ; page++ {
+		url := fmt.Sprintf(
+			"%s/api/library-elements?perPage=%d&page=%d",
+			currentConfig().GrafanaURL, libraryElementsPerPage, page,
+		)
+
+		response, err := fetchAPI[LibraryElementsResponse](ctx, url)
 		if err != nil {
-			log.Printf("Warning: Could not fetch alerts: %v", err)
-			return c.JSON(http.StatusOK, AlertResponse{Alerts: []Alert{}})
+			return nil, err
+		}
+
+		elements = append(elements, response.Result.Elements...)
+
+		if len(response.Result.Elements) == 0 ||
+			len(response.Result.Elements) < libraryElementsPerPage ||
+			len(elements) >= response.Result.TotalCount {
+			break
 		}
 	}
 
+	log.Printf("Retrieved %d library elements from API", len(elements))
+	return elements, nil
+}
+
+func getAlerts(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var alertRules []Alert
+	if err := fetchAlertRules(ctx, "", &alertRules); err != nil {
+		log.Printf("Warning: Could not fetch alerts from Grafana %s: %v", currentGrafanaAPI(), err)
+		return c.JSON(http.StatusOK, AlertResponse{Alerts: []Alert{}})
+	}
+
 	log.Printf("Retrieved %d alert rules from API", len(alertRules))
+	describeLinkedDashboards(ctx, alertRules)
 
 	for i := range alertRules {
-		if alertRules[i].FolderID == 0 {
+		// Unified alert rules only carry folderUID, legacy alerts folderId
+		if alertRules[i].FolderID == 0 && alertRules[i].FolderUID == "" {
 			alertRules[i].FolderTitle = "General"
 		} else if alertRules[i].FolderUID != "" {
-			folderName, ok := folderCache[alertRules[i].FolderUID]
-			if ok {
+			if folderName, err := lookupFolderTitle(ctx, alertRules[i].FolderUID); err == nil {
 				alertRules[i].FolderTitle = folderName
 			} else {
-				folderURL := fmt.Sprintf("%s/api/folders/%s", config.GrafanaURL, alertRules[i].FolderUID)
-				var folder Folder
-				if err := fetchAPIRaw(folderURL, &folder); err == nil {
-					folderCache[folder.UID] = folder.Title
-					alertRules[i].FolderTitle = folder.Title
-				} else {
-					alertRules[i].FolderTitle = fmt.Sprintf("Folder ID %d", alertRules[i].FolderID)
-				}
+				alertRules[i].FolderTitle = fmt.Sprintf("Folder ID %d", alertRules[i].FolderID)
 			}
 		}
 	}
@@ -478,46 +681,202 @@ func getAlerts(c echo.Context) error {
 }
 
 func exportDashboards(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	audit := newAuditEntry(c, auditActionExport)
+	defer func() {
+		audit.Status = c.Response().Status
+		auditLogger.Record(audit)
+		metrics.ObserveExport(audit)
+	}()
+
 	var req struct {
 		DashboardUIDs []string `json:"dashboardUIDs"`
 		AlertUIDs     []string `json:"alertUIDs"`
 		IncludeAlerts bool     `json:"includeAlerts"`
 		ExportAsZip   bool     `json:"exportAsZip"`
+		exportOptions
+		OrgID  int   `json:"orgId"`  // Organization the UIDs belong to; 0 for the default one
+		OrgIDs []int `json:"orgIds"` // Export everything in these organizations instead
 	}
 
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if len(req.DashboardUIDs) == 0 && len(req.AlertUIDs) == 0 {
+	audit.UIDs = map[string][]string{"dashboards": req.DashboardUIDs}
+	if req.IncludeAlerts {
+		audit.UIDs["alerts"] = req.AlertUIDs
+	}
+	if len(req.OrgIDs) > 0 {
+		audit.UIDs["orgs"] = orgIDStrings(req.OrgIDs)
+	} else if req.OrgID > 0 {
+		audit.UIDs["orgs"] = orgIDStrings([]int{req.OrgID})
+	}
+
+	selectsObjects := false
+	for name, uids := range req.Objects {
+		if _, ok := findObjectKind(name); !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Unknown object type %q", name)})
+		}
+		if len(uids) > 0 {
+			selectsObjects = true
+			audit.UIDs[name] = uids
+		}
+	}
+
+	if len(req.LibraryUIDs) > 0 {
+		audit.UIDs["libraries"] = req.LibraryUIDs
+	}
+
+	if len(req.DashboardUIDs) == 0 && len(req.AlertUIDs) == 0 && len(req.LibraryUIDs) == 0 && len(req.OrgIDs) == 0 && !req.IncludeIdentity && !selectsObjects {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No dashboards or alerts selected"})
 	}
 
+	exportsAlerts := (req.IncludeAlerts && (len(req.AlertUIDs) > 0 || len(req.OrgIDs) > 0)) ||
+		(req.IncludeLinkedAlerts && (len(req.DashboardUIDs) > 0 || len(req.OrgIDs) > 0))
+	if exportsAlerts && !hasRole(currentUser(c), roleAdmin) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Exporting alert rules requires the admin role"})
+	}
+	if req.VersionLimit < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "versionLimit must not be negative"})
+	}
+	if req.AnnotationsFrom < 0 || req.AnnotationsTo < 0 || (req.AnnotationsTo > 0 && req.AnnotationsTo < req.AnnotationsFrom) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid annotation time range"})
+	}
+	if req.IncludeIdentity && !hasRole(currentUser(c), roleAdmin) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Exporting users and teams requires the admin role"})
+	}
+
 	timestamp := time.Now().Format("20060102_150405")
-	exportPath := filepath.Join(config.ExportDirectory, timestamp)
+	exportPath := filepath.Join(currentConfig().ExportDirectory, timestamp)
 
 	if err := os.MkdirAll(exportPath, os.ModePerm); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create export directory"})
 	}
 
-	exportedLibraries := make(map[string]bool)
-	exportResult := struct {
-		ExportedDashboards int      `json:"exportedDashboards"`
-		ExportedLibraries  int      `json:"exportedLibraries"`
-		ExportedAlerts     int      `json:"exportedAlerts"`
-		Errors             []string `json:"errors"`
-		ExportPath         string   `json:"exportPath"`
-	}{
+	result := &exportResult{
 		Errors:     []string{},
 		ExportPath: exportPath,
 	}
+	opts := req.exportOptions
+	opts.IncludeAlerts = req.IncludeAlerts
+
+	switch {
+	case len(req.OrgIDs) > 0:
+		for _, orgID := range req.OrgIDs {
+			exportOrganization(withGrafanaOrg(ctx, orgID), exportPath, opts, result)
+		}
+	case req.OrgID > 0:
+		orgCtx := withGrafanaOrg(ctx, req.OrgID)
+		orgPath, err := organizationExportPath(orgCtx, exportPath, result)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			break
+		}
+		exportSelection(orgCtx, orgPath, req.DashboardUIDs, req.AlertUIDs, opts, result)
+	default:
+		exportSelection(ctx, exportPath, req.DashboardUIDs, req.AlertUIDs, opts, result)
+	}
+
+	audit.Counts = map[string]int{
+		"dashboards": result.ExportedDashboards,
+		"libraries":  result.ExportedLibraries,
+		"alerts":     result.ExportedAlerts,
+	}
+	if opts.IncludePermissions {
+		audit.Counts["permissions"] = result.ExportedPermissions
+	}
+	if opts.IncludeIdentity {
+		audit.Counts["identities"] = result.ExportedIdentities
+	}
+	if opts.IncludeVersions {
+		audit.Counts["versions"] = result.ExportedVersions
+	}
+	if opts.IncludeAnnotations {
+		audit.Counts["annotations"] = result.ExportedAnnotations
+	}
+	for name, count := range result.ExportedObjects {
+		audit.Counts[name] = count
+	}
+	audit.Errors = result.Errors
+	audit.ExportPath = exportPath
+	audit.SizeBytes = directorySize(exportPath)
+
+	if req.ExportAsZip {
+		zipFilePath := exportPath + ".zip"
+		audit.ExportPath = zipFilePath
+		err := zipDirectory(exportPath, zipFilePath)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create zip archive: " + err.Error()})
+		}
+		zipFile, err := os.Open(zipFilePath)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open zip archive: " + err.Error()})
+		}
+		defer zipFile.Close()
+		stat, _ := zipFile.Stat()
+		audit.SizeBytes = stat.Size()
+		c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+		c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename=\"grafana-export-"+timestamp+".zip\"")
+		c.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(stat.Size(), 10))
+		_, err = io.Copy(c.Response().Writer, zipFile)
+		return err
+	}
 
-	for _, uid := range req.DashboardUIDs {
-		dashURL := fmt.Sprintf("%s/api/dashboards/uid/%s", config.GrafanaURL, uid)
-		dashboard, err := fetchAPI[DashboardWithMeta](dashURL)
+	return c.JSON(http.StatusOK, result)
+}
+
+// exportResult summarises an export for the UI and the audit log.
+type exportResult struct {
+	ExportedDashboards  int            `json:"exportedDashboards"`
+	ExportedLibraries   int            `json:"exportedLibraries"`
+	ExportedAlerts      int            `json:"exportedAlerts"`
+	ExportedPermissions int            `json:"exportedPermissions,omitempty"`
+	ExportedIdentities  int            `json:"exportedIdentities,omitempty"`
+	ExportedVersions    int            `json:"exportedVersions,omitempty"`
+	ExportedAnnotations int            `json:"exportedAnnotations,omitempty"`
+	ExportedObjects     map[string]int `json:"exportedObjects,omitempty"` // Playlists, snapshots and other objectKinds
+	Errors              []string       `json:"errors"`
+	ExportPath          string         `json:"exportPath"`
+	Organizations       []string       `json:"organizations,omitempty"`
+}
+
+// exportOptions are what an export includes besides the dashboards and the
+// library panels they use.
+type exportOptions struct {
+	IncludeAlerts       bool                `json:"-"`
+	WholeOrganization   bool                `json:"-"`                   // Exporting an organization rather than a selection
+	IncludePermissions  bool                `json:"includePermissions"`  // Folder and dashboard permissions
+	IncludeIdentity     bool                `json:"includeIdentity"`     // Teams, users and service accounts
+	IncludeVersions     bool                `json:"includeVersions"`     // Version history of the dashboards
+	VersionLimit        int                 `json:"versionLimit"`        // Newest versions to export; 0 exports all
+	IncludeAnnotations  bool                `json:"includeAnnotations"`  // Dashboard and organization annotations
+	AnnotationsFrom     int64               `json:"annotationsFrom"`     // Start of their time range in epoch ms; 0 is unbounded
+	AnnotationsTo       int64               `json:"annotationsTo"`       // End of their time range in epoch ms; 0 is unbounded
+	Objects             map[string][]string `json:"objects"`             // UIDs of other objects by objectKind name
+	LibraryUIDs         []string            `json:"libraryUIDs"`         // Library elements to export on their own
+	IncludeLinkedAlerts bool                `json:"includeLinkedAlerts"` // Alert rules of the exported dashboards, next to them
+}
+
+// exportSelection writes the given dashboards, the library panels they use,
+// the library panels selected on their own and the given alert rules below
+// exportPath. Alert rules already exported next to their dashboard are not
+// written again to Alerts.
+func exportSelection(ctx context.Context, exportPath string, dashboardUIDs, alertUIDs []string, opts exportOptions, result *exportResult) {
+	exportedLibraries := make(map[string]bool)
+	exportedAlerts := make(map[string]bool)
+	alertFiles := make(map[string]bool)
+	linkedAlerts := newLinkedAlertIndex(ctx)
+	exportedFolderPermissions := newFolderPermissionFiles()
+	permissions := newPermissionResolver(ctx)
+
+	for _, uid := range dashboardUIDs {
+		dashURL := fmt.Sprintf("%s/api/dashboards/uid/%s", currentConfig().GrafanaURL, uid)
+		dashboard, err := fetchAPI[DashboardWithMeta](ctx, dashURL)
 
 		if err != nil {
-			exportResult.Errors = append(exportResult.Errors, fmt.Sprintf("Failed to fetch dashboard %s: %v", uid, err))
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to fetch dashboard %s: %v", uid, err))
 			continue
 		}
 
@@ -528,15 +887,15 @@ func exportDashboards(c echo.Context) error {
 			folderName := dashboard.Meta.FolderTitle
 			resolved, err := safePath(exportPath, sanitizePath(folderName))
 			if err != nil {
-				exportResult.Errors = append(exportResult.Errors, fmt.Sprintf("Invalid folder path for %s: %v", uid, err))
+				result.Errors = append(result.Errors, fmt.Sprintf("Invalid folder path for %s: %v", uid, err))
 				continue
 			}
 			folderPath = resolved
 		}
 
 		if err := os.MkdirAll(folderPath, os.ModePerm); err != nil {
-			exportResult.Errors = append(
-				exportResult.Errors,
+			result.Errors = append(
+				result.Errors,
 				fmt.Sprintf("Failed to create folder structure for %s: %v", uid, err),
 			)
 			continue
@@ -549,30 +908,45 @@ func exportDashboards(c echo.Context) error {
 
 		safeFilename, err := safePath(folderPath, sanitizePath(dashboardTitle)+".json")
 		if err != nil {
-			exportResult.Errors = append(exportResult.Errors, fmt.Sprintf("Invalid filename for dashboard %s: %v", uid, err))
+			result.Errors = append(result.Errors, fmt.Sprintf("Invalid filename for dashboard %s: %v", uid, err))
 			continue
 		}
 		filename := safeFilename
 		dashboardJSON, err := json.MarshalIndent(dashboard.Dashboard, "", "  ")
 		if err != nil {
-			exportResult.Errors = append(
-				exportResult.Errors,
+			result.Errors = append(
+				result.Errors,
 				fmt.Sprintf("Failed to marshal dashboard %s: %v", uid, err),
 			)
 			continue
 		}
 
 		if err := os.WriteFile(filename, dashboardJSON, 0644); err != nil {
-			exportResult.Errors = append(exportResult.Errors, fmt.Sprintf("Failed to write dashboard %s: %v", uid, err))
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to write dashboard %s: %v", uid, err))
 			continue
 		}
 
-		exportResult.ExportedDashboards++
+		result.ExportedDashboards++
+
+		if opts.IncludePermissions {
+			exportPermissions(permissions, uid, dashboard.Meta.FolderUID, filename, exportedFolderPermissions, result)
+		}
+		dashboardID, _ := dashboard.Dashboard["id"].(float64)
+		ref := Dashboard{ID: int(dashboardID), UID: uid}
+		if opts.IncludeVersions {
+			exportDashboardVersions(ctx, ref, filename, opts.VersionLimit, result)
+		}
+		if opts.IncludeAnnotations {
+			exportDashboardAnnotations(ctx, ref, filename, opts, result)
+		}
+		if opts.IncludeLinkedAlerts {
+			exportLinkedAlerts(ctx, linkedAlerts, uid, filename, exportedAlerts, alertFiles, result)
+		}
 
 		libraryPanels, err := extractLibraryPanelUIDs(dashboard.Dashboard)
 		if err != nil {
-			exportResult.Errors = append(
-				exportResult.Errors,
+			result.Errors = append(
+				result.Errors,
 				fmt.Sprintf("Failed to extract library panels from %s: %v", uid, err),
 			)
 		}
@@ -583,12 +957,13 @@ func exportDashboards(c echo.Context) error {
 			}
 
 			if err := exportLibraryElement(
+				ctx,
 				libraryUID,
 				folderPath, // Use the same folder as the dashboard
-				&exportResult.ExportedLibraries,
-				&exportResult.Errors,
+				&result.ExportedLibraries,
+				&result.Errors,
 			); err != nil {
-				exportResult.Errors = append(exportResult.Errors, err.Error())
+				result.Errors = append(result.Errors, err.Error())
 				continue
 			}
 
@@ -596,76 +971,48 @@ func exportDashboards(c echo.Context) error {
 		}
 	}
 
-	if req.IncludeAlerts {
-		for _, uid := range req.AlertUIDs {
-			alertURL := fmt.Sprintf("%s/api/v1/provisioning/alert-rules/%s", config.GrafanaURL, uid)
-			var alert map[string]interface{}
-			err := fetchAPIRaw(alertURL, &alert)
-
-			if err != nil {
-				legacyURL := fmt.Sprintf("%s/api/alerts/%s", config.GrafanaURL, uid)
-				err = fetchAPIRaw(legacyURL, &alert)
-			}
-
-			if err != nil {
-				exportResult.Errors = append(exportResult.Errors, fmt.Sprintf("Failed to fetch alert %s: %v", uid, err))
-				continue
-			}
-
-			alertsPath := filepath.Join(exportPath, "Alerts")
-			if err := os.MkdirAll(alertsPath, os.ModePerm); err != nil {
-				exportResult.Errors = append(exportResult.Errors, fmt.Sprintf("Failed to create alerts folder: %v", err))
-				continue
-			}
-
-			var alertTitle string
-			if title, ok := alert["title"].(string); ok {
-				alertTitle = title
-			} else {
-				alertTitle = uid
-			}
-
-			safeAlertFilename, err := safePath(alertsPath, sanitizePath(alertTitle)+".json")
-			if err != nil {
-				exportResult.Errors = append(exportResult.Errors, fmt.Sprintf("Invalid filename for alert %s: %v", uid, err))
+	if opts.IncludeAlerts {
+		for _, uid := range alertUIDs {
+			if exportedAlerts[uid] {
 				continue
 			}
-			filename := safeAlertFilename
-			alertJSON, err := json.MarshalIndent(alert, "", "  ")
-			if err != nil {
-				exportResult.Errors = append(exportResult.Errors, fmt.Sprintf("Failed to marshal alert %s: %v", uid, err))
-				continue
-			}
-
-			if err := os.WriteFile(filename, alertJSON, 0644); err != nil {
-				exportResult.Errors = append(exportResult.Errors, fmt.Sprintf("Failed to write alert %s: %v", uid, err))
+			if err := exportAlertRule(ctx, uid, filepath.Join(exportPath, "Alerts"), alertFiles, result); err != nil {
+				result.Errors = append(result.Errors, err.Error())
 				continue
 			}
-
-			exportResult.ExportedAlerts++
+			exportedAlerts[uid] = true
 		}
 	}
 
-	if req.ExportAsZip {
-		zipFilePath := exportPath + ".zip"
-		err := zipDirectory(exportPath, zipFilePath)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create zip archive: " + err.Error()})
-		}
-		zipFile, err := os.Open(zipFilePath)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open zip archive: " + err.Error()})
+	if len(opts.LibraryUIDs) > 0 {
+		exportLibraryElements(ctx, exportPath, opts.LibraryUIDs, exportedLibraries, result)
+	}
+	// Organization annotations belong to no dashboard: a selection only takes
+	// those of the requested time range
+	if opts.IncludeAnnotations && (opts.WholeOrganization || opts.AnnotationsFrom > 0 || opts.AnnotationsTo > 0) {
+		exportOrgAnnotations(ctx, exportPath, opts, result)
+	}
+	refs := newDashboardRefs(ctx)
+	for _, kind := range objectKinds {
+		if uids := opts.Objects[kind.Name]; len(uids) > 0 {
+			kind.exportObjects(ctx, exportPath, uids, refs, result)
 		}
-		defer zipFile.Close()
-		stat, _ := zipFile.Stat()
-		c.Response().Header().Set(echo.HeaderContentType, "application/zip")
-		c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename=\"grafana-export-"+timestamp+".zip\"")
-		c.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(stat.Size(), 10))
-		_, err = io.Copy(c.Response().Writer, zipFile)
-		return err
 	}
+	if opts.IncludeIdentity {
+		exportIdentity(ctx, exportPath, result)
+	}
+}
 
-	return c.JSON(http.StatusOK, exportResult)
+// directorySize returns the total size of the files below dir.
+func directorySize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
 }
 
 // zipDirectory zips the contents of srcDir into destZip (full path)
@@ -704,50 +1051,9 @@ func zipDirectory(srcDir, destZip string) error {
 	})
 }
 
-func extractLibraryPanelUIDs(dashboard map[string]interface{}) ([]string, error) {
-	libraryUIDs := make([]string, 0)
-
-	panelsInterface, ok := dashboard["panels"]
-	if !ok {
-		return libraryUIDs, nil
-	}
-
-	panels, ok := panelsInterface.([]interface{})
-	if !ok {
-		return libraryUIDs, fmt.Errorf("panels is not an array")
-	}
-
-	for _, panelInterface := range panels {
-		panel, ok := panelInterface.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		if libraryPanel, ok := panel["libraryPanel"].(map[string]interface{}); ok {
-			if uid, ok := libraryPanel["uid"].(string); ok {
-				libraryUIDs = append(libraryUIDs, uid)
-			}
-		}
-
-		if nestedPanelsInterface, ok := panel["panels"].([]interface{}); ok {
-			for _, nestedPanelInterface := range nestedPanelsInterface {
-				if nestedPanel, ok := nestedPanelInterface.(map[string]interface{}); ok {
-					if libraryPanel, ok := nestedPanel["libraryPanel"].(map[string]interface{}); ok {
-						if uid, ok := libraryPanel["uid"].(string); ok {
-							libraryUIDs = append(libraryUIDs, uid)
-						}
-					}
-				}
-			}
-		}
-	}
-
-	return libraryUIDs, nil
-}
-
-func exportLibraryElement(uid string, basePath string, count *int, errors *[]string) error {
-	url := fmt.Sprintf("%s/api/library-elements/%s", config.GrafanaURL, uid)
-	library, err := fetchAPI[LibraryElementWithMeta](url)
+func exportLibraryElement(ctx context.Context, uid string, basePath string, count *int, errors *[]string) error {
+	url := fmt.Sprintf("%s/api/library-elements/%s", currentConfig().GrafanaURL, uid)
+	library, err := fetchAPI[LibraryElementWithMeta](ctx, url)
 
 	if err != nil {
 		return fmt.Errorf("failed to fetch library element %s: %v", uid, err)
@@ -757,16 +1063,9 @@ func exportLibraryElement(uid string, basePath string, count *int, errors *[]str
 	if library.Result.FolderID == 0 {
 		folderPath = filepath.Join(basePath, "General")
 	} else {
-		folderName, ok := folderCache[library.Result.FolderUID]
-		if !ok {
-			folderURL := fmt.Sprintf("%s/api/folders/%s", config.GrafanaURL, library.Result.FolderUID)
-			folder, err := fetchAPI[Folder](folderURL)
-			if err != nil {
-				folderName = "Unknown_" + library.Result.FolderUID
-			} else {
-				folderName = folder.Title
-				folderCache[library.Result.FolderUID] = folderName
-			}
+		folderName, err := lookupFolderTitle(ctx, library.Result.FolderUID)
+		if err != nil {
+			folderName = "Unknown_" + library.Result.FolderUID
 		}
 		resolved, err := safePath(basePath, sanitizePath(folderName))
 		if err != nil {
@@ -845,24 +1144,34 @@ func safePath(basePath string, unsafePath string) (string, error) {
 	return absJoined, nil
 }
 
-func fetchAPI[T any](url string) (T, error) {
-	var result T
+// doGrafanaRequest sends a Grafana API request and records its metrics.
+func doGrafanaRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := client.Do(req)
 
-	client := &http.Client{}
-	if config.SkipTLSVerify {
-		client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
 	}
+	metrics.ObserveGrafanaRequest(req.Method, req.URL.Path, status, time.Since(start))
 
-	req, err := http.NewRequest("GET", url, nil)
+	return resp, err
+}
+
+func fetchAPI[T any](ctx context.Context, url string) (T, error) {
+	var result T
+
+	client, err := grafanaClient(currentConfig())
 	if err != nil {
 		return result, err
 	}
 
-	req.Header.Add("Authorization", "Bearer "+config.GrafanaAPIKey)
+	req, err := newGrafanaRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return result, err
+	}
 
-	resp, err := client.Do(req)
+	resp, err := doGrafanaRequest(client, req)
 	if err != nil {
 		return result, err
 	}
@@ -870,7 +1179,7 @@ func fetchAPI[T any](url string) (T, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return result, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return result, &grafanaAPIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
@@ -880,12 +1189,10 @@ func fetchAPI[T any](url string) (T, error) {
 	return result, nil
 }
 
-func fetchAPIRaw(url string, target interface{}) error {
-	client := &http.Client{}
-	if config.SkipTLSVerify {
-		client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
+func fetchAPIRaw(ctx context.Context, url string, target interface{}) error {
+	client, err := grafanaClient(currentConfig())
+	if err != nil {
+		return err
 	}
 
 	maxRetries := 1
@@ -900,15 +1207,13 @@ func fetchAPIRaw(url string, target interface{}) error {
 			time.Sleep(500 * time.Millisecond)
 		}
 
-		req, err := http.NewRequest("GET", url, nil)
+		req, err := newGrafanaRequest(ctx, "GET", url, nil)
 		if err != nil {
 			lastErr = err
 			continue
 		}
 
-		req.Header.Add("Authorization", "Bearer "+config.GrafanaAPIKey)
-
-		resp, err := client.Do(req)
+		resp, err := doGrafanaRequest(client, req)
 		if err != nil {
 			lastErr = err
 			continue
@@ -923,7 +1228,7 @@ func fetchAPIRaw(url string, target interface{}) error {
 		}
 
 		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+			lastErr = &grafanaAPIError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
 
 			// Special case: If we're fetching subfolders and get a 404,
 			// this might mean the API endpoint is different or not supported
@@ -964,13 +1269,106 @@ func fetchAPIRaw(url string, target interface{}) error {
 	return lastErr
 }
 
-func getEnvFloat(key string, fallback float64) float64 {
-	if value, exists := os.LookupEnv(key); exists {
-		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
-			return floatVal
+// grafanaAPIError is an unsuccessful answer of the Grafana API.
+type grafanaAPIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *grafanaAPIError) Error() string {
+	return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// isGrafanaNotFound reports whether err is Grafana answering 404, which for
+// a listing usually means the object type does not exist in that edition
+// or version.
+func isGrafanaNotFound(err error) bool {
+	var apiErr *grafanaAPIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// sendAPI sends payload as JSON to the Grafana API and decodes the answer
+// into target when it is not nil. Failed requests return a *grafanaAPIError.
+func sendAPI(ctx context.Context, method, url string, payload, target interface{}) error {
+	client, err := grafanaClient(currentConfig())
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := newGrafanaRequest(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := doGrafanaRequest(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &grafanaAPIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	if target == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, target)
+}
+
+// fetchAllPages walks a Grafana endpoint paginated with page/limit query
+// parameters and returns the items of every page. Paging stops at the first
+// short page, or when the server ignores the page parameter and repeats the
+// previous page.
+func fetchAllPages[T any](ctx context.Context, baseURL string, limit int) ([]T, error) {
+	separator := "?"
+	if strings.Contains(baseURL, "?") {
+		separator = "&"
+	}
+
+	items := make([]T, 0)
+	var previousFirst json.RawMessage
+
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s%slimit=%d&page=%d", baseURL, separator, limit, page)
+
+		var rawItems []json.RawMessage
+		if err := fetchAPIRaw(ctx, url, &rawItems); err != nil {
+			return nil, err
+		}
+
+		if len(rawItems) == 0 {
+			break
+		}
+
+		if page > 1 && bytes.Equal(rawItems[0], previousFirst) {
+			log.Printf("Warning: %s does not support paging, stopping after page %d", baseURL, page-1)
+			break
+		}
+		previousFirst = rawItems[0]
+
+		for _, rawItem := range rawItems {
+			var item T
+			if err := json.Unmarshal(rawItem, &item); err != nil {
+				return nil, fmt.Errorf("JSON decode error on page %d: %v", page, err)
+			}
+			items = append(items, item)
+		}
+
+		if len(rawItems) < limit {
+			break
 		}
 	}
-	return fallback
+
+	return items, nil
 }
 
 func extractVersionNumber(dashboard map[string]interface{}) int {
@@ -980,7 +1378,7 @@ func extractVersionNumber(dashboard map[string]interface{}) int {
 	return 0
 }
 
-func fetchDashboardDetails(dashboards []Dashboard) []Dashboard {
+func fetchDashboardDetails(ctx context.Context, dashboards []Dashboard) []Dashboard {
 	// Use a semaphore to limit concurrent requests to avoid overwhelming Grafana
 	semaphore := make(chan struct{}, 10) // Max 10 concurrent requests
 	var results = make([]Dashboard, len(dashboards))
@@ -995,44 +1393,15 @@ func fetchDashboardDetails(dashboards []Dashboard) []Dashboard {
 	// Launch goroutines for each dashboard
 	for i, dashboard := range dashboards {
 		go func(index int, dash Dashboard) {
-			semaphore <- struct{}{}        // Acquire semaphore
-			defer func() { <-semaphore }() // Release semaphore
-
-			// Fetch detailed dashboard information
-			url := fmt.Sprintf("%s/api/dashboards/uid/%s", config.GrafanaURL, dash.UID)
-			var dashboardDetail DashboardWithMeta
-			err := fetchAPIRaw(url, &dashboardDetail)
-
-			if err != nil {
-				log.Printf("Warning: Failed to fetch details for dashboard %s (%s): %v", dash.Title, dash.UID, err)
-				// Return original dashboard if we can't get details
-				resultChan <- result{index: index, dashboard: dash}
+			if cached, ok := cachedDashboardDetail(ctx, dash); ok {
+				resultChan <- result{index: index, dashboard: cached}
 				return
 			}
 
-			// Extract version and update timestamp from dashboard metadata
-			if dashboardDetail.Dashboard != nil {
-				if updated, ok := dashboardDetail.Dashboard["updated"].(string); ok {
-					dash.Updated = updated
-				}
-
-				// Extract version number
-				dash.Version = extractVersionNumber(dashboardDetail.Dashboard)
-
-				// If we have a version, fetch the version details to get the accurate created timestamp
-				if dash.Version > 0 {
-					versionURL := fmt.Sprintf("%s/api/dashboards/uid/%s/versions/%d", config.GrafanaURL, dash.UID, dash.Version)
-					var versionDetail DashboardVersionDetail
-					versionErr := fetchAPIRaw(versionURL, &versionDetail)
-					if versionErr == nil && versionDetail.Created != "" {
-						dash.Updated = versionDetail.Created
-					} else if versionErr != nil {
-						log.Printf("Warning: Failed to fetch version details for dashboard %s (v%d): %v", dash.Title, dash.Version, versionErr)
-					}
-				}
-			}
+			semaphore <- struct{}{}        // Acquire semaphore
+			defer func() { <-semaphore }() // Release semaphore
 
-			resultChan <- result{index: index, dashboard: dash}
+			resultChan <- result{index: index, dashboard: fetchDashboardDetail(ctx, dash)}
 		}(i, dashboard)
 	}
 
@@ -1046,6 +1415,70 @@ func fetchDashboardDetails(dashboards []Dashboard) []Dashboard {
 	return results
 }
 
+// cachedDashboardDetail fills Updated and Version from the details cache.
+func cachedDashboardDetail(ctx context.Context, dash Dashboard) (Dashboard, bool) {
+	cached, ok := metaCache.Get(cacheDashboardDetails, scopedCacheKey(ctx, dash.UID))
+	if !ok {
+		return dash, false
+	}
+
+	detail, ok := cached.(Dashboard)
+	if !ok {
+		return dash, false
+	}
+
+	dash.Updated = detail.Updated
+	dash.Version = detail.Version
+	return dash, true
+}
+
+// fetchDashboardDetail fetches the dashboard model to learn its version and
+// update timestamp. The timestamp of a given version never changes, so it is
+// cached under uid@version and the version request is skipped when known.
+func fetchDashboardDetail(ctx context.Context, dash Dashboard) Dashboard {
+	url := fmt.Sprintf("%s/api/dashboards/uid/%s", currentConfig().GrafanaURL, dash.UID)
+	var dashboardDetail DashboardWithMeta
+	err := fetchAPIRaw(ctx, url, &dashboardDetail)
+
+	if err != nil {
+		log.Printf("Warning: Failed to fetch details for dashboard %s (%s): %v", dash.Title, dash.UID, err)
+		// Return original dashboard if we can't get details
+		return dash
+	}
+
+	if dashboardDetail.Dashboard == nil {
+		return dash
+	}
+
+	// Extract version and update timestamp from dashboard metadata
+	if updated, ok := dashboardDetail.Dashboard["updated"].(string); ok {
+		dash.Updated = updated
+	}
+
+	dash.Version = extractVersionNumber(dashboardDetail.Dashboard)
+
+	// If we have a version, fetch the version details to get the accurate created timestamp
+	if dash.Version > 0 {
+		versionKey := fmt.Sprintf("%s@%d", dash.UID, dash.Version)
+		if created, ok := metaCache.Get(cacheDashboardVersions, scopedCacheKey(ctx, versionKey)); ok {
+			dash.Updated, _ = created.(string)
+		} else {
+			versionURL := currentGrafanaAPI().DashboardVersionURL(dash, dash.Version)
+			var versionDetail DashboardVersionDetail
+			versionErr := fetchAPIRaw(ctx, versionURL, &versionDetail)
+			if versionErr == nil && versionDetail.Created != "" {
+				dash.Updated = versionDetail.Created
+				metaCache.Set(cacheDashboardVersions, scopedCacheKey(ctx, versionKey), versionDetail.Created)
+			} else if versionErr != nil {
+				log.Printf("Warning: Failed to fetch version details for dashboard %s (v%d): %v", dash.Title, dash.Version, versionErr)
+			}
+		}
+	}
+
+	metaCache.Set(cacheDashboardDetails, scopedCacheKey(ctx, dash.UID), dash)
+	return dash
+}
+
 func setupStaticFiles(e *echo.Echo) {
 	fsys, err := fs.Sub(publicFS, "public")
 	if err != nil {
@@ -1,48 +1,117 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestGetEnv(t *testing.T) {
-	os.Setenv("TEST_VAR", "test_value")
-	defer os.Unsetenv("TEST_VAR")
-	assert.Equal(t, "test_value", getEnv("TEST_VAR", "default"))
+// newFakeGrafana starts a stand-in for Grafana that answers the paths in
+// routes and 404 for any other. A route answers with its JSON body, with an
+// error like Grafana's when it is a status code, or is called when it is an
+// http.HandlerFunc, for answers that depend on the request. Routes may name
+// query parameters, such as "/api/teams/search?page=2", to answer only
+// requests that have them; the route naming the most of them wins.
+func newFakeGrafana(routes map[string]any) *httptest.Server {
+	return httptest.NewServer(fakeGrafanaHandler(routes))
+}
 
-	assert.Equal(t, "default", getEnv("NON_EXISTING_VAR", "default"))
+// newFakeGrafanaWithKey is newFakeGrafana for a Grafana that refuses requests
+// without the API key, except for /api/health.
+func newFakeGrafanaWithKey(apiKey string, routes map[string]any) *httptest.Server {
+	handler := fakeGrafanaHandler(routes)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/health" && r.Header.Get("Authorization") != "Bearer "+apiKey {
+			http.Error(w, `{"message":"invalid API key"}`, http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}))
 }
 
-func TestGetEnvBool(t *testing.T) {
-	tests := []struct {
-		name     string
-		envValue string
-		want     bool
-	}{
-		{"true value", "true", true},
-		{"yes value", "yes", true},
-		{"1 value", "1", true},
-		{"false value", "false", false},
-		{"no value", "no", false},
-		{"0 value", "0", false},
-		{"invalid value", "invalid", false},
+func fakeGrafanaHandler(routes map[string]any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		answer, matched, matchedParams := routes[r.URL.Path], r.URL.Path, 0
+		for route, candidate := range routes {
+			path, query, found := strings.Cut(route, "?")
+			if !found || path != r.URL.Path {
+				continue
+			}
+			params, _ := url.ParseQuery(query)
+			matches := true
+			for name := range params {
+				matches = matches && r.URL.Query().Get(name) == params.Get(name)
+			}
+			// Ties between routes naming as many parameters go to the one
+			// sorting first, whatever the order of the map
+			more := len(params) > matchedParams || (len(params) == matchedParams && route < matched)
+			if matches && more {
+				answer, matched, matchedParams = candidate, route, len(params)
+			}
+		}
+		writeFakeAnswer(w, r, answer)
 	}
+}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			os.Setenv("TEST_BOOL", tt.envValue)
-			defer os.Unsetenv("TEST_BOOL")
-			assert.Equal(t, tt.want, getEnvBool("TEST_BOOL", false))
-		})
+func writeFakeAnswer(w http.ResponseWriter, r *http.Request, answer any) {
+	switch answer := answer.(type) {
+	case string:
+		w.Write([]byte(answer))
+	case int:
+		http.Error(w, fmt.Sprintf(`{"message":%q}`, http.StatusText(answer)), answer)
+	case http.HandlerFunc:
+		answer(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// countRequests is a route answering like answer that counts its requests.
+func countRequests(calls *atomic.Int32, answer any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		writeFakeAnswer(w, r, answer)
+	}
+}
+
+func TestFakeGrafanaPrefersMostSpecificRoute(t *testing.T) {
+	grafana := newFakeGrafana(map[string]any{
+		"/api/search":                     `"any"`,
+		"/api/search?type=dash-db":        `"type"`,
+		"/api/search?page=2":              `"page"`,
+		"/api/search?limit=5":             `"limit"`,
+		"/api/search?page=2&type=dash-db": `"page and type"`,
+	})
+	defer grafana.Close()
+
+	for target, expected := range map[string]string{
+		"/api/search?limit=1":              `"any"`,
+		"/api/search?type=dash-db&limit=1": `"type"`,
+		"/api/search?page=2&type=dash-db":  `"page and type"`,
+		"/api/search?page=2&type=folder":   `"page"`,
+		"/api/search?page=2&limit=5":       `"limit"`, // Sorts before page
+	} {
+		for range 10 {
+			resp, err := http.Get(grafana.URL + target)
+			assert.NoError(t, err)
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, expected, string(body), target)
+		}
 	}
 }
 
@@ -134,7 +203,7 @@ func TestExportLibraryElement(t *testing.T) {
 
 	var count int
 	var errors []string
-	err = exportLibraryElement("test-uid", tempDir, &count, &errors)
+	err = exportLibraryElement(context.Background(), "test-uid", tempDir, &count, &errors)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, count)
 	assert.Empty(t, errors)
@@ -278,7 +347,7 @@ func TestFetchDashboardDetailsWithVersion(t *testing.T) {
 		{ID: 1, UID: "test-uid-1", Title: "Test Dashboard"},
 	}
 
-	result := fetchDashboardDetails(dashboards)
+	result := fetchDashboardDetails(context.Background(), dashboards)
 	assert.Len(t, result, 1)
 	assert.Equal(t, 7, result[0].Version)
 	assert.Equal(t, "2026-03-15T10:30:00Z", result[0].Updated)
@@ -320,42 +389,13 @@ func TestFetchDashboardDetailsVersionAPIFallback(t *testing.T) {
 		{ID: 2, UID: "test-uid-2", Title: "Test Dashboard 2"},
 	}
 
-	result := fetchDashboardDetails(dashboards)
+	result := fetchDashboardDetails(context.Background(), dashboards)
 	assert.Len(t, result, 1)
 	assert.Equal(t, 3, result[0].Version)
 	// Should fall back to the updated field from dashboard detail
 	assert.Equal(t, "2026-02-01T12:00:00Z", result[0].Updated)
 }
 
-func TestGetEnvFloat(t *testing.T) {
-	tests := []struct {
-		name     string
-		envKey   string
-		envValue string
-		setEnv   bool
-		fallback float64
-		expected float64
-	}{
-		{"valid float", "TEST_FLOAT", "11.5", true, 0.0, 11.5},
-		{"integer value", "TEST_FLOAT", "10", true, 0.0, 10.0},
-		{"invalid value uses fallback", "TEST_FLOAT", "abc", true, 5.5, 5.5},
-		{"missing env uses fallback", "TEST_FLOAT_MISSING", "", false, 3.14, 3.14},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if tt.setEnv {
-				os.Setenv(tt.envKey, tt.envValue)
-				defer os.Unsetenv(tt.envKey)
-			} else {
-				os.Unsetenv(tt.envKey)
-			}
-			result := getEnvFloat(tt.envKey, tt.fallback)
-			assert.InDelta(t, tt.expected, result, 0.001)
-		})
-	}
-}
-
 func TestSafePath(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "test-safepath-*")
 	assert.NoError(t, err)
@@ -416,10 +456,10 @@ func TestExtractLibraryPanelUIDsEdgeCases(t *testing.T) {
 
 func TestGetDashboardsHandler(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -456,10 +496,10 @@ func TestGetDashboardsHandler(t *testing.T) {
 		GrafanaURL:    ts.URL,
 		GrafanaAPIKey: "test-key",
 	}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/api/dashboards", nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/dashboards?wait=true", nil)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
@@ -471,6 +511,7 @@ func TestGetDashboardsHandler(t *testing.T) {
 	err = json.Unmarshal(rec.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.Len(t, response.Dashboards, 1)
+	assert.Equal(t, 1, response.Total)
 	assert.Equal(t, 2, response.Dashboards[0].Version)
 	assert.Equal(t, "2026-03-10T08:00:00Z", response.Dashboards[0].Updated)
 	assert.NotNil(t, response.Dashboards[0].FolderName)
@@ -479,10 +520,10 @@ func TestGetDashboardsHandler(t *testing.T) {
 
 func TestGetAlertsHandler(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -500,7 +541,7 @@ func TestGetAlertsHandler(t *testing.T) {
 		GrafanaURL:    ts.URL,
 		GrafanaAPIKey: "test-key",
 	}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodGet, "/api/alerts", nil)
@@ -523,11 +564,12 @@ func TestGetLibrariesHandler(t *testing.T) {
 	defer func() { config = originalConfig }()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		json.NewEncoder(w).Encode(LibraryElementsResponse{
-			Result: []LibraryElement{
-				{ID: 1, UID: "lib-1", Name: "Panel 1", Kind: 1},
-			},
-		})
+		var response LibraryElementsResponse
+		response.Result.TotalCount = 1
+		response.Result.Elements = []LibraryElement{
+			{ID: 1, UID: "lib-1", Name: "Panel 1", Kind: 1},
+		}
+		json.NewEncoder(w).Encode(response)
 	}))
 	defer ts.Close()
 
@@ -544,6 +586,107 @@ func TestGetLibrariesHandler(t *testing.T) {
 	err := getLibraries(c)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response LibraryElementsResponse
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, response.Result.TotalCount)
+	assert.Len(t, response.Result.Elements, 1)
+}
+
+func TestFetchAllLibraryElementsPaginates(t *testing.T) {
+	originalConfig := config
+	defer func() { config = originalConfig }()
+
+	total := libraryElementsPerPage + 20
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("perPage"))
+
+		var response LibraryElementsResponse
+		response.Result.TotalCount = total
+		response.Result.Page = page
+		response.Result.PerPage = perPage
+		for i := (page - 1) * perPage; i < page*perPage && i < total; i++ {
+			response.Result.Elements = append(response.Result.Elements, LibraryElement{
+				ID:  i,
+				UID: fmt.Sprintf("lib-%d", i),
+			})
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer ts.Close()
+
+	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
+
+	elements, err := fetchAllLibraryElements(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, elements, total)
+	assert.Equal(t, fmt.Sprintf("lib-%d", total-1), elements[total-1].UID)
+}
+
+func TestFetchAllPages(t *testing.T) {
+	originalConfig := config
+	defer func() { config = originalConfig }()
+
+	var requestedPages []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "dash-db", r.URL.Query().Get("type"))
+		assert.Equal(t, "2", r.URL.Query().Get("limit"))
+		page := r.URL.Query().Get("page")
+		requestedPages = append(requestedPages, page)
+
+		switch page {
+		case "1":
+			json.NewEncoder(w).Encode([]Dashboard{{UID: "d1"}, {UID: "d2"}})
+		case "2":
+			json.NewEncoder(w).Encode([]Dashboard{{UID: "d3"}, {UID: "d4"}})
+		default:
+			json.NewEncoder(w).Encode([]Dashboard{{UID: "d5"}})
+		}
+	}))
+	defer ts.Close()
+
+	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
+
+	dashboards, err := fetchAllPages[Dashboard](context.Background(), ts.URL+"/api/search?type=dash-db", 2)
+	assert.NoError(t, err)
+	assert.Len(t, dashboards, 5)
+	assert.Equal(t, []string{"1", "2", "3"}, requestedPages)
+}
+
+func TestFetchAllPagesIgnoredPageParameter(t *testing.T) {
+	originalConfig := config
+	defer func() { config = originalConfig }()
+
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		json.NewEncoder(w).Encode([]Folder{{UID: "f1"}, {UID: "f2"}})
+	}))
+	defer ts.Close()
+
+	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
+
+	folders, err := fetchAllPages[Folder](context.Background(), ts.URL+"/api/folders", 2)
+	assert.NoError(t, err)
+	assert.Len(t, folders, 2)
+	assert.Equal(t, 2, calls)
+}
+
+func TestFetchAllPagesError(t *testing.T) {
+	originalConfig := config
+	defer func() { config = originalConfig }()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "error", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
+
+	_, err := fetchAllPages[Folder](context.Background(), ts.URL+"/api/folders", 2)
+	assert.Error(t, err)
 }
 
 func TestFetchAPIError(t *testing.T) {
@@ -560,7 +703,7 @@ func TestFetchAPIError(t *testing.T) {
 		GrafanaAPIKey: "test-key",
 	}
 
-	_, err := fetchAPI[Dashboard](ts.URL + "/api/test")
+	_, err := fetchAPI[Dashboard](context.Background(), ts.URL + "/api/test")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "500")
 }
@@ -580,7 +723,7 @@ func TestFetchAPIRawError(t *testing.T) {
 	}
 
 	var result Dashboard
-	err := fetchAPIRaw(ts.URL+"/api/test", &result)
+	err := fetchAPIRaw(context.Background(), ts.URL+"/api/test", &result)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "404")
 }
@@ -604,10 +747,10 @@ func TestZipDirectory(t *testing.T) {
 
 func TestExportDashboardsHandler(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -644,7 +787,7 @@ func TestExportDashboardsHandler(t *testing.T) {
 		GrafanaAPIKey:   "test-key",
 		ExportDirectory: tempDir,
 	}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	body := `{"dashboardUIDs":["uid-export-1"],"alertUIDs":[],"includeAlerts":false,"exportAsZip":false}`
@@ -680,10 +823,10 @@ func TestExportDashboardsInvalidRequest(t *testing.T) {
 
 func TestGetFoldersHandler(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	callCount := 0
@@ -714,7 +857,7 @@ func TestGetFoldersHandler(t *testing.T) {
 		GrafanaURL:    ts.URL,
 		GrafanaAPIKey: "test-key",
 	}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodGet, "/api/folders", nil)
@@ -729,16 +872,17 @@ func TestGetFoldersHandler(t *testing.T) {
 	err = json.Unmarshal(rec.Body.Bytes(), &folders)
 	assert.NoError(t, err)
 	assert.Len(t, folders, 1)
+	assert.Equal(t, "1", rec.Header().Get("X-Total-Count"))
 	assert.Equal(t, "Folder A", folders[0].Title)
 	assert.Equal(t, 1, folders[0].DashboardCount)
 }
 
 func TestExportDashboardsWithAlerts(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -763,7 +907,7 @@ func TestExportDashboardsWithAlerts(t *testing.T) {
 		GrafanaAPIKey:   "test-key",
 		ExportDirectory: tempDir,
 	}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	body := `{"dashboardUIDs":[],"alertUIDs":["alert-1"],"includeAlerts":true,"exportAsZip":false}`
@@ -784,10 +928,10 @@ func TestExportDashboardsWithAlerts(t *testing.T) {
 
 func TestExportDashboardsAsZip(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -819,7 +963,7 @@ func TestExportDashboardsAsZip(t *testing.T) {
 		GrafanaAPIKey:   "test-key",
 		ExportDirectory: tempDir,
 	}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	body := `{"dashboardUIDs":["uid-zip-1"],"alertUIDs":[],"includeAlerts":false,"exportAsZip":true}`
@@ -863,10 +1007,10 @@ func TestCheckGrafanaConnectionFailure(t *testing.T) {
 
 func TestGetAlertsHandlerFallbackToLegacy(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -889,7 +1033,7 @@ func TestGetAlertsHandlerFallbackToLegacy(t *testing.T) {
 	defer ts.Close()
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "test-key"}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodGet, "/api/alerts", nil)
@@ -908,10 +1052,10 @@ func TestGetAlertsHandlerFallbackToLegacy(t *testing.T) {
 
 func TestGetAlertsHandlerBothFail(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -920,7 +1064,7 @@ func TestGetAlertsHandlerBothFail(t *testing.T) {
 	defer ts.Close()
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "test-key"}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodGet, "/api/alerts", nil)
@@ -942,10 +1086,10 @@ func TestExportLibraryElementWithFolder(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -974,11 +1118,11 @@ func TestExportLibraryElementWithFolder(t *testing.T) {
 	defer ts.Close()
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "test-key"}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	var count int
 	var errors []string
-	err = exportLibraryElement("lib-with-folder", tempDir, &count, &errors)
+	err = exportLibraryElement(context.Background(), "lib-with-folder", tempDir, &count, &errors)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, count)
 
@@ -993,10 +1137,10 @@ func TestExportLibraryElementCachedFolder(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1022,11 +1166,12 @@ func TestExportLibraryElementCachedFolder(t *testing.T) {
 	defer ts.Close()
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "test-key"}
-	folderCache = map[string]string{"cached-folder": "Cached Folder Name"}
+	metaCache = newMetadataCache(time.Minute)
+	cacheFolderTitle(context.Background(), "cached-folder", "Cached Folder Name")
 
 	var count int
 	var errors []string
-	err = exportLibraryElement("lib-cached", tempDir, &count, &errors)
+	err = exportLibraryElement(context.Background(), "lib-cached", tempDir, &count, &errors)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, count)
 }
@@ -1050,7 +1195,7 @@ func TestFetchAPIRawWithRetry(t *testing.T) {
 
 	// Should retry for /children URLs
 	var result []Folder
-	err := fetchAPIRaw(ts.URL+"/api/folders/abc/children", &result)
+	err := fetchAPIRaw(context.Background(), ts.URL+"/api/folders/abc/children", &result)
 	assert.NoError(t, err)
 	assert.Len(t, result, 1)
 	assert.Equal(t, 3, callCount)
@@ -1068,7 +1213,7 @@ func TestFetchAPIRawChildrenNotFound(t *testing.T) {
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "test-key"}
 
 	var result []Folder
-	err := fetchAPIRaw(ts.URL+"/api/folders/abc/children", &result)
+	err := fetchAPIRaw(context.Background(), ts.URL+"/api/folders/abc/children", &result)
 	assert.NoError(t, err)
 	assert.Empty(t, result)
 }
@@ -1086,16 +1231,16 @@ func TestFetchAPIRawEmptyResponse(t *testing.T) {
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "test-key"}
 
 	var result []Folder
-	err := fetchAPIRaw(ts.URL+"/api/test", &result)
+	err := fetchAPIRaw(context.Background(), ts.URL+"/api/test", &result)
 	assert.NoError(t, err)
 }
 
 func TestExportDashboardsWithLibraryPanels(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1142,7 +1287,7 @@ func TestExportDashboardsWithLibraryPanels(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "test-key", ExportDirectory: tempDir}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	body := `{"dashboardUIDs":["uid-with-lib"],"alertUIDs":[],"includeAlerts":false,"exportAsZip":false}`
@@ -1163,10 +1308,10 @@ func TestExportDashboardsWithLibraryPanels(t *testing.T) {
 
 func TestExportDashboardsWithFolder(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1194,7 +1339,7 @@ func TestExportDashboardsWithFolder(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "test-key", ExportDirectory: tempDir}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	body := `{"dashboardUIDs":["uid-folder"],"alertUIDs":[],"includeAlerts":false,"exportAsZip":false}`
@@ -1214,10 +1359,10 @@ func TestExportDashboardsWithFolder(t *testing.T) {
 
 func TestGetDashboardsWithFolderLookup(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1242,10 +1387,10 @@ func TestGetDashboardsWithFolderLookup(t *testing.T) {
 	defer ts.Close()
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "test-key"}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/api/dashboards", nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/dashboards?wait=true", nil)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
@@ -1284,7 +1429,7 @@ func TestFetchAPIRawWithTLSSkip(t *testing.T) {
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key", SkipTLSVerify: true}
 
 	var result map[string]string
-	err := fetchAPIRaw(ts.URL+"/api/test", &result)
+	err := fetchAPIRaw(context.Background(), ts.URL+"/api/test", &result)
 	assert.NoError(t, err)
 	assert.Equal(t, "ok", result["status"])
 }
@@ -1300,7 +1445,7 @@ func TestFetchAPIWithTLSSkip(t *testing.T) {
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key", SkipTLSVerify: true}
 
-	result, err := fetchAPI[Dashboard](ts.URL + "/api/test")
+	result, err := fetchAPI[Dashboard](context.Background(), ts.URL + "/api/test")
 	assert.NoError(t, err)
 	assert.Equal(t, "Test", result.Title)
 }
@@ -1325,10 +1470,10 @@ func TestExtractVersionNumberEdgeCases(t *testing.T) {
 
 func TestExportDashboardsFetchError(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1341,7 +1486,7 @@ func TestExportDashboardsFetchError(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key", ExportDirectory: tempDir}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	body := `{"dashboardUIDs":["nonexistent"],"alertUIDs":["nonexistent"],"includeAlerts":true,"exportAsZip":false}`
@@ -1363,7 +1508,11 @@ func TestExportDashboardsFetchError(t *testing.T) {
 
 func TestGetDashboardsAPIError(t *testing.T) {
 	originalConfig := config
-	defer func() { config = originalConfig }()
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "error", http.StatusInternalServerError)
@@ -1371,9 +1520,10 @@ func TestGetDashboardsAPIError(t *testing.T) {
 	defer ts.Close()
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/api/dashboards", nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/dashboards?wait=true", nil)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
@@ -1384,7 +1534,11 @@ func TestGetDashboardsAPIError(t *testing.T) {
 
 func TestGetFoldersAPIError(t *testing.T) {
 	originalConfig := config
-	defer func() { config = originalConfig }()
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "error", http.StatusInternalServerError)
@@ -1392,6 +1546,7 @@ func TestGetFoldersAPIError(t *testing.T) {
 	defer ts.Close()
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodGet, "/api/folders", nil)
@@ -1438,10 +1593,10 @@ func TestExportDashboardsBadJSON(t *testing.T) {
 
 func TestGetDashboardsWithCachedFolder(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1464,10 +1619,11 @@ func TestGetDashboardsWithCachedFolder(t *testing.T) {
 	defer ts.Close()
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
-	folderCache = map[string]string{"cached-f": "Pre-Cached Folder"}
+	metaCache = newMetadataCache(time.Minute)
+	cacheFolderTitle(context.Background(), "cached-f", "Pre-Cached Folder")
 
 	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/api/dashboards", nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/dashboards?wait=true", nil)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
@@ -1480,10 +1636,10 @@ func TestGetDashboardsWithCachedFolder(t *testing.T) {
 
 func TestGetDashboardsNoFolderUID(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1506,10 +1662,10 @@ func TestGetDashboardsNoFolderUID(t *testing.T) {
 	defer ts.Close()
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/api/dashboards", nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/dashboards?wait=true", nil)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
@@ -1522,10 +1678,10 @@ func TestGetDashboardsNoFolderUID(t *testing.T) {
 
 func TestGetFoldersWithNestedFolders(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1553,7 +1709,7 @@ func TestGetFoldersWithNestedFolders(t *testing.T) {
 	defer ts.Close()
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodGet, "/api/folders", nil)
@@ -1569,10 +1725,10 @@ func TestGetFoldersWithNestedFolders(t *testing.T) {
 
 func TestGetFoldersDashboardCountError(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	callCount := 0
@@ -1593,7 +1749,7 @@ func TestGetFoldersDashboardCountError(t *testing.T) {
 	defer ts.Close()
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key"}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodGet, "/api/folders", nil)
@@ -1606,10 +1762,10 @@ func TestGetFoldersDashboardCountError(t *testing.T) {
 
 func TestExportDashboardsNoTitle(t *testing.T) {
 	originalConfig := config
-	originalCache := folderCache
+	originalCache := metaCache
 	defer func() {
 		config = originalConfig
-		folderCache = originalCache
+		metaCache = originalCache
 	}()
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1636,7 +1792,7 @@ func TestExportDashboardsNoTitle(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	config = Config{GrafanaURL: ts.URL, GrafanaAPIKey: "key", ExportDirectory: tempDir}
-	folderCache = make(map[string]string)
+	metaCache = newMetadataCache(time.Minute)
 
 	e := echo.New()
 	body := `{"dashboardUIDs":["uid-notitle"],"alertUIDs":[],"includeAlerts":false,"exportAsZip":false}`
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the Grafana request
+// latency histogram.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// grafanaPathSegments are the fixed parts of Grafana API paths. Every other
+// segment is a UID, ID or version and is replaced by {id}, so that the
+// endpoint label stays bounded however many objects Grafana holds.
+var grafanaPathSegments = map[string]bool{
+	"api": true, "v1": true, "provisioning": true, "alert-rules": true, "alerts": true,
+	"dashboards": true, "uid": true, "id": true, "db": true, "versions": true, "restore": true,
+	"permissions": true, "folders": true, "children": true, "library-elements": true,
+	"connections": true, "search": true, "health": true, "user": true, "org": true, "orgs": true,
+	"users": true, "teams": true, "members": true, "serviceaccounts": true, "annotations": true,
+	"datasources": true, "playlists": true, "dashboard": true, "snapshots": true,
+	"public-dashboards": true, "query-history": true, "reports": true,
+}
+
+type histogram struct {
+	buckets []uint64 // cumulative counts per latencyBuckets bound
+	count   uint64
+	sum     float64
+}
+
+func (h *histogram) observe(value float64) {
+	if h.buckets == nil {
+		h.buckets = make([]uint64, len(latencyBuckets))
+	}
+	for i, bound := range latencyBuckets {
+		if value <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+type grafanaRequestKey struct {
+	method   string
+	endpoint string
+	status   string
+}
+
+// exporterMetrics collects the metrics served on /metrics in the Prometheus
+// text exposition format.
+type exporterMetrics struct {
+	mu sync.Mutex
+
+	grafanaRequests map[grafanaRequestKey]*histogram
+	exportRuns      map[string]uint64 // result -> runs
+	exportedObjects map[string]uint64 // kind -> objects
+	exportErrors    uint64
+	exportedBytes   uint64
+
+	lastExportSize       int64
+	lastSuccessfulExport time.Time
+}
+
+var metrics = newExporterMetrics()
+
+func newExporterMetrics() *exporterMetrics {
+	return &exporterMetrics{
+		grafanaRequests: make(map[grafanaRequestKey]*histogram),
+		exportRuns:      make(map[string]uint64),
+		exportedObjects: make(map[string]uint64),
+	}
+}
+
+// grafanaEndpoint turns a Grafana API path into a bounded label value, e.g.
+// /api/dashboards/uid/abc/versions/3 into /api/dashboards/uid/{id}/versions/{id}.
+// A sub-path Grafana is served under is dropped.
+func grafanaEndpoint(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if api := slices.Index(segments, "api"); api > 0 {
+		segments = segments[api:]
+	}
+	for i, segment := range segments {
+		if !grafanaPathSegments[segment] {
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func (m *exporterMetrics) ObserveGrafanaRequest(method, path, status string, duration time.Duration) {
+	key := grafanaRequestKey{method: method, endpoint: grafanaEndpoint(path), status: status}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.grafanaRequests[key]
+	if !ok {
+		h = &histogram{}
+		m.grafanaRequests[key] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// ObserveExport records a finished export from its audit entry. A run
+// succeeds when it answered 200 without per-object errors, is partial when
+// some objects failed, and fails otherwise.
+func (m *exporterMetrics) ObserveExport(entry *auditEntry) {
+	result := "success"
+	switch {
+	case entry.Status != http.StatusOK:
+		result = "failure"
+	case len(entry.Errors) > 0:
+		result = "partial"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.exportRuns[result]++
+	m.exportErrors += uint64(len(entry.Errors))
+	for kind, count := range entry.Counts {
+		m.exportedObjects[kind] += uint64(count)
+	}
+	if entry.SizeBytes > 0 {
+		m.exportedBytes += uint64(entry.SizeBytes)
+		m.lastExportSize = entry.SizeBytes
+	}
+	if result == "success" {
+		m.lastSuccessfulExport = entry.Time
+	}
+}
+
+// Expose writes every metric in the Prometheus text format.
+func (m *exporterMetrics) Expose(w io.Writer, cache cacheStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeHeader(w, "grafana_exporter_grafana_requests_total", "counter", "Grafana API requests by endpoint, method and status.")
+	keys := sortedRequestKeys(m.grafanaRequests)
+	for _, key := range keys {
+		fmt.Fprintf(w, "grafana_exporter_grafana_requests_total%s %d\n", key.labels(""), m.grafanaRequests[key].count)
+	}
+
+	writeHeader(w, "grafana_exporter_grafana_request_duration_seconds", "histogram", "Latency of Grafana API requests until the response headers arrived.")
+	for _, key := range keys {
+		h := m.grafanaRequests[key]
+		for i, bound := range latencyBuckets {
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			fmt.Fprintf(w, "grafana_exporter_grafana_request_duration_seconds_bucket%s %d\n", key.labels(le), h.buckets[i])
+		}
+		fmt.Fprintf(w, "grafana_exporter_grafana_request_duration_seconds_bucket%s %d\n", key.labels("+Inf"), h.count)
+		fmt.Fprintf(w, "grafana_exporter_grafana_request_duration_seconds_sum%s %g\n", key.labels(""), h.sum)
+		fmt.Fprintf(w, "grafana_exporter_grafana_request_duration_seconds_count%s %d\n", key.labels(""), h.count)
+	}
+
+	writeHeader(w, "grafana_exporter_export_runs_total", "counter", "Export runs by result: success, partial or failure.")
+	for _, result := range []string{"success", "partial", "failure"} {
+		fmt.Fprintf(w, "grafana_exporter_export_runs_total{result=%q} %d\n", result, m.exportRuns[result])
+	}
+
+	writeHeader(w, "grafana_exporter_exported_objects_total", "counter", "Objects written by exports, by kind.")
+	for _, kind := range sortedKeys(m.exportedObjects) {
+		fmt.Fprintf(w, "grafana_exporter_exported_objects_total{kind=%q} %d\n", kind, m.exportedObjects[kind])
+	}
+
+	writeHeader(w, "grafana_exporter_export_errors_total", "counter", "Objects that failed to export.")
+	fmt.Fprintf(w, "grafana_exporter_export_errors_total %d\n", m.exportErrors)
+
+	writeHeader(w, "grafana_exporter_exported_bytes_total", "counter", "Bytes written by exports.")
+	fmt.Fprintf(w, "grafana_exporter_exported_bytes_total %d\n", m.exportedBytes)
+
+	writeHeader(w, "grafana_exporter_last_export_size_bytes", "gauge", "Size of the most recent export.")
+	fmt.Fprintf(w, "grafana_exporter_last_export_size_bytes %d\n", m.lastExportSize)
+
+	writeHeader(w, "grafana_exporter_last_successful_export_timestamp_seconds", "gauge", "Unix time of the last export without errors, 0 if there was none.")
+	lastSuccess := int64(0)
+	if !m.lastSuccessfulExport.IsZero() {
+		lastSuccess = m.lastSuccessfulExport.Unix()
+	}
+	fmt.Fprintf(w, "grafana_exporter_last_successful_export_timestamp_seconds %d\n", lastSuccess)
+
+	writeHeader(w, "grafana_exporter_cache_hits_total", "counter", "Metadata cache hits.")
+	fmt.Fprintf(w, "grafana_exporter_cache_hits_total %d\n", cache.Hits)
+	writeHeader(w, "grafana_exporter_cache_misses_total", "counter", "Metadata cache misses.")
+	fmt.Fprintf(w, "grafana_exporter_cache_misses_total %d\n", cache.Misses)
+	writeHeader(w, "grafana_exporter_cache_entries", "gauge", "Live metadata cache entries by namespace.")
+	for _, namespace := range sortedKeys(cache.Namespaces) {
+		fmt.Fprintf(w, "grafana_exporter_cache_entries{namespace=%q} %d\n", namespace, cache.Namespaces[namespace])
+	}
+}
+
+func (k grafanaRequestKey) labels(le string) string {
+	labels := fmt.Sprintf("endpoint=%q,method=%q,status=%q", k.endpoint, k.method, k.status)
+	if le != "" {
+		labels += fmt.Sprintf(",le=%q", le)
+	}
+	return "{" + labels + "}"
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sortedRequestKeys(requests map[grafanaRequestKey]*histogram) []grafanaRequestKey {
+	keys := make([]grafanaRequestKey, 0, len(requests))
+	for key := range requests {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b grafanaRequestKey) int {
+		return strings.Compare(a.endpoint+" "+a.method+" "+a.status, b.endpoint+" "+b.method+" "+b.status)
+	})
+	return keys
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func getMetrics(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	metrics.Expose(c.Response(), metaCache.Stats())
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrafanaEndpoint(t *testing.T) {
+	assert.Equal(t, "/api/search", grafanaEndpoint("/api/search"))
+	assert.Equal(t, "/api/dashboards/uid/{id}/versions/{id}", grafanaEndpoint("/api/dashboards/uid/abc123/versions/7"))
+	assert.Equal(t, "/api/v1/provisioning/alert-rules/{id}", grafanaEndpoint("/api/v1/provisioning/alert-rules/rule-1"))
+	assert.Equal(t, "/api/folders/{id}", grafanaEndpoint("/grafana/api/folders/f1"))
+
+	// Every endpoint keeps a label of its own
+	for _, path := range []string{
+		"/api/orgs", "/api/user/orgs", "/api/org/users", "/api/teams/search", "/api/serviceaccounts/search",
+		"/api/annotations", "/api/datasources", "/api/playlists", "/api/dashboard/snapshots", "/api/query-history",
+		"/api/reports", "/api/dashboards/public-dashboards", "/api/dashboards/db",
+	} {
+		assert.Equal(t, path, grafanaEndpoint(path))
+	}
+	for path, endpoint := range map[string]string{
+		"/api/teams/5/members":                         "/api/teams/{id}/members",
+		"/api/teams/5":                                 "/api/teams/{id}",
+		"/api/folders/ops/permissions":                 "/api/folders/{id}/permissions",
+		"/api/dashboards/uid/dash-1/permissions":       "/api/dashboards/uid/{id}/permissions",
+		"/api/dashboards/uid/dash-1/restore":           "/api/dashboards/uid/{id}/restore",
+		"/api/dashboards/id/11/versions":               "/api/dashboards/id/{id}/versions",
+		"/api/dashboards/uid/dash-1/public-dashboards": "/api/dashboards/uid/{id}/public-dashboards",
+		"/api/library-elements/lib-cpu/connections":    "/api/library-elements/{id}/connections",
+		"/api/playlists/pl-1":                          "/api/playlists/{id}",
+		"/api/snapshots/snap-key":                      "/api/snapshots/{id}",
+		"/api/reports/3":                               "/api/reports/{id}",
+	} {
+		assert.Equal(t, endpoint, grafanaEndpoint(path), path)
+	}
+}
+
+func TestMetricsExposition(t *testing.T) {
+	m := newExporterMetrics()
+	m.ObserveGrafanaRequest(http.MethodGet, "/api/dashboards/uid/a", "200", 30*time.Millisecond)
+	m.ObserveGrafanaRequest(http.MethodGet, "/api/dashboards/uid/b", "200", 3*time.Second)
+	m.ObserveGrafanaRequest(http.MethodGet, "/api/search", "error", time.Millisecond)
+
+	success := time.Unix(1780000000, 0)
+	m.ObserveExport(&auditEntry{Time: success, Status: http.StatusOK, Counts: map[string]int{"dashboards": 3, "alerts": 1}, SizeBytes: 2048})
+	m.ObserveExport(&auditEntry{Time: success.Add(time.Hour), Status: http.StatusOK, Counts: map[string]int{"dashboards": 1}, Errors: []string{"boom"}})
+	m.ObserveExport(&auditEntry{Status: http.StatusBadRequest})
+
+	var out bytes.Buffer
+	m.Expose(&out, cacheStats{Hits: 5, Misses: 2, Namespaces: map[string]int{cacheFolders: 4}})
+	text := out.String()
+
+	for _, line := range []string{
+		`grafana_exporter_grafana_requests_total{endpoint="/api/dashboards/uid/{id}",method="GET",status="200"} 2`,
+		`grafana_exporter_grafana_requests_total{endpoint="/api/search",method="GET",status="error"} 1`,
+		`grafana_exporter_grafana_request_duration_seconds_bucket{endpoint="/api/dashboards/uid/{id}",method="GET",status="200",le="0.05"} 1`,
+		`grafana_exporter_grafana_request_duration_seconds_bucket{endpoint="/api/dashboards/uid/{id}",method="GET",status="200",le="+Inf"} 2`,
+		`grafana_exporter_export_runs_total{result="success"} 1`,
+		`grafana_exporter_export_runs_total{result="partial"} 1`,
+		`grafana_exporter_export_runs_total{result="failure"} 1`,
+		`grafana_exporter_exported_objects_total{kind="dashboards"} 4`,
+		`grafana_exporter_export_errors_total 1`,
+		`grafana_exporter_last_export_size_bytes 2048`,
+		`grafana_exporter_last_successful_export_timestamp_seconds 1780000000`,
+		`grafana_exporter_cache_hits_total 5`,
+		`grafana_exporter_cache_entries{namespace="folders"} 4`,
+		`# TYPE grafana_exporter_grafana_request_duration_seconds histogram`,
+	} {
+		assert.Contains(t, text, line+"\n")
+	}
+}
+
+func TestFetchAPIRecordsMetrics(t *testing.T) {
+	originalConfig := config
+	originalMetrics := metrics
+	defer func() {
+		config = originalConfig
+		metrics = originalMetrics
+	}()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	config = Config{GrafanaURL: ts.URL}
+	metrics = newExporterMetrics()
+
+	_, err := fetchAPI[Folder](context.Background(), ts.URL+"/api/folders/missing")
+	assert.Error(t, err)
+
+	e := echo.New()
+	e.GET("/metrics", getMetrics)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), "text/plain"))
+	assert.Contains(t, rec.Body.String(), `grafana_exporter_grafana_requests_total{endpoint="/api/folders/{id}",method="GET",status="404"} 1`)
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// queryHistoryPageLimit is how many queries are asked for per request.
+const queryHistoryPageLimit = 100
+
+// grafanaObject is an object of one of the objectKinds as it is listed. The
+// UID is whatever the kind's endpoints address it by.
+type grafanaObject struct {
+	UID          string `json:"uid"`
+	Name         string `json:"name"`
+	DashboardUID string `json:"dashboardUid,omitempty"` // Dashboard the object belongs to, if any
+	Updated      string `json:"updated,omitempty"`
+
+	// model is the object as exported, for kinds whose listing already
+	// holds all of it
+	model interface{}
+}
+
+// objectKind is a type of Grafana object besides dashboards, library panels
+// and alerts. Each kind has its own list endpoint, /api/<Name>, and its own
+// subdirectory of an export.
+type objectKind struct {
+	Name      string
+	Directory string
+	Role      string // Needed to list them; viewer when empty
+	Available func(grafanaAPI) bool
+	List      func(ctx context.Context) ([]grafanaObject, error)
+	// Fetch returns the model to export; nil kinds export the listed model
+	Fetch func(ctx context.Context, object grafanaObject, refs *dashboardRefs) (interface{}, error)
+}
+
+var objectKinds = []objectKind{
+	{
+		Name:      "playlists",
+		Directory: "Playlists",
+		List:      listPlaylists,
+		Fetch:     fetchPlaylist,
+	},
+	{
+		Name:      "snapshots",
+		Directory: "Snapshots",
+		// The key is the secret of the snapshot's unauthenticated URL
+		Role: roleExporter,
+		List: listSnapshots,
+		Fetch: func(ctx context.Context, object grafanaObject, refs *dashboardRefs) (interface{}, error) {
+			var snapshot map[string]interface{}
+			err := fetchAPIRaw(ctx, currentConfig().GrafanaURL+"/api/snapshots/"+url.PathEscape(object.UID), &snapshot)
+			return snapshot, err
+		},
+	},
+	{
+		Name:      "public-dashboards",
+		Directory: "Public dashboards",
+		Available: grafanaAPI.PublicDashboards,
+		List:      listPublicDashboards,
+		Fetch:     fetchPublicDashboard,
+	},
+	{
+		Name:      "query-history",
+		Directory: "Query history",
+		Available: grafanaAPI.QueryHistory,
+		List:      listStarredQueries,
+	},
+	{
+		Name:      "reports",
+		Directory: "Reports",
+		List:      listReports,
+		Fetch: func(ctx context.Context, object grafanaObject, refs *dashboardRefs) (interface{}, error) {
+			var report map[string]interface{}
+			err := fetchAPIRaw(ctx, currentConfig().GrafanaURL+"/api/reports/"+url.PathEscape(object.UID), &report)
+			return report, err
+		},
+	},
+}
+
+func findObjectKind(name string) (objectKind, bool) {
+	for _, kind := range objectKinds {
+		if kind.Name == name {
+			return kind, true
+		}
+	}
+	return objectKind{}, false
+}
+
+// role returns the role needed to list the objects of a kind.
+func (k objectKind) role() string {
+	if k.Role == "" {
+		return roleViewer
+	}
+	return k.Role
+}
+
+// listObjects lists the objects of a kind. Kinds the Grafana edition or
+// version does not have are reported as an empty list with available false.
+func (k objectKind) listObjects(ctx context.Context) ([]grafanaObject, bool, error) {
+	if k.Available != nil && !k.Available(currentGrafanaAPI()) {
+		return []grafanaObject{}, false, nil
+	}
+
+	objects, err := k.List(ctx)
+	if isGrafanaNotFound(err) {
+		return []grafanaObject{}, false, nil
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	return objects, true, nil
+}
+
+// objectsHandler serves /api/<kind>.
+func (k objectKind) objectsHandler(c echo.Context) error {
+	objects, available, err := k.listObjects(c.Request().Context())
+	if err != nil {
+		log.Printf("Warning: Could not list %s: %v", k.Name, err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("Could not list %s: %v", k.Name, err)})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"available": available,
+		k.Name:      objects,
+	})
+}
+
+// exportObjects writes the objects of a kind with the given UIDs, or all
+// of them when uids is nil, to the kind's directory below exportPath.
+func (k objectKind) exportObjects(ctx context.Context, exportPath string, uids []string, refs *dashboardRefs, result *exportResult) {
+	objects, available, err := k.listObjects(ctx)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to list %s: %v", k.Name, err))
+		return
+	}
+	if !available {
+		if uids != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Grafana %s has no %s", currentGrafanaAPI(), k.Name))
+		}
+		return
+	}
+
+	dir := filepath.Join(exportPath, k.Directory)
+	written := make(map[string]bool)
+	for _, object := range objects {
+		if uids != nil && !slices.Contains(uids, object.UID) {
+			continue
+		}
+
+		model := object.model
+		if k.Fetch != nil {
+			model, err = k.Fetch(ctx, object, refs)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("Failed to fetch %s %s: %v", k.Name, object.UID, err))
+				continue
+			}
+		}
+
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to create %s folder: %v", k.Directory, err))
+			return
+		}
+		// Names need not be unique; later objects of the same name get
+		// their UID appended
+		name := sanitizePath(object.Name)
+		if name == "" || written[name] {
+			name = sanitizePath(object.Name + " " + object.UID)
+		}
+		written[name] = true
+
+		path, err := safePath(dir, name+".json")
+		if err == nil {
+			var data []byte
+			data, err = json.MarshalIndent(model, "", "  ")
+			if err == nil {
+				err = os.WriteFile(path, data, 0644)
+			}
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to write %s %s: %v", k.Name, object.UID, err))
+			continue
+		}
+
+		if result.ExportedObjects == nil {
+			result.ExportedObjects = make(map[string]int)
+		}
+		result.ExportedObjects[k.Name]++
+	}
+}
+
+// dashboardRefs maps dashboard IDs to UIDs for objects that still refer to
+// dashboards by ID. The dashboards are only listed when first needed.
+type dashboardRefs struct {
+	ctx  context.Context
+	uids map[int]string
+	err  error
+}
+
+func newDashboardRefs(ctx context.Context) *dashboardRefs {
+	return &dashboardRefs{ctx: ctx}
+}
+
+func (r *dashboardRefs) uid(id int) (string, error) {
+	if r.uids == nil && r.err == nil {
+		dashboards, err := fetchAllDashboards(r.ctx)
+		if err != nil {
+			r.err = err
+		} else {
+			r.uids = make(map[int]string, len(dashboards))
+			for _, dash := range dashboards {
+				r.uids[dash.ID] = dash.UID
+			}
+		}
+	}
+	if r.err != nil {
+		return "", r.err
+	}
+	uid, ok := r.uids[id]
+	if !ok {
+		return "", fmt.Errorf("no dashboard with ID %d", id)
+	}
+	return uid, nil
+}
+
+func listPlaylists(ctx context.Context) ([]grafanaObject, error) {
+	var playlists []struct {
+		ID   int    `json:"id"`
+		UID  string `json:"uid"`
+		Name string `json:"name"`
+	}
+	if err := fetchAPIRaw(ctx, currentConfig().GrafanaURL+"/api/playlists", &playlists); err != nil {
+		return nil, err
+	}
+
+	objects := make([]grafanaObject, 0, len(playlists))
+	for _, playlist := range playlists {
+		// Playlists have UIDs from Grafana 9.1, IDs before
+		uid := playlist.UID
+		if uid == "" {
+			uid = strconv.Itoa(playlist.ID)
+		}
+		objects = append(objects, grafanaObject{UID: uid, Name: playlist.Name})
+	}
+	return objects, nil
+}
+
+// fetchPlaylist returns a playlist with its dashboards referred to by UID,
+// so that it can be recreated where the dashboards have other IDs.
+func fetchPlaylist(ctx context.Context, object grafanaObject, refs *dashboardRefs) (interface{}, error) {
+	var playlist map[string]interface{}
+	if err := fetchAPIRaw(ctx, currentConfig().GrafanaURL+"/api/playlists/"+url.PathEscape(object.UID), &playlist); err != nil {
+		return nil, err
+	}
+	delete(playlist, "id")
+
+	items, _ := playlist["items"].([]interface{})
+	for _, entry := range items {
+		item, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		delete(item, "id")
+		delete(item, "playlistId")
+		if item["type"] != "dashboard_by_id" {
+			continue
+		}
+
+		var id int
+		switch value := item["value"].(type) {
+		case string:
+			id, _ = strconv.Atoi(value)
+		case float64:
+			id = int(value)
+		}
+		uid, err := refs.uid(id)
+		if err != nil {
+			return nil, fmt.Errorf("dashboard %v of the playlist: %v", item["value"], err)
+		}
+		item["type"] = "dashboard_by_uid"
+		item["value"] = uid
+	}
+	return playlist, nil
+}
+
+func listSnapshots(ctx context.Context) ([]grafanaObject, error) {
+	var snapshots []struct {
+		Key     string `json:"key"`
+		Name    string `json:"name"`
+		Updated string `json:"updated"`
+	}
+	if err := fetchAPIRaw(ctx, currentConfig().GrafanaURL+"/api/dashboard/snapshots", &snapshots); err != nil {
+		return nil, err
+	}
+
+	objects := make([]grafanaObject, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		objects = append(objects, grafanaObject{UID: snapshot.Key, Name: snapshot.Name, Updated: snapshot.Updated})
+	}
+	return objects, nil
+}
+
+// listPublicDashboards lists the public dashboard configurations. Grafana
+// 10.2 pages the listing; earlier versions answer with a plain array.
+func listPublicDashboards(ctx context.Context) ([]grafanaObject, error) {
+	type publicDashboard struct {
+		UID          string `json:"uid"`
+		Title        string `json:"title"`
+		DashboardUID string `json:"dashboardUid"`
+	}
+
+	var listed []publicDashboard
+	for page := 1; ; page++ {
+		var raw json.RawMessage
+		pageURL := fmt.Sprintf("%s/api/dashboards/public-dashboards?perpage=%d&page=%d", currentConfig().GrafanaURL, identityPerPage, page)
+		if err := fetchAPIRaw(ctx, pageURL, &raw); err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			if err := json.Unmarshal(raw, &listed); err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		var paged struct {
+			PublicDashboards []publicDashboard `json:"publicDashboards"`
+			TotalCount       int               `json:"totalCount"`
+		}
+		if err := json.Unmarshal(raw, &paged); err != nil {
+			return nil, err
+		}
+		listed = append(listed, paged.PublicDashboards...)
+		if len(paged.PublicDashboards) == 0 || len(listed) >= paged.TotalCount {
+			break
+		}
+	}
+
+	objects := make([]grafanaObject, 0, len(listed))
+	for _, public := range listed {
+		objects = append(objects, grafanaObject{UID: public.UID, Name: public.Title, DashboardUID: public.DashboardUID})
+	}
+	return objects, nil
+}
+
+// fetchPublicDashboard returns the configuration of a public dashboard
+// without its access token, which is the secret part of its public URL.
+func fetchPublicDashboard(ctx context.Context, object grafanaObject, refs *dashboardRefs) (interface{}, error) {
+	var public map[string]interface{}
+	configURL := fmt.Sprintf("%s/api/dashboards/uid/%s/public-dashboards", currentConfig().GrafanaURL, url.PathEscape(object.DashboardUID))
+	if err := fetchAPIRaw(ctx, configURL, &public); err != nil {
+		return nil, err
+	}
+	delete(public, "accessToken")
+	return public, nil
+}
+
+// listStarredQueries lists the starred queries of the query history, which
+// is Grafana's way of saving queries. Query history is kept per user, so
+// service account tokens have none.
+func listStarredQueries(ctx context.Context) ([]grafanaObject, error) {
+	objects := []grafanaObject{}
+	for page := 1; ; page++ {
+		var response struct {
+			Result struct {
+				TotalCount   int                      `json:"totalCount"`
+				QueryHistory []map[string]interface{} `json:"queryHistory"`
+			} `json:"result"`
+		}
+		pageURL := fmt.Sprintf("%s/api/query-history?onlyStarred=true&limit=%d&page=%d", currentConfig().GrafanaURL, queryHistoryPageLimit, page)
+		if err := fetchAPIRaw(ctx, pageURL, &response); err != nil {
+			return nil, err
+		}
+
+		for _, query := range response.Result.QueryHistory {
+			uid, _ := query["uid"].(string)
+			name, _ := query["comment"].(string)
+			if name == "" {
+				name = "Query " + uid
+			}
+			objects = append(objects, grafanaObject{UID: uid, Name: name, model: query})
+		}
+		if len(response.Result.QueryHistory) == 0 || len(objects) >= response.Result.TotalCount {
+			return objects, nil
+		}
+	}
+}
+
+// listReports lists the scheduled reports of Grafana Enterprise and Cloud.
+func listReports(ctx context.Context) ([]grafanaObject, error) {
+	var reports []struct {
+		ID      int    `json:"id"`
+		Name    string `json:"name"`
+		Updated string `json:"updated"`
+	}
+	if err := fetchAPIRaw(ctx, currentConfig().GrafanaURL+"/api/reports", &reports); err != nil {
+		return nil, err
+	}
+
+	objects := make([]grafanaObject, 0, len(reports))
+	for _, report := range reports {
+		objects = append(objects, grafanaObject{UID: strconv.Itoa(report.ID), Name: report.Name, Updated: report.Updated})
+	}
+	return objects, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var objectsTestRoutes = map[string]any{
+	"/api/search":    `[{"id":11,"uid":"dash-1","title":"Service","type":"dash-db"}]`,
+	"/api/playlists": `[{"id":1,"uid":"pl-1","name":"NOC"},{"id":2,"uid":"pl-2","name":"NOC"}]`,
+	"/api/playlists/pl-1": `{"id":1,"uid":"pl-1","name":"NOC","interval":"5m","items":[
+		{"id":7,"playlistId":1,"type":"dashboard_by_id","value":"11"},
+		{"id":8,"playlistId":1,"type":"dashboard_by_tag","value":"prod"}
+	]}`,
+	"/api/playlists/pl-2":      `{"id":2,"uid":"pl-2","name":"NOC","interval":"1m","items":[]}`,
+	"/api/dashboard/snapshots": `[{"key":"snap-key","name":"Outage","updated":"2026-10-01T00:00:00Z"}]`,
+	"/api/snapshots/snap-key":  `{"dashboard":{"title":"Outage"},"meta":{"isSnapshot":true}}`,
+	// Paged like Grafana 10.2, one per page
+	"/api/dashboards/public-dashboards?page=1":     `{"publicDashboards":[{"uid":"pub-1","title":"Service","dashboardUid":"dash-1"}],"totalCount":2}`,
+	"/api/dashboards/public-dashboards?page=2":     `{"publicDashboards":[{"uid":"pub-2","title":"Other","dashboardUid":"dash-2"}],"totalCount":2}`,
+	"/api/dashboards/uid/dash-1/public-dashboards": `{"uid":"pub-1","dashboardUid":"dash-1","accessToken":"secret-token","isEnabled":true}`,
+	"/api/query-history":                           `{"result":{"totalCount":1,"queryHistory":[{"uid":"q-1","comment":"Error rate","starred":true,"queries":[{"expr":"rate(errors[5m])"}]}]}}`,
+}
+
+func TestObjectsHandler(t *testing.T) {
+	grafana := newFakeGrafana(objectsTestRoutes)
+	defer grafana.Close()
+
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	config = Config{GrafanaURL: grafana.URL}
+
+	e := echo.New()
+	for _, kind := range objectKinds {
+		e.GET("/api/"+kind.Name, kind.objectsHandler)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/public-dashboards", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var public struct {
+		Available        bool            `json:"available"`
+		PublicDashboards []grafanaObject `json:"public-dashboards"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &public))
+	assert.True(t, public.Available)
+	assert.Equal(t, []grafanaObject{
+		{UID: "pub-1", Name: "Service", DashboardUID: "dash-1"},
+		{UID: "pub-2", Name: "Other", DashboardUID: "dash-2"},
+	}, public.PublicDashboards)
+
+	// Reports only exist in Grafana Enterprise
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/reports", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"available":false,"reports":[]}`, rec.Body.String())
+}
+
+func TestSnapshotKeysNeedExporterRole(t *testing.T) {
+	grafana := newFakeGrafana(objectsTestRoutes)
+	defer grafana.Close()
+
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	e, _ := newAuthTestServer(t, Config{
+		AuthBasicUsers: "viewer:pass,exporter:pass",
+		AuthUserRoles:  "exporter:exporter",
+	})
+	config = Config{GrafanaURL: grafana.URL}
+	for _, kind := range objectKinds {
+		e.GET("/api/"+kind.Name, kind.objectsHandler, requireRole(kind.role()))
+	}
+
+	request := func(target, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.SetBasicAuth(user, "pass")
+		return serve(e, req)
+	}
+
+	rec := request("/api/snapshots", "viewer")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "snap-key")
+	assert.Equal(t, http.StatusOK, request("/api/playlists", "viewer").Code)
+
+	rec = request("/api/snapshots", "exporter")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "snap-key")
+}
+
+func TestExportObjects(t *testing.T) {
+	grafana := newFakeGrafana(objectsTestRoutes)
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: grafana.URL, ExportDirectory: t.TempDir()}
+	metaCache = newMetadataCache(time.Minute)
+
+	e := echo.New()
+	body := `{"objects":{
+		"playlists":["pl-1","pl-2"],
+		"snapshots":["snap-key"],
+		"public-dashboards":["pub-1"],
+		"query-history":["q-1"]
+	}}`
+	req := httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, exportDashboards(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var result exportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, map[string]int{"playlists": 2, "snapshots": 1, "public-dashboards": 1, "query-history": 1}, result.ExportedObjects)
+
+	readObject := func(path ...string) map[string]interface{} {
+		data, err := os.ReadFile(filepath.Join(append([]string{result.ExportPath}, path...)...))
+		assert.NoError(t, err)
+		var object map[string]interface{}
+		json.Unmarshal(data, &object)
+		return object
+	}
+
+	// Dashboards are referred to by UID, and playlists of the same name kept apart
+	playlist := readObject("Playlists", "NOC.json")
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "dashboard_by_uid", "value": "dash-1"},
+		map[string]interface{}{"type": "dashboard_by_tag", "value": "prod"},
+	}, playlist["items"])
+	assert.NotContains(t, playlist, "id")
+	assert.Equal(t, "1m", readObject("Playlists", "NOC pl-2.json")["interval"])
+
+	assert.Equal(t, true, readObject("Snapshots", "Outage.json")["meta"].(map[string]interface{})["isSnapshot"])
+	public := readObject("Public dashboards", "Service.json")
+	assert.Equal(t, "dash-1", public["dashboardUid"])
+	assert.NotContains(t, public, "accessToken")
+	assert.Equal(t, "q-1", readObject("Query history", "Error rate.json")["uid"])
+}
+
+func TestExportObjectsUnknownKind(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(`{"objects":{"alert-silences":["x"]}}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, exportDashboards(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
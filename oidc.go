@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	oidcStateTTL = 10 * time.Minute
+	// oidcStateCookieName binds a login to the browser that started it
+	oidcStateCookieName = "exporter_oidc_state"
+)
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type oidcPendingLogin struct {
+	codeVerifier string
+	expiresAt    time.Time
+}
+
+// oidcProvider implements the OpenID Connect authorization code flow with
+// PKCE. The ID token is received directly from the token endpoint over the
+// back channel, so its claims are trusted after checking issuer, audience
+// and expiry, as allowed by OpenID Connect Core section 3.1.3.7.
+type oidcProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       string
+	client       *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	pending   map[string]oidcPendingLogin // state -> login in progress
+}
+
+func newOIDCProvider(cfg Config) *oidcProvider {
+	scopes := cfg.OIDCScopes
+	if scopes == "" {
+		scopes = "openid profile email"
+	}
+
+	return &oidcProvider{
+		issuer:       strings.TrimSuffix(cfg.OIDCIssuerURL, "/"),
+		clientID:     cfg.OIDCClientID,
+		clientSecret: cfg.OIDCClientSecret,
+		redirectURL:  cfg.OIDCRedirectURL,
+		scopes:       scopes,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		pending:      make(map[string]oidcPendingLogin),
+	}
+}
+
+// discover loads the provider metadata on first use, so that the exporter
+// can start while the identity provider is unavailable.
+func (p *oidcProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	resp, err := p.client.Get(p.issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("OIDC discovery returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var discovery oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery decode error: %v", err)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" {
+		return nil, fmt.Errorf("OIDC discovery document is missing endpoints")
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// AuthCodeURL starts a login and returns the URL to send the browser to,
+// and the state that identifies the login.
+func (p *oidcProvider) AuthCodeURL() (string, string, error) {
+	discovery, err := p.discover()
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString(48)
+	if err != nil {
+		return "", "", err
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	for existing, login := range p.pending {
+		if now.After(login.expiresAt) {
+			delete(p.pending, existing)
+		}
+	}
+	p.pending[state] = oidcPendingLogin{codeVerifier: verifier, expiresAt: now.Add(oidcStateTTL)}
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {p.scopes},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), state, nil
+}
+
+// Exchange completes a login: it checks the state, redeems the code and
+// returns the user described by the ID token and userinfo claims.
+func (p *oidcProvider) Exchange(state, code string) (*User, *oidcTokenResponse, error) {
+	p.mu.Lock()
+	login, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+
+	if !ok || time.Now().After(login.expiresAt) {
+		return nil, nil, fmt.Errorf("unknown or expired login state")
+	}
+
+	discovery, err := p.discover()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.clientID},
+		"code_verifier": {login.codeVerifier},
+	}
+	if p.clientSecret != "" {
+		form.Set("client_secret", p.clientSecret)
+	}
+
+	resp, err := p.client.PostForm(discovery.TokenEndpoint, form)
+	if err != nil {
+		return nil, nil, fmt.Errorf("token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, nil, fmt.Errorf("token endpoint returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tokens oidcTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, nil, fmt.Errorf("token response decode error: %v", err)
+	}
+
+	claims := make(map[string]interface{})
+	if tokens.IDToken != "" {
+		idClaims, err := p.verifyIDTokenClaims(discovery, tokens.IDToken)
+		if err != nil {
+			return nil, nil, err
+		}
+		claims = idClaims
+	}
+
+	if discovery.UserinfoEndpoint != "" && tokens.AccessToken != "" {
+		userinfo, err := p.fetchUserinfo(discovery.UserinfoEndpoint, tokens.AccessToken)
+		if err != nil {
+			return nil, nil, err
+		}
+		for key, value := range userinfo {
+			claims[key] = value
+		}
+	}
+
+	user := userFromClaims(claims)
+	if user.Name == "" {
+		return nil, nil, fmt.Errorf("identity provider returned no usable user name")
+	}
+	return user, &tokens, nil
+}
+
+func (p *oidcProvider) verifyIDTokenClaims(discovery *oidcDiscovery, idToken string) (map[string]interface{}, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed ID token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID token payload: %v", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed ID token claims: %v", err)
+	}
+
+	expectedIssuer := discovery.Issuer
+	if expectedIssuer == "" {
+		expectedIssuer = p.issuer
+	}
+	if issuer, _ := claims["iss"].(string); strings.TrimSuffix(issuer, "/") != strings.TrimSuffix(expectedIssuer, "/") {
+		return nil, fmt.Errorf("ID token issuer %q does not match %q", issuer, expectedIssuer)
+	}
+
+	if !claimContains(claims["aud"], p.clientID) {
+		return nil, fmt.Errorf("ID token audience does not contain client %q", p.clientID)
+	}
+
+	if exp, ok := claims["exp"].(float64); !ok || time.Now().After(time.Unix(int64(exp), 0)) {
+		return nil, fmt.Errorf("ID token is expired")
+	}
+
+	return claims, nil
+}
+
+func (p *oidcProvider) fetchUserinfo(endpoint, accessToken string) (map[string]interface{}, error) {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("userinfo request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("userinfo endpoint returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var claims map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("userinfo decode error: %v", err)
+	}
+	return claims, nil
+}
+
+func userFromClaims(claims map[string]interface{}) *User {
+	user := &User{Provider: "oidc"}
+
+	for _, key := range []string{"preferred_username", "name", "email", "sub"} {
+		if value, ok := claims[key].(string); ok && value != "" {
+			user.Name = value
+			break
+		}
+	}
+	user.Email, _ = claims["email"].(string)
+
+	if groups, ok := claims["groups"].([]interface{}); ok {
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				user.Groups = append(user.Groups, name)
+			}
+		}
+	}
+
+	return user
+}
+
+// claimContains reports whether a string-or-array claim contains value.
+func claimContains(claim interface{}, value string) bool {
+	switch typed := claim.(type) {
+	case string:
+		return typed == value
+	case []interface{}:
+		for _, item := range typed {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *authenticator) oidcLogin(c echo.Context) error {
+	target, state, err := a.oidc.AuthCodeURL()
+	if err != nil {
+		log.Printf("Warning: Could not start OIDC login: %v", err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state,
+		Path:     "/auth/",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Request().TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return c.Redirect(http.StatusFound, target)
+}
+
+func (a *authenticator) oidcCallback(c echo.Context) error {
+	if errorCode := c.QueryParam("error"); errorCode != "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{
+			"error": fmt.Sprintf("Login failed: %s %s", errorCode, c.QueryParam("error_description")),
+		})
+	}
+
+	// Only the browser that started the login may complete it, so that a
+	// callback URL handed to someone else does not log them in
+	state := c.QueryParam("state")
+	cookie, err := c.Cookie(oidcStateCookieName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		log.Printf("Warning: OIDC callback without the state cookie of its login")
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Login failed: the login was not started in this browser"})
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    "",
+		Path:     "/auth/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	user, tokens, err := a.oidc.Exchange(state, c.QueryParam("code"))
+	if err != nil {
+		log.Printf("Warning: OIDC login failed: %v", err)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Login failed: " + err.Error()})
+	}
+
+	if a.passThrough {
+		if err := a.attachGrafanaToken(c.Request().Context(), user, tokens); err != nil {
+			log.Printf("Warning: OIDC login of %s failed: %v", user.Name, err)
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Login failed: " + err.Error()})
+		}
+	}
+
+	if err := a.startSession(c, user); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create session"})
+	}
+
+	log.Printf("User %s logged in via OIDC", user.Name)
+	return c.Redirect(http.StatusFound, "/")
+}
+
+// attachGrafanaToken keeps the user's OIDC token so that Grafana is called as
+// the user. Grafana must accept the token, typically through its JWT
+// authentication with header_name = Authorization; this is checked at login
+// so that a misconfiguration fails here rather than on every request.
+func (a *authenticator) attachGrafanaToken(ctx context.Context, user *User, tokens *oidcTokenResponse) error {
+	token := tokens.AccessToken
+	if a.oidcTokenType == "id_token" {
+		token = tokens.IDToken
+	}
+	if token == "" {
+		return fmt.Errorf("identity provider returned no %s to forward to Grafana", a.oidcTokenType)
+	}
+
+	creds := &grafanaCredentials{token: token}
+	if tokens.ExpiresIn > 0 {
+		creds.expiresAt = time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second)
+	}
+	if _, err := verifyGrafanaCredentials(ctx, creds); err != nil {
+		return err
+	}
+
+	user.grafana = creds
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Organization is a Grafana organization.
+type Organization struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// getOrganizations lists the organizations the exporter can export from.
+func getOrganizations(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	orgs, err := fetchOrganizations(ctx)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("Could not list organizations: %v", err)})
+	}
+	current, err := fetchOrganization(ctx)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("Could not read the current organization: %v", err)})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"organizations": orgs, "currentOrgId": current.ID})
+}
+
+// fetchOrganizations returns every organization of the Grafana server when
+// the credentials belong to a server admin, otherwise the organizations of
+// the signed-in user, or just the current one for service account tokens.
+// Organizations with their own token in GRAFANA_ORG_API_KEYS are added.
+func fetchOrganizations(ctx context.Context) ([]Organization, error) {
+	grafanaURL := currentConfig().GrafanaURL
+
+	orgs, err := fetchAPI[[]Organization](ctx, grafanaURL+"/api/orgs")
+	if err != nil {
+		var userOrgs []struct {
+			OrgID int    `json:"orgId"`
+			Name  string `json:"name"`
+		}
+		if userErr := fetchAPIRaw(ctx, grafanaURL+"/api/user/orgs", &userOrgs); userErr == nil && len(userOrgs) > 0 {
+			orgs = make([]Organization, 0, len(userOrgs))
+			for _, org := range userOrgs {
+				orgs = append(orgs, Organization{ID: org.OrgID, Name: org.Name})
+			}
+		} else {
+			current, err := fetchOrganization(ctx)
+			if err != nil {
+				return nil, err
+			}
+			orgs = []Organization{current}
+		}
+	}
+
+	if grafanaCredentialsFrom(ctx) == nil {
+		orgKeys, _ := parseOrgKeyList(currentConfig().GrafanaOrgAPIKeys)
+		for orgID := range orgKeys {
+			if slices.ContainsFunc(orgs, func(org Organization) bool { return org.ID == orgID }) {
+				continue
+			}
+			org, err := fetchOrganization(withGrafanaOrg(ctx, orgID))
+			if err != nil {
+				log.Printf("Warning: Could not read organization %d with its token: %v", orgID, err)
+				continue
+			}
+			orgs = append(orgs, org)
+		}
+	}
+
+	slices.SortFunc(orgs, func(a, b Organization) int { return a.ID - b.ID })
+	return orgs, nil
+}
+
+// fetchOrganization returns the organization requests with ctx run in.
+func fetchOrganization(ctx context.Context) (Organization, error) {
+	return fetchAPI[Organization](ctx, currentConfig().GrafanaURL+"/api/org")
+}
+
+// grafanaOrgMiddleware runs the Grafana requests of an API call in the
+// organization given by its orgId query parameter.
+func grafanaOrgMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		value := c.QueryParam("orgId")
+		if value == "" {
+			return next(c)
+		}
+
+		orgID, err := strconv.Atoi(value)
+		if err != nil || orgID < 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid orgId"})
+		}
+		request := c.Request()
+		c.SetRequest(request.WithContext(withGrafanaOrg(request.Context(), orgID)))
+		return next(c)
+	}
+}
+
+// organizationExportPath creates the subtree of the export for the
+// organization of ctx, named after it, and records it in result. An
+// organization whose name gives the same directory as one exported before
+// gets its ID appended.
+func organizationExportPath(ctx context.Context, exportPath string, result *exportResult) (string, error) {
+	orgID := grafanaOrgFrom(ctx)
+	org, err := fetchOrganization(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Failed to fetch organization %d: %v", orgID, err)
+	}
+
+	name := sanitizePath(org.Name)
+	for _, exported := range result.Organizations {
+		if strings.EqualFold(sanitizePath(exported), name) {
+			name = fmt.Sprintf("%s-%d", name, org.ID)
+			break
+		}
+	}
+
+	orgPath, err := safePath(exportPath, name)
+	if err != nil {
+		return "", fmt.Errorf("Invalid folder path for organization %d: %v", orgID, err)
+	}
+	if err := os.MkdirAll(orgPath, os.ModePerm); err != nil {
+		return "", fmt.Errorf("Failed to create folder for organization %s: %v", org.Name, err)
+	}
+
+	result.Organizations = append(result.Organizations, org.Name)
+	return orgPath, nil
+}
+
+// exportOrganization exports every dashboard of the organization of ctx, and
+// its alert rules when opts include them, into its own subtree.
+func exportOrganization(ctx context.Context, exportPath string, opts exportOptions, result *exportResult) {
+	orgPath, err := organizationExportPath(ctx, exportPath, result)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return
+	}
+
+	dashboards, err := fetchAllDashboards(ctx)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to list dashboards of %s: %v", filepath.Base(orgPath), err))
+	}
+	dashboardUIDs := make([]string, 0, len(dashboards))
+	for _, dash := range dashboards {
+		dashboardUIDs = append(dashboardUIDs, dash.UID)
+	}
+
+	var alertUIDs []string
+	if opts.IncludeAlerts {
+		var alertRules []Alert
+		if err := fetchAlertRules(ctx, "", &alertRules); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to list alerts of %s: %v", filepath.Base(orgPath), err))
+		}
+		for _, alert := range alertRules {
+			if alert.UID != "" {
+				alertUIDs = append(alertUIDs, alert.UID)
+			}
+		}
+	}
+
+	// Library panels no exported dashboard uses go to their own folder. A
+	// Grafana answering 404 has none.
+	libraries, err := fetchAllLibraryElements(ctx)
+	if err != nil && !isGrafanaNotFound(err) {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to list library panels of %s: %v", filepath.Base(orgPath), err))
+	}
+	opts.LibraryUIDs = make([]string, 0, len(libraries))
+	for _, library := range libraries {
+		opts.LibraryUIDs = append(opts.LibraryUIDs, library.UID)
+	}
+
+	// Every object of the other kinds is exported below rather than a selection
+	opts.Objects = nil
+	opts.WholeOrganization = true
+	exportSelection(ctx, orgPath, dashboardUIDs, alertUIDs, opts, result)
+
+	refs := newDashboardRefs(ctx)
+	for _, kind := range objectKinds {
+		kind.exportObjects(ctx, orgPath, nil, refs, result)
+	}
+}
+
+func orgIDStrings(orgIDs []int) []string {
+	result := make([]string, 0, len(orgIDs))
+	for _, orgID := range orgIDs {
+		result = append(result, strconv.Itoa(orgID))
+	}
+	return result
+}
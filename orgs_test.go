@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// newMultiOrgGrafana serves two organizations with one dashboard each. The
+// organization comes from X-Grafana-Org-Id; listing every organization needs
+// a server admin unless serverAdmin is false.
+func newMultiOrgGrafana(serverAdmin bool) *httptest.Server {
+	orgs := map[string]http.HandlerFunc{}
+	for orgID, name := range map[string]string{"1": "Main Org.", "2": "Ops/Team", "3": "Ops_Team"} {
+		routes := map[string]any{
+			"/api/orgs":                            http.StatusForbidden,
+			"/api/user/orgs":                       `[{"orgId":1,"name":"Main Org.","role":"Admin"}]`,
+			"/api/org":                             `{"id":` + orgID + `,"name":"` + name + `"}`,
+			"/api/search":                          `[{"uid":"dash-org` + orgID + `","title":"Dashboard ` + orgID + `","type":"dash-db"}]`,
+			"/api/dashboards/uid/dash-org" + orgID: `{"dashboard":{"title":"Dashboard ` + orgID + `","panels":[]},"meta":{"folderId":0}}`,
+		}
+		if serverAdmin {
+			routes["/api/orgs"] = `[{"id":2,"name":"Ops/Team"},{"id":1,"name":"Main Org."}]`
+		}
+		orgs[orgID] = fakeGrafanaHandler(routes)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgID := r.Header.Get("X-Grafana-Org-Id")
+		if orgID == "" {
+			orgID = "1"
+		}
+		if handler, ok := orgs[orgID]; ok {
+			handler(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+}
+
+func useMultiOrgGrafana(t *testing.T, grafana *httptest.Server) string {
+	originalConfig := config
+	originalCache := metaCache
+	t.Cleanup(func() {
+		config = originalConfig
+		metaCache = originalCache
+	})
+
+	exportDir := t.TempDir()
+	config = Config{GrafanaURL: grafana.URL, GrafanaAPIKey: "test-key", ExportDirectory: exportDir}
+	metaCache = newMetadataCache(time.Minute)
+	return exportDir
+}
+
+func serveOrgRequest(method, target, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Use(grafanaOrgMiddleware)
+	e.GET("/api/orgs", getOrganizations)
+	e.GET("/api/dashboards", getDashboards)
+	e.POST("/api/export", exportDashboards)
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGetOrganizations(t *testing.T) {
+	grafana := newMultiOrgGrafana(true)
+	defer grafana.Close()
+	useMultiOrgGrafana(t, grafana)
+
+	rec := serveOrgRequest(http.MethodGet, "/api/orgs", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response struct {
+		Organizations []Organization `json:"organizations"`
+		CurrentOrgID  int            `json:"currentOrgId"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.Equal(t, []Organization{{ID: 1, Name: "Main Org."}, {ID: 2, Name: "Ops/Team"}}, response.Organizations)
+	assert.Equal(t, 1, response.CurrentOrgID)
+}
+
+func TestGetOrganizationsWithoutServerAdmin(t *testing.T) {
+	grafana := newMultiOrgGrafana(false)
+	defer grafana.Close()
+	useMultiOrgGrafana(t, grafana)
+
+	// The user's own organizations, plus those reached with their own token
+	config.GrafanaOrgAPIKeys = "2:glsa_org2"
+	orgs, err := fetchOrganizations(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, []Organization{{ID: 1, Name: "Main Org."}, {ID: 2, Name: "Ops/Team"}}, orgs)
+}
+
+func TestListingsFollowTheOrganization(t *testing.T) {
+	grafana := newMultiOrgGrafana(true)
+	defer grafana.Close()
+	useMultiOrgGrafana(t, grafana)
+
+	rec := serveOrgRequest(http.MethodGet, "/api/dashboards?wait=true", "")
+	assert.Contains(t, rec.Body.String(), "dash-org1")
+
+	// Cached listings of one organization are not served for another
+	rec = serveOrgRequest(http.MethodGet, "/api/dashboards?wait=true&orgId=2", "")
+	assert.Contains(t, rec.Body.String(), "dash-org2")
+	assert.NotContains(t, rec.Body.String(), "dash-org1")
+
+	rec = serveOrgRequest(http.MethodGet, "/api/dashboards?orgId=main", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestExportAllOrganizations(t *testing.T) {
+	grafana := newMultiOrgGrafana(true)
+	defer grafana.Close()
+	exportDir := useMultiOrgGrafana(t, grafana)
+
+	rec := serveOrgRequest(http.MethodPost, "/api/export", `{"orgIds":[1,2]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var result exportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 2, result.ExportedDashboards)
+	assert.Equal(t, []string{"Main Org.", "Ops/Team"}, result.Organizations)
+
+	assert.FileExists(t, filepath.Join(result.ExportPath, sanitizePath("Main Org."), "General", "Dashboard 1.json"))
+	assert.FileExists(t, filepath.Join(result.ExportPath, sanitizePath("Ops/Team"), "General", "Dashboard 2.json"))
+	assert.True(t, strings.HasPrefix(result.ExportPath, exportDir))
+}
+
+func TestExportOrganizationsWithClashingNames(t *testing.T) {
+	grafana := newMultiOrgGrafana(true)
+	defer grafana.Close()
+	useMultiOrgGrafana(t, grafana)
+
+	// "Ops/Team" and "Ops_Team" both sanitize to Ops_Team
+	rec := serveOrgRequest(http.MethodPost, "/api/export", `{"orgIds":[2,3]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var result exportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Empty(t, result.Errors)
+	assert.FileExists(t, filepath.Join(result.ExportPath, "Ops_Team", "General", "Dashboard 2.json"))
+	assert.FileExists(t, filepath.Join(result.ExportPath, "Ops_Team-3", "General", "Dashboard 3.json"))
+	assert.NoFileExists(t, filepath.Join(result.ExportPath, "Ops_Team", "General", "Dashboard 3.json"))
+}
+
+func TestExportSelectionInOrganization(t *testing.T) {
+	grafana := newMultiOrgGrafana(true)
+	defer grafana.Close()
+	useMultiOrgGrafana(t, grafana)
+
+	rec := serveOrgRequest(http.MethodPost, "/api/export", `{"dashboardUIDs":["dash-org2"],"orgId":2}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var result exportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Empty(t, result.Errors)
+	_, err := os.Stat(filepath.Join(result.ExportPath, sanitizePath("Ops/Team"), "General", "Dashboard 2.json"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// folderPermissionsFile holds the permissions of the folder it is in; those
+// of a dashboard are stored next to it as <title>.permissions.json.
+const folderPermissionsFile = "_folder.permissions.json"
+
+// Grafana's permission levels.
+var permissionNames = map[int]string{1: "View", 2: "Edit", 4: "Admin"}
+
+// grafanaPermission is an entry of /api/folders/{uid}/permissions or
+// /api/dashboards/uid/{uid}/permissions.
+type grafanaPermission struct {
+	UserID         int    `json:"userId"`
+	UserLogin      string `json:"userLogin"`
+	TeamID         int    `json:"teamId"`
+	Team           string `json:"team"`
+	Role           string `json:"role"`
+	Permission     int    `json:"permission"`
+	PermissionName string `json:"permissionName"`
+	Inherited      bool   `json:"inherited"`
+}
+
+// exportedPermission grants a permission to a user, team or role by name, so
+// that it can be re-applied on another Grafana where the IDs differ.
+type exportedPermission struct {
+	User       string `json:"user,omitempty"` // login
+	Team       string `json:"team,omitempty"`
+	Role       string `json:"role,omitempty"` // Viewer, Editor or Admin
+	Permission string `json:"permission"`     // View, Edit or Admin
+}
+
+// permissionResolver turns permission entries into exported ones, looking up
+// the logins and team names Grafana leaves out. Lookups are remembered for
+// the duration of one export.
+type permissionResolver struct {
+	ctx   context.Context
+	users map[int]string
+	teams map[int]string
+}
+
+func newPermissionResolver(ctx context.Context) *permissionResolver {
+	return &permissionResolver{ctx: ctx, teams: make(map[int]string)}
+}
+
+// Fetch returns the permissions set directly on the folder or dashboard at
+// path, such as "/api/folders/abc"; inherited ones come with the folder.
+func (r *permissionResolver) Fetch(path string) ([]exportedPermission, error) {
+	var entries []grafanaPermission
+	if err := fetchAPIRaw(r.ctx, currentConfig().GrafanaURL+path+"/permissions", &entries); err != nil {
+		return nil, err
+	}
+
+	permissions := []exportedPermission{}
+	for _, entry := range entries {
+		if entry.Inherited {
+			continue
+		}
+		permission, err := r.resolve(entry)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, nil
+}
+
+func (r *permissionResolver) resolve(entry grafanaPermission) (exportedPermission, error) {
+	permission := exportedPermission{Role: entry.Role, Permission: entry.PermissionName}
+	if permission.Permission == "" {
+		permission.Permission = permissionNames[entry.Permission]
+	}
+
+	switch {
+	case entry.UserID > 0:
+		permission.Role = ""
+		permission.User = entry.UserLogin
+		if permission.User == "" {
+			login, err := r.userLogin(entry.UserID)
+			if err != nil {
+				return permission, err
+			}
+			permission.User = login
+		}
+	case entry.TeamID > 0:
+		permission.Role = ""
+		permission.Team = entry.Team
+		if permission.Team == "" {
+			name, err := r.teamName(entry.TeamID)
+			if err != nil {
+				return permission, err
+			}
+			permission.Team = name
+		}
+	}
+	return permission, nil
+}
+
+// userLogin looks a user up among the users of the organization, which
+// unlike /api/users/{id} does not need a server admin.
+func (r *permissionResolver) userLogin(userID int) (string, error) {
+	if r.users == nil {
+		var orgUsers []struct {
+			UserID int    `json:"userId"`
+			Login  string `json:"login"`
+		}
+		if err := fetchAPIRaw(r.ctx, currentConfig().GrafanaURL+"/api/org/users", &orgUsers); err != nil {
+			return "", fmt.Errorf("could not list users: %v", err)
+		}
+		r.users = make(map[int]string, len(orgUsers))
+		for _, user := range orgUsers {
+			r.users[user.UserID] = user.Login
+		}
+	}
+
+	login, ok := r.users[userID]
+	if !ok {
+		return "", fmt.Errorf("user %d is not in the organization", userID)
+	}
+	return login, nil
+}
+
+func (r *permissionResolver) teamName(teamID int) (string, error) {
+	if name, ok := r.teams[teamID]; ok {
+		return name, nil
+	}
+
+	var team struct {
+		Name string `json:"name"`
+	}
+	if err := fetchAPIRaw(r.ctx, fmt.Sprintf("%s/api/teams/%d", currentConfig().GrafanaURL, teamID), &team); err != nil {
+		return "", fmt.Errorf("could not look up team %d: %v", teamID, err)
+	}
+	r.teams[teamID] = team.Name
+	return team.Name, nil
+}
+
+// folderPermissionFiles remembers, during one export, which folder's
+// permissions each folder directory holds. Folders of the same title share a
+// directory, but only one of them can have its permissions there.
+type folderPermissionFiles struct {
+	owners  map[string]string // directory -> UID of the folder whose permissions it holds
+	clashes map[string]bool   // UIDs of folders reported as sharing another's directory
+}
+
+func newFolderPermissionFiles() *folderPermissionFiles {
+	return &folderPermissionFiles{owners: make(map[string]string), clashes: make(map[string]bool)}
+}
+
+// exportPermissions stores the permissions of a dashboard next to its file
+// and, once per folder, those of its folder in the folder's directory.
+func exportPermissions(r *permissionResolver, uid, folderUID, dashboardFile string, folders *folderPermissionFiles, result *exportResult) {
+	dir := filepath.Dir(dashboardFile)
+	owner, exported := folders.owners[dir]
+	switch {
+	case folderUID == "" || owner == folderUID:
+	case exported:
+		if !folders.clashes[folderUID] {
+			folders.clashes[folderUID] = true
+			result.Errors = append(result.Errors, fmt.Sprintf("Permissions of folder %s not exported: folder %s of the same name already has its permissions in %s", folderUID, owner, filepath.Base(dir)))
+		}
+	default:
+		folders.owners[dir] = folderUID
+		permissions, err := r.Fetch("/api/folders/" + folderUID)
+		if err == nil {
+			err = writePermissions(filepath.Join(dir, folderPermissionsFile), permissions)
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to export permissions of folder %s: %v", folderUID, err))
+		} else {
+			result.ExportedPermissions++
+		}
+	}
+
+	permissions, err := r.Fetch("/api/dashboards/uid/" + uid)
+	if err == nil {
+		err = writePermissions(permissionsFilename(dashboardFile), permissions)
+	}
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to export permissions of dashboard %s: %v", uid, err))
+		return
+	}
+	result.ExportedPermissions++
+}
+
+// permissionsFilename is where the permissions of the dashboard exported to
+// dashboardFile are stored.
+func permissionsFilename(dashboardFile string) string {
+	return strings.TrimSuffix(dashboardFile, ".json") + ".permissions.json"
+}
+
+func writePermissions(filename string, permissions []exportedPermission) error {
+	data, err := json.MarshalIndent(permissions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
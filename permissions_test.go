@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPermissionsTestGrafana(lookups *atomic.Int32) *httptest.Server {
+	return newFakeGrafana(map[string]any{
+		"/api/dashboards/uid/dash-1": `{"dashboard":{"title":"Service","panels":[]},"meta":{"folderId":7,"folderUid":"ops","folderTitle":"Ops"}}`,
+		"/api/dashboards/uid/dash-1/permissions": `[
+			{"userId":0,"teamId":0,"role":"Viewer","permission":1,"inherited":true},
+			{"userId":3,"userLogin":"","teamId":0,"permission":2},
+			{"userId":0,"teamId":5,"team":"","permission":4,"permissionName":"Admin"}
+		]`,
+		"/api/folders/ops/permissions": `[
+			{"userId":0,"teamId":0,"role":"Viewer","permission":1,"permissionName":"View"},
+			{"userId":0,"teamId":5,"team":"SRE","permission":2,"permissionName":"Edit"}
+		]`,
+		"/api/org/users": countRequests(lookups, `[{"userId":3,"login":"alice"}]`),
+		"/api/teams/5":   countRequests(lookups, `{"id":5,"name":"SRE"}`),
+	})
+}
+
+func readPermissions(t *testing.T, path string) []exportedPermission {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var permissions []exportedPermission
+	assert.NoError(t, json.Unmarshal(data, &permissions))
+	return permissions
+}
+
+func TestExportPermissions(t *testing.T) {
+	var lookups atomic.Int32
+	grafana := newPermissionsTestGrafana(&lookups)
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: grafana.URL, GrafanaAPIKey: "test-key", ExportDirectory: t.TempDir()}
+	metaCache = newMetadataCache(time.Minute)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(`{"dashboardUIDs":["dash-1"],"includePermissions":true}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, exportDashboards(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var result exportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 2, result.ExportedPermissions)
+
+	folder := filepath.Join(result.ExportPath, "Ops")
+	assert.Equal(t, []exportedPermission{
+		{Role: "Viewer", Permission: "View"},
+		{Team: "SRE", Permission: "Edit"},
+	}, readPermissions(t, filepath.Join(folder, folderPermissionsFile)))
+
+	// Inherited entries are left to the folder, IDs are resolved to names
+	assert.Equal(t, []exportedPermission{
+		{User: "alice", Permission: "Edit"},
+		{Team: "SRE", Permission: "Admin"},
+	}, readPermissions(t, filepath.Join(folder, "Service.permissions.json")))
+	assert.Equal(t, int32(2), lookups.Load())
+}
+
+func TestExportPermissionsOfFoldersWithTheSameTitle(t *testing.T) {
+	grafana := newFakeGrafana(map[string]any{
+		"/api/dashboards/uid/dash-1":             `{"dashboard":{"title":"Service","panels":[]},"meta":{"folderId":7,"folderUid":"ops","folderTitle":"Ops"}}`,
+		"/api/dashboards/uid/dash-2":             `{"dashboard":{"title":"Database","panels":[]},"meta":{"folderId":8,"folderUid":"ops-eu","folderTitle":"Ops"}}`,
+		"/api/dashboards/uid/dash-1/permissions": `[]`,
+		"/api/dashboards/uid/dash-2/permissions": `[]`,
+		"/api/folders/ops/permissions":           `[{"role":"Viewer","permission":1}]`,
+		"/api/folders/ops-eu/permissions":        `[{"role":"Editor","permission":2}]`,
+	})
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: grafana.URL, ExportDirectory: t.TempDir()}
+	metaCache = newMetadataCache(time.Minute)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(`{"dashboardUIDs":["dash-1","dash-2"],"includePermissions":true}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, exportDashboards(e.NewContext(req, rec)))
+
+	// The second folder's permissions do not overwrite the first's
+	var result exportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if assert.Len(t, result.Errors, 1) {
+		assert.Contains(t, result.Errors[0], "ops-eu")
+	}
+	assert.Equal(t, []exportedPermission{{Role: "Viewer", Permission: "View"}},
+		readPermissions(t, filepath.Join(result.ExportPath, "Ops", folderPermissionsFile)))
+}
+
+func TestPermissionResolverUnknownUser(t *testing.T) {
+	var lookups atomic.Int32
+	grafana := newPermissionsTestGrafana(&lookups)
+	defer grafana.Close()
+
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	config = Config{GrafanaURL: grafana.URL}
+
+	resolver := newPermissionResolver(t.Context())
+	_, err := resolver.resolve(grafanaPermission{UserID: 42, Permission: 1})
+	assert.ErrorContains(t, err, "user 42 is not in the organization")
+
+	// The user list is fetched once per export
+	login, err := resolver.userLogin(3)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", login)
+	assert.Equal(t, int32(1), lookups.Load())
+}
@@ -6,6 +6,7 @@ const selectAllBtn = document.getElementById('selectAllBtn');
 const clearSelectionBtn = document.getElementById('clearSelectionBtn');
 const includeLibrariesCheck = document.getElementById('includeLibrariesCheck');
 const includeAlertsCheck = document.getElementById('includeAlertsCheck');
+const includeLinkedAlertsCheck = document.getElementById('includeLinkedAlertsCheck');
 const selectedDashCountEl = document.getElementById('selectedDashCount');
 const selectedAlertCountEl = document.getElementById('selectedAlertCount');
 const selectedFolderCountEl = document.getElementById('selectedFolderCount');
@@ -21,6 +22,13 @@ const searchAlerts = document.getElementById('searchAlerts');
 const selectAllAlertsBtn = document.getElementById('selectAllAlertsBtn');
 const clearAlertsSelectionBtn = document.getElementById('clearAlertsSelectionBtn');
 const exportAsZipCheck = document.getElementById('exportAsZipCheck');
+const foldersTotalEl = document.getElementById('foldersTotal');
+const dashboardsTotalEl = document.getElementById('dashboardsTotal');
+const orgSelect = document.getElementById('orgSelect');
+const exportAllOrgsCheck = document.getElementById('exportAllOrgsCheck');
+const includeIdentityCheck = document.getElementById('includeIdentityCheck');
+const includeVersionsCheck = document.getElementById('includeVersionsCheck');
+const includeAnnotationsCheck = document.getElementById('includeAnnotationsCheck');
 
 // ── State ──
 let folders = [];
@@ -37,7 +45,26 @@ let alertSearchQuery = '';
 let selectedAlertFolder = 'all';
 let currentSortOrder = 'alphabetical';
 let expandedFolders = new Set();
-let appConfig = { forceEnableZipExport: false };
+let appConfig = { forceEnableZipExport: false, needsSetup: false };
+let dashboardUpdates = null;
+let pendingDashboardUpdates = new Map();
+let dashboardRenderTimer = null;
+let currentRole = 'admin';
+let configIssues = [];
+let organizations = [];
+let currentOrgId = null;
+let versionsDashboardUid = null;
+let libraries = null;
+let selectedLibraries = new Set();
+let libraryConnections = {};
+let dependencyGraph = null;
+let graphLabels = new Map();
+let graphObjectId = null;
+let objectKind = 'playlists';
+let objects = {};
+let selectedObjects = {};
+
+const roleRanks = { none: 0, viewer: 1, exporter: 2, admin: 3 };
 
 // ── Init ──
 document.addEventListener('DOMContentLoaded', initialize);
@@ -55,31 +82,89 @@ function initialize() {
         exportResultSection.style.display = 'none';
     });
 
+    orgSelect.addEventListener('change', switchOrganization);
+    exportAllOrgsCheck.addEventListener('change', updateSelectedCount);
+    includeIdentityCheck.addEventListener('change', updateSelectedCount);
+    includeVersionsCheck.addEventListener('change', function() {
+        document.getElementById('versionLimitOption').style.display = this.checked ? '' : 'none';
+    });
+    includeAnnotationsCheck.addEventListener('change', function() {
+        document.getElementById('annotationsRangeOption').style.display = this.checked ? '' : 'none';
+    });
+
     document.getElementById('sortOrder').addEventListener('change', function() {
         currentSortOrder = this.value;
         filterDashboards();
     });
 
-    loadConfig();
+    const configLoaded = loadConfig();
+    loadConnectionStatus();
+    setInterval(loadConnectionStatus, 30000);
     loadFolders();
     loadDashboards();
-    loadAlerts();
+    loadOrganizations();
+    loadLibraries();
+    document.getElementById('searchLibraries').addEventListener('input', renderLibraries);
+    document.getElementById('unusedLibrariesCheck').addEventListener('change', renderLibraries);
+    document.getElementById('selectAllLibrariesBtn').addEventListener('click', selectAllLibraries);
+    document.getElementById('clearLibrariesSelectionBtn').addEventListener('click', clearLibrarySelection);
+    loadObjects();
+    document.querySelectorAll('.object-tab').forEach(tab => {
+        tab.addEventListener('click', () => switchObjectKind(tab.dataset.kind));
+    });
+    document.getElementById('selectAllObjectsBtn').addEventListener('click', selectAllObjects);
+    document.getElementById('clearObjectsSelectionBtn').addEventListener('click', clearObjectSelection);
+    document.getElementById('loadGraphBtn').addEventListener('click', loadDependencyGraph);
+    document.getElementById('downloadGraphBtn').addEventListener('click', downloadDependencyGraph);
+    document.getElementById('graphObjectInput').addEventListener('change', function() {
+        graphObjectId = graphLabels.get(this.value) || null;
+        renderDependents();
+    });
+    document.getElementById('compareVersionsBtn').addEventListener('click', compareVersions);
+    document.getElementById('closeVersionsBtn').addEventListener('click', () => {
+        document.getElementById('versionsSection').style.display = 'none';
+    });
+    document.getElementById('refreshAuditBtn').addEventListener('click', loadAuditLog);
+    document.getElementById('auditUserFilter').addEventListener('change', loadAuditLog);
+    document.getElementById('auditUidFilter').addEventListener('change', loadAuditLog);
+    document.getElementById('settingsBtn').addEventListener('click', toggleSettings);
+    document.getElementById('testSettingsBtn').addEventListener('click', testSettings);
+    document.getElementById('saveSettingsBtn').addEventListener('click', saveSettings);
+    document.getElementById('settingsRemoveApiKey').addEventListener('change', function() {
+        document.getElementById('settingsApiKey').disabled = this.checked;
+    });
+
+    Promise.all([loadCurrentUser(), configLoaded]).then(() => {
+        if (!hasRole('admin')) return;
+        loadAlerts();
+        loadAuditLog();
+        document.getElementById('settingsBtn').style.display = '';
+        // A server started without configuration is set up from here
+        if (appConfig.needsSetup) toggleSettings();
+    });
 }
 
 // ── Data Loading ──
 async function loadDashboards() {
     try {
         showLoading('Loading dashboards...', 'Fetching from API...');
-        const response = await fetch('/api/dashboards');
+        subscribeDashboardUpdates();
+        const response = await apiFetch(orgUrl('/api/dashboards'));
         if (!response.ok) throw new Error(`Failed to load dashboards: ${response.statusText}`);
 
         const data = await response.json();
         dashboards = data.dashboards || [];
+        dashboardsTotalEl.textContent = `(${data.total ?? dashboards.length})`;
 
         dashboards.forEach(d => {
             if (d.folderId === 0 && !d.folderTitle) d.folderTitle = 'General';
         });
 
+        // Apply timestamps that arrived while the listing was loading
+        pendingDashboardUpdates.forEach(applyDashboardUpdate);
+        pendingDashboardUpdates.clear();
+        if (!data.pending) closeDashboardUpdates();
+
         filteredDashboards = [...dashboards];
         applySorting();
 
@@ -93,9 +178,50 @@ async function loadDashboards() {
     }
 }
 
+// Timestamps and versions are fetched in the background by the server and
+// pushed here as server-sent events.
+function subscribeDashboardUpdates() {
+    if (dashboardUpdates || !window.EventSource) return;
+
+    dashboardUpdates = new EventSource(orgUrl('/api/dashboards/updates'));
+    dashboardUpdates.addEventListener('dashboard', (event) => {
+        const update = JSON.parse(event.data);
+        if (dashboards.length === 0) {
+            pendingDashboardUpdates.set(update.uid, update);
+            return;
+        }
+        applyDashboardUpdate(update);
+        scheduleDashboardRender();
+        if (update.pending === 0) closeDashboardUpdates();
+    });
+    dashboardUpdates.onerror = () => closeDashboardUpdates();
+}
+
+function closeDashboardUpdates() {
+    if (dashboardUpdates) {
+        dashboardUpdates.close();
+        dashboardUpdates = null;
+    }
+}
+
+function applyDashboardUpdate(update) {
+    const dashboard = dashboards.find(d => d.uid === update.uid);
+    if (!dashboard) return;
+    dashboard.updated = update.updated;
+    dashboard.version = update.version;
+}
+
+function scheduleDashboardRender() {
+    if (dashboardRenderTimer) return;
+    dashboardRenderTimer = setTimeout(() => {
+        dashboardRenderTimer = null;
+        filterDashboards();
+    }, 250);
+}
+
 async function loadAlerts() {
     try {
-        const response = await fetch('/api/alerts');
+        const response = await apiFetch(orgUrl('/api/alerts'));
         if (!response.ok) throw new Error(`Failed to load alerts: ${response.statusText}`);
 
         const data = await response.json();
@@ -112,7 +238,7 @@ async function loadAlerts() {
 
 async function loadFolders() {
     try {
-        const response = await fetch('/api/folders');
+        const response = await apiFetch(orgUrl('/api/folders'));
         if (!response.ok) throw new Error(`Failed to load folders: ${response.statusText}`);
 
         const data = await response.json();
@@ -124,19 +250,175 @@ async function loadFolders() {
             folders = data;
         }
 
+        foldersTotalEl.textContent = `(${response.headers.get('X-Total-Count') || folders.length})`;
         renderFolders();
     } catch (error) {
         showAlert('error', `Error loading folders: ${error.message}`);
     }
 }
 
+// ── Organizations ──
+async function loadOrganizations() {
+    try {
+        const response = await apiFetch('/api/orgs');
+        if (!response.ok) return;
+
+        const data = await response.json();
+        organizations = data.organizations || [];
+        if (organizations.length < 2) return;
+
+        orgSelect.replaceChildren(...organizations.map(org => new Option(org.name, org.id)));
+        // The page starts in the default organization of the credentials
+        orgSelect.value = data.currentOrgId;
+        orgSelect.style.display = '';
+        document.getElementById('exportAllOrgsOption').style.display = '';
+    } catch (error) {
+        console.warn('Failed to load organizations:', error.message);
+    }
+}
+
+// Everything on screen belongs to one organization, so switching reloads it
+function switchOrganization() {
+    currentOrgId = Number(orgSelect.value);
+    closeDashboardUpdates();
+    pendingDashboardUpdates.clear();
+    selectedDashboards.clear();
+    selectedAlerts.clear();
+    resetDependencyGraph();
+    libraries = null;
+    selectedLibraries.clear();
+    libraryConnections = {};
+    loadLibraries();
+    objects = {};
+    selectedObjects = {};
+    loadObjects();
+    selectedFolder = 'all';
+    expandedFolders.clear();
+    loadFolders();
+    loadDashboards();
+    if (hasRole('admin')) loadAlerts();
+    updateSelectedCount();
+}
+
+// orgUrl adds the selected organization to an API path
+function orgUrl(path) {
+    if (!currentOrgId) return path;
+    return `${path}${path.includes('?') ? '&' : '?'}orgId=${currentOrgId}`;
+}
+
+async function loadAuditLog() {
+    const params = new URLSearchParams();
+    const user = document.getElementById('auditUserFilter').value.trim();
+    const uid = document.getElementById('auditUidFilter').value.trim();
+    if (user) params.set('user', user);
+    if (uid) params.set('uid', uid);
+
+    try {
+        const response = await apiFetch(`/api/audit?${params}`);
+        if (response.status === 404) return; // audit log disabled
+        if (!response.ok) throw new Error(response.statusText);
+
+        const data = await response.json();
+        document.getElementById('auditTotal').textContent = `(${data.total})`;
+        renderAuditLog(data.entries || []);
+        document.getElementById('auditSection').style.display = 'block';
+    } catch (error) {
+        showAlert('error', `Error loading audit log: ${error.message}`);
+    }
+}
+
+function renderAuditLog(entries) {
+    const tbody = document.getElementById('auditEntries');
+    tbody.replaceChildren();
+
+    entries.forEach(entry => {
+        const objects = Object.entries(entry.uids || {})
+            .filter(([, uids]) => uids && uids.length)
+            .map(([kind, uids]) => `${kind}: ${uids.join(', ')}`)
+            .concat(entry.settings ? [`settings: ${entry.settings.join(', ')}`] : [])
+            .join('; ');
+        const counts = Object.entries(entry.counts || {})
+            .map(([kind, count]) => `${count} ${kind}`)
+            .join(', ');
+
+        const row = document.createElement('tr');
+        [
+            new Date(entry.time).toLocaleString(),
+            entry.user,
+            entry.clientIp,
+            entry.action,
+            objects,
+            `${entry.status} ${counts}`,
+        ].forEach(text => {
+            const cell = document.createElement('td');
+            cell.textContent = text;
+            row.appendChild(cell);
+        });
+
+        const resultCell = row.lastChild;
+        if (entry.exportPath) {
+            resultCell.appendChild(document.createElement('br'));
+            resultCell.appendChild(document.createTextNode(entry.exportPath));
+        }
+        (entry.errors || []).forEach(message => {
+            const error = document.createElement('div');
+            error.className = 'audit-error';
+            error.textContent = message;
+            resultCell.appendChild(error);
+        });
+
+        tbody.appendChild(row);
+    });
+}
+
+async function loadCurrentUser() {
+    try {
+        const response = await apiFetch('/api/me');
+        if (!response.ok) return;
+
+        const data = await response.json();
+        currentRole = data.user.role || 'admin';
+        applyRolePermissions();
+        if (!data.authEnabled) return;
+
+        document.getElementById('currentUserName').textContent = `${data.user.name} (${currentRole})`;
+        document.getElementById('userBadge').style.display = 'flex';
+    } catch (error) {
+        console.warn('Failed to load current user:', error.message);
+    }
+}
+
+function hasRole(role) {
+    return (roleRanks[currentRole] ?? 0) >= roleRanks[role];
+}
+
+// Hide the actions the server would refuse for the current role
+function applyRolePermissions() {
+    if (!hasRole('exporter')) {
+        document.querySelector('.export-panel').style.display = 'none';
+        document.querySelector('.object-tab[data-kind="snapshots"]').style.display = 'none';
+    }
+    if (!hasRole('admin')) {
+        document.getElementById('alertsSection').style.display = 'none';
+        includeAlertsCheck.checked = false;
+        includeAlertsCheck.closest('.export-option').style.display = 'none';
+        includeLinkedAlertsCheck.checked = false;
+        includeLinkedAlertsCheck.closest('.export-option').style.display = 'none';
+        includeIdentityCheck.checked = false;
+        includeIdentityCheck.closest('.export-option').style.display = 'none';
+        selectedAlertCountEl.closest('.export-summary-row').style.display = 'none';
+    }
+}
+
 async function loadConfig() {
     try {
-        const response = await fetch('/api/config-status');
+        const response = await apiFetch('/api/config-status');
         if (!response.ok) throw new Error(`Failed to load config: ${response.statusText}`);
 
         const data = await response.json();
         appConfig.forceEnableZipExport = data.forceEnableZipExport || false;
+        appConfig.needsSetup = !data.hasEnvFile;
+        configIssues = configStatusIssues(data);
 
         if (appConfig.forceEnableZipExport && exportAsZipCheck) {
             exportAsZipCheck.checked = true;
@@ -149,6 +431,196 @@ async function loadConfig() {
     }
 }
 
+function configStatusIssues(data) {
+    const issues = [];
+    if (!data.hasEnvFile && data.errorMessage) issues.push(data.errorMessage);
+
+    const status = data.config || {};
+    (status.problems || []).forEach(problem => issues.push(`Configuration problem: ${problem}`));
+    if ((status.restartRequired || []).length) {
+        issues.push(`Restart the exporter to apply: ${status.restartRequired.join(', ')}`);
+    }
+    return issues;
+}
+
+// ── Settings ──
+async function toggleSettings() {
+    const section = document.getElementById('settingsSection');
+    if (section.style.display === 'block') {
+        section.style.display = 'none';
+        return;
+    }
+
+    await loadSettings();
+    section.style.display = 'block';
+    section.scrollIntoView({ behavior: 'smooth' });
+}
+
+async function loadSettings() {
+    try {
+        const response = await apiFetch('/api/settings');
+        if (!response.ok) throw new Error(response.statusText);
+        renderSettings(await response.json());
+    } catch (error) {
+        showAlert('error', `Error loading settings: ${error.message}`);
+    }
+}
+
+function renderSettings(settings) {
+    document.getElementById('settingsGrafanaUrl').value = settings.grafanaUrl || '';
+    document.getElementById('settingsSkipTlsVerify').checked = settings.skipTlsVerify;
+    document.getElementById('settingsExportDirectory').value = settings.exportDirectory || '';
+
+    const apiKey = document.getElementById('settingsApiKey');
+    apiKey.value = '';
+    apiKey.placeholder = settings.hasApiKey ? 'Saved, leave empty to keep it' : 'Service account token';
+    document.getElementById('settingsRemoveApiKey').checked = false;
+
+    const locked = settings.locked || [];
+    document.querySelectorAll('#settingsForm [data-setting]').forEach(input => {
+        input.disabled = locked.includes(input.dataset.setting);
+    });
+    document.getElementById('settingsRemoveApiKey').disabled = !settings.hasApiKey || locked.includes('GRAFANA_API_KEY');
+
+    let note = `Settings are saved to ${settings.settingsFile}.`;
+    if (locked.length) note += ` ${locked.join(', ')} ${locked.length === 1 ? 'is' : 'are'} set by .env or the environment, which take precedence.`;
+    document.getElementById('settingsNote').textContent = note;
+    renderSettingsResult('', settings.problems || []);
+}
+
+function settingsFormData() {
+    const data = {
+        grafanaUrl: document.getElementById('settingsGrafanaUrl').value.trim(),
+        skipTlsVerify: document.getElementById('settingsSkipTlsVerify').checked,
+        exportDirectory: document.getElementById('settingsExportDirectory').value.trim(),
+    };
+
+    // Without a new token the saved one is kept
+    const apiKey = document.getElementById('settingsApiKey').value.trim();
+    if (document.getElementById('settingsRemoveApiKey').checked) data.apiKey = '';
+    else if (apiKey) data.apiKey = apiKey;
+    return data;
+}
+
+async function testSettings() {
+    renderSettingsResult('', ['Testing the connection...']);
+    try {
+        const response = await apiFetch('/api/settings/test', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(settingsFormData()),
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            renderSettingsResult('error', data.problems || [data.error]);
+            return;
+        }
+
+        if (data.ready) {
+            const org = data.organization ? ` (${data.organization})` : '';
+            renderSettingsResult(data.issues.length ? '' : 'ok', [`Connected to Grafana ${data.version || ''}${org}`, ...data.issues]);
+        } else {
+            renderSettingsResult('error', [data.error, ...(data.issues || [])]);
+        }
+    } catch (error) {
+        renderSettingsResult('error', [error.message]);
+    }
+}
+
+async function saveSettings() {
+    try {
+        const response = await apiFetch('/api/settings', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(settingsFormData()),
+        });
+        const data = await response.json();
+        if (response.status === 409) {
+            renderSettingsResult('error', [data.error, ...data.problems]);
+            return;
+        }
+        if (!response.ok) {
+            renderSettingsResult('error', data.problems || [data.error]);
+            return;
+        }
+
+        renderSettings(data);
+        showAlert('success', 'Settings saved');
+        await loadConfig();
+        loadConnectionStatus();
+        loadFolders();
+        loadDashboards();
+        loadAuditLog();
+    } catch (error) {
+        renderSettingsResult('error', [error.message]);
+    }
+}
+
+function renderSettingsResult(level, messages) {
+    const result = document.getElementById('settingsResult');
+    result.className = `settings-result ${level}`;
+    result.replaceChildren();
+    if (!messages.length) return;
+
+    result.textContent = messages[0];
+    if (messages.length > 1) {
+        const list = document.createElement('ul');
+        messages.slice(1).forEach(message => {
+            const item = document.createElement('li');
+            item.textContent = message;
+            list.appendChild(item);
+        });
+        result.appendChild(list);
+    }
+}
+
+// ── Connection Status ──
+async function loadConnectionStatus() {
+    try {
+        // The configuration can be reloaded while the page is open
+        const config = await apiFetch('/api/config-status');
+        if (config.ok) configIssues = configStatusIssues(await config.json());
+    } catch (error) {
+        console.warn('Failed to load config status:', error.message);
+    }
+
+    try {
+        const response = await apiFetch('/api/grafana-status');
+        renderConnectionStatus(await response.json());
+    } catch (error) {
+        renderConnectionStatus({ ready: false, error: 'The exporter is not responding' });
+    }
+}
+
+function renderConnectionStatus(status) {
+    const banner = document.getElementById('connectionBanner');
+    const issues = [...(status.issues || [])];
+    issues.unshift(...configIssues);
+
+    let level = 'ok';
+    let message = `Connected to Grafana ${status.version || ''}`;
+    if (status.organization) message += ` (${status.organization})`;
+    if (!status.ready) {
+        level = 'error';
+        message = status.error || 'Grafana is not ready';
+    } else if (issues.length) {
+        level = 'warning';
+    }
+
+    banner.className = `connection-banner ${level}`;
+    banner.textContent = message;
+    if (issues.length) {
+        const list = document.createElement('ul');
+        issues.forEach(issue => {
+            const item = document.createElement('li');
+            item.textContent = issue;
+            list.appendChild(item);
+        });
+        banner.appendChild(list);
+    }
+    banner.style.display = 'block';
+}
+
 // ── Folder Rendering ──
 function renderFolders() {
     renderDashboardFolders();
@@ -362,7 +834,7 @@ function renderDashboards() {
                     <span class="checkmark"></span>
                 </span>
                 <div class="dashboard-card-info">
-                    <div class="dashboard-card-title">${d.title}${d.version > 0 ? ' <span class="dashboard-version">v' + d.version + '</span>' : ''}</div>
+                    <div class="dashboard-card-title">${d.title}${d.version > 0 ? ' <span class="dashboard-version" data-versions="' + d.uid + '" title="Version history">v' + d.version + '</span>' : ''}</div>
                     <div class="dashboard-card-meta">${folderName}${panelCount ? ' (' + panelCount + ')' : ''}${relTime ? ' &middot; ' + relTime : ''}</div>
                     ${d.tags && d.tags.length > 0 ? `<div class="dashboard-card-tags">${d.tags.map(t => `<span class="tag-pill">${t}</span>`).join('')}</div>` : ''}
                 </div>
@@ -379,6 +851,10 @@ function renderDashboards() {
     document.querySelectorAll('.dashboard-card').forEach(card => {
         card.addEventListener('click', function(e) {
             if (e.target.type === 'checkbox') return;
+            if (e.target.dataset.versions) {
+                openVersionHistory(e.target.dataset.versions);
+                return;
+            }
             const uid = this.dataset.uid;
             const cb = this.querySelector(`#check_${uid}`);
             cb.checked = !cb.checked;
@@ -396,6 +872,539 @@ function renderDashboards() {
     updateSelectedCount();
 }
 
+// ── Version History ──
+async function openVersionHistory(uid) {
+    versionsDashboardUid = uid;
+    document.getElementById('versionDiff').replaceChildren();
+    document.getElementById('compareVersionsBtn').style.display = hasRole('exporter') ? '' : 'none';
+
+    try {
+        const response = await apiFetch(orgUrl(`/api/dashboards/${encodeURIComponent(uid)}/versions?limit=50`));
+        const data = await response.json();
+        if (!response.ok) throw new Error(data.error || `HTTP ${response.status}`);
+        renderVersions(data);
+        const section = document.getElementById('versionsSection');
+        section.style.display = '';
+        section.scrollIntoView({ behavior: 'smooth' });
+    } catch (error) {
+        showAlert('error', `Failed to load version history: ${error.message}`);
+    }
+}
+
+function renderVersions(data) {
+    document.getElementById('versionsTitle').textContent = `— ${data.title}`;
+    const tbody = document.getElementById('versionEntries');
+    tbody.replaceChildren();
+
+    data.versions.forEach((version, index) => {
+        const row = document.createElement('tr');
+        // Preselect the newest version and the one before it
+        [['versionBase', index === 1], ['versionNew', index === 0]].forEach(([name, checked]) => {
+            const cell = document.createElement('td');
+            const radio = document.createElement('input');
+            radio.type = 'radio';
+            radio.name = name;
+            radio.value = version.version;
+            radio.checked = checked;
+            cell.appendChild(radio);
+            row.appendChild(cell);
+        });
+
+        [
+            `v${version.version}${version.version === data.version ? ' (current)' : ''}`,
+            new Date(version.created).toLocaleString(),
+            version.createdBy,
+            version.message || (version.restoredFrom ? `Restored from v${version.restoredFrom}` : ''),
+        ].forEach(text => {
+            const cell = document.createElement('td');
+            cell.textContent = text;
+            row.appendChild(cell);
+        });
+
+        const actions = document.createElement('td');
+        if (hasRole('admin') && version.version !== data.version) {
+            const button = document.createElement('button');
+            button.className = 'btn-text';
+            button.textContent = 'Restore';
+            button.addEventListener('click', () => restoreDashboardVersion(version.version));
+            actions.appendChild(button);
+        }
+        row.appendChild(actions);
+
+        tbody.appendChild(row);
+    });
+}
+
+async function compareVersions() {
+    const base = document.querySelector('input[name="versionBase"]:checked');
+    const next = document.querySelector('input[name="versionNew"]:checked');
+    if (!base || !next) {
+        showAlert('warning', 'Choose two versions to compare');
+        return;
+    }
+
+    try {
+        const url = `/api/dashboards/${encodeURIComponent(versionsDashboardUid)}/versions/diff?base=${base.value}&new=${next.value}`;
+        const response = await apiFetch(orgUrl(url));
+        const data = await response.json();
+        if (!response.ok) throw new Error(data.error || `HTTP ${response.status}`);
+        renderVersionDiff(data);
+    } catch (error) {
+        showAlert('error', `Failed to compare versions: ${error.message}`);
+    }
+}
+
+function renderVersionDiff(data) {
+    const container = document.getElementById('versionDiff');
+    container.replaceChildren();
+
+    const heading = document.createElement('p');
+    heading.textContent = data.changes.length === 0
+        ? `v${data.base} and v${data.new} are identical`
+        : `${data.changes.length} changes from v${data.base} to v${data.new}`;
+    container.appendChild(heading);
+
+    const list = document.createElement('ul');
+    data.changes.forEach(change => {
+        const item = document.createElement('li');
+        item.className = `diff-${change.kind}`;
+        const path = document.createElement('strong');
+        path.textContent = `${change.path} `;
+        const value = document.createElement('code');
+        const format = v => JSON.stringify(v);
+        value.textContent = change.kind === 'added' ? `+ ${format(change.new)}`
+            : change.kind === 'removed' ? `- ${format(change.old)}`
+            : `${format(change.old)} → ${format(change.new)}`;
+        item.append(path, value);
+        list.appendChild(item);
+    });
+    container.appendChild(list);
+}
+
+async function restoreDashboardVersion(version) {
+    if (!confirm(`Restore version ${version}? Grafana saves it as a new version of the dashboard.`)) return;
+
+    try {
+        showLoading(`Restoring version ${version}...`);
+        const url = `/api/dashboards/${encodeURIComponent(versionsDashboardUid)}/versions/${version}/restore`;
+        const response = await apiFetch(orgUrl(url), { method: 'POST' });
+        const result = await response.json();
+        hideLoading();
+        if (!response.ok) throw new Error((result.errors || []).join('; ') || result.error || `HTTP ${response.status}`);
+
+        showAlert('success', `Restored version ${result.restoredVersion} as version ${result.version}`);
+        openVersionHistory(versionsDashboardUid);
+        loadDashboards();
+    } catch (error) {
+        hideLoading();
+        showAlert('error', `Failed to restore: ${error.message}`);
+    }
+}
+
+// ── Library Panels ──
+// Library panels can be exported on their own, including those no dashboard
+// uses. They are listed by folder; the used-by badge shows the dashboards.
+async function loadLibraries() {
+    const container = document.getElementById('librariesContainer');
+    container.innerHTML = '<div class="dashboards-empty"><div class="spinner"></div></div>';
+    try {
+        const response = await apiFetch(orgUrl('/api/libraries'));
+        const data = await response.json();
+        if (!response.ok) throw new Error(data.error || `HTTP ${response.status}`);
+        libraries = { items: data.result.elements || [] };
+    } catch (error) {
+        libraries = { items: [], error: error.message };
+    }
+    renderLibraries();
+}
+
+function filteredLibraries() {
+    const query = document.getElementById('searchLibraries').value.trim().toLowerCase();
+    const unusedOnly = document.getElementById('unusedLibrariesCheck').checked;
+    return libraries.items.filter(item =>
+        (!query || item.name.toLowerCase().includes(query)) &&
+        (!unusedOnly || item.usedBy === 0)
+    );
+}
+
+function renderLibraries() {
+    if (!libraries) return;
+    const container = document.getElementById('librariesContainer');
+    container.replaceChildren();
+
+    const items = filteredLibraries();
+    if (libraries.error || items.length === 0) {
+        const empty = document.createElement('div');
+        empty.className = 'dashboards-empty';
+        const message = document.createElement('p');
+        message.textContent = libraries.error ? `Failed to load: ${libraries.error}` : 'No library panels found';
+        empty.appendChild(message);
+        container.appendChild(empty);
+        return;
+    }
+
+    const groups = new Map();
+    items.forEach(item => {
+        const folder = item.folderTitle || 'General';
+        if (!groups.has(folder)) groups.set(folder, []);
+        groups.get(folder).push(item);
+    });
+
+    Array.from(groups.keys()).sort((a, b) => a.localeCompare(b)).forEach(folder => {
+        const title = document.createElement('div');
+        title.className = 'panel-title library-group-title';
+        title.textContent = `${folder} (${groups.get(folder).length})`;
+        container.appendChild(title);
+
+        groups.get(folder)
+            .sort((a, b) => a.name.localeCompare(b.name))
+            .forEach(item => container.appendChild(libraryCard(item)));
+    });
+}
+
+function libraryCard(item) {
+    const card = document.createElement('div');
+    card.className = `dashboard-card ${selectedLibraries.has(item.uid) ? 'selected' : ''}`;
+
+    const check = document.createElement('span');
+    check.className = 'custom-check check-left';
+    const checkbox = document.createElement('input');
+    checkbox.type = 'checkbox';
+    checkbox.checked = selectedLibraries.has(item.uid);
+    const checkmark = document.createElement('span');
+    checkmark.className = 'checkmark';
+    check.append(checkbox, checkmark);
+
+    const info = document.createElement('div');
+    info.className = 'dashboard-card-info';
+    const title = document.createElement('div');
+    title.className = 'dashboard-card-title';
+    title.textContent = item.name;
+    const meta = document.createElement('div');
+    meta.className = 'dashboard-card-meta';
+    meta.textContent = [item.kind === 2 ? 'Variable' : 'Panel', formatRelativeTime(item.meta && item.meta.updated)]
+        .filter(Boolean).join(' · ');
+    info.append(title, meta);
+    card.append(check, info);
+    if (libraryConnections[item.uid]) meta.textContent = `Used by: ${libraryConnections[item.uid]}`;
+
+    if (item.usedBy !== undefined) {
+        const usedBy = document.createElement('span');
+        usedBy.className = `level-badge library-used-by ${item.usedBy === 0 ? 'unused' : ''}`;
+        usedBy.textContent = item.usedBy === 0 ? 'Unused' : `Used by ${item.usedBy}`;
+        if (item.usedBy > 0) {
+            usedBy.title = 'Show the dashboards using this panel';
+            usedBy.addEventListener('click', e => {
+                e.stopPropagation();
+                showLibraryConnections(item.uid, meta);
+            });
+        }
+        card.appendChild(usedBy);
+    }
+
+    card.addEventListener('click', e => {
+        if (e.target !== checkbox) checkbox.checked = !checkbox.checked;
+        if (checkbox.checked) {
+            selectedLibraries.add(item.uid);
+        } else {
+            selectedLibraries.delete(item.uid);
+        }
+        card.classList.toggle('selected', checkbox.checked);
+        updateSelectedCount();
+    });
+    return card;
+}
+
+async function showLibraryConnections(uid, meta) {
+    if (!libraryConnections[uid]) {
+        try {
+            const response = await apiFetch(orgUrl(`/api/libraries/${encodeURIComponent(uid)}/connections`));
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || `HTTP ${response.status}`);
+            libraryConnections[uid] = data.dashboards.map(dash => dash.title || dash.uid || `ID ${dash.id}`).join(', ');
+        } catch (error) {
+            showAlert('error', `Failed to load the dashboards using this panel: ${error.message}`);
+            return;
+        }
+    }
+    meta.textContent = `Used by: ${libraryConnections[uid]}`;
+}
+
+function selectAllLibraries() {
+    if (!libraries) return;
+    filteredLibraries().forEach(item => selectedLibraries.add(item.uid));
+    renderLibraries();
+    updateSelectedCount();
+}
+
+function clearLibrarySelection() {
+    selectedLibraries.clear();
+    renderLibraries();
+    updateSelectedCount();
+}
+
+// ── Dependencies ──
+// The dependency graph is only read on request, as it needs the model of
+// every dashboard and library panel. Picking an object lists everything that
+// depends on it, directly or through other objects.
+const graphKindLabels = {
+    'dashboard': 'Dashboard',
+    'library-panel': 'Library panel',
+    'datasource': 'Datasource',
+    'alert-rule': 'Alert rule'
+};
+
+async function loadDependencyGraph() {
+    const button = document.getElementById('loadGraphBtn');
+    button.disabled = true;
+    try {
+        const response = await apiFetch(orgUrl(`/api/graph${dependencyGraph && hasRole('admin') ? '?refresh=true' : ''}`));
+        const data = await response.json();
+        if (!response.ok) throw new Error(data.error || `HTTP ${response.status}`);
+        dependencyGraph = data;
+    } catch (error) {
+        showAlert('error', `Failed to load the dependency graph: ${error.message}`);
+        return;
+    } finally {
+        button.disabled = false;
+    }
+
+    graphLabels = new Map();
+    const datalist = document.getElementById('graphObjects');
+    datalist.replaceChildren();
+    dependencyGraph.nodes.forEach(node => {
+        let label = `${node.name} (${graphKindLabels[node.kind] || node.kind})`;
+        if (graphLabels.has(label)) label = `${node.name} (${graphKindLabels[node.kind] || node.kind} ${node.uid})`;
+        graphLabels.set(label, node.id);
+        const option = document.createElement('option');
+        option.value = label;
+        datalist.appendChild(option);
+    });
+
+    button.textContent = 'Refresh';
+    document.getElementById('graphObjectInput').disabled = false;
+    document.getElementById('downloadGraphBtn').disabled = false;
+    if (dependencyGraph.errors.length > 0) {
+        showAlert('warning', `${dependencyGraph.errors.length} objects could not be read; their dependencies are missing`);
+    }
+    renderDependents();
+}
+
+function resetDependencyGraph() {
+    dependencyGraph = null;
+    graphObjectId = null;
+    graphLabels = new Map();
+    document.getElementById('graphObjects').replaceChildren();
+    const input = document.getElementById('graphObjectInput');
+    input.value = '';
+    input.disabled = true;
+    document.getElementById('loadGraphBtn').textContent = 'Load';
+    document.getElementById('downloadGraphBtn').disabled = true;
+    const container = document.getElementById('graphContainer');
+    container.innerHTML = '<div class="dashboards-empty"><p>Load the graph to see what depends on an object</p></div>';
+}
+
+// dependentsOf maps every object depending on id to whether it does so directly
+function dependentsOf(id) {
+    const found = new Map();
+    const queue = [id];
+    while (queue.length > 0) {
+        const target = queue.shift();
+        dependencyGraph.edges.forEach(edge => {
+            if (edge.to === target && edge.from !== id && !found.has(edge.from)) {
+                found.set(edge.from, target === id);
+                queue.push(edge.from);
+            }
+        });
+    }
+    return found;
+}
+
+function renderDependents() {
+    const container = document.getElementById('graphContainer');
+    container.replaceChildren();
+    if (!dependencyGraph) return;
+
+    const showMessage = text => {
+        const empty = document.createElement('div');
+        empty.className = 'dashboards-empty';
+        const message = document.createElement('p');
+        message.textContent = text;
+        empty.appendChild(message);
+        container.appendChild(empty);
+    };
+    if (!graphObjectId) {
+        showMessage(`${dependencyGraph.nodes.length} objects and ${dependencyGraph.edges.length} references loaded. Pick an object to see its dependents.`);
+        return;
+    }
+
+    const nodes = new Map(dependencyGraph.nodes.map(node => [node.id, node]));
+    const dependents = dependentsOf(graphObjectId);
+    if (dependents.size === 0) {
+        showMessage('Nothing depends on this object');
+        return;
+    }
+
+    Object.keys(graphKindLabels).forEach(kind => {
+        const group = Array.from(dependents.keys())
+            .map(id => nodes.get(id))
+            .filter(node => node && node.kind === kind)
+            .sort((a, b) => a.name.localeCompare(b.name));
+        if (group.length === 0) return;
+
+        const title = document.createElement('div');
+        title.className = 'panel-title library-group-title';
+        title.textContent = `${graphKindLabels[kind]}s (${group.length})`;
+        container.appendChild(title);
+
+        group.forEach(node => {
+            const card = document.createElement('div');
+            card.className = 'dashboard-card';
+            const info = document.createElement('div');
+            info.className = 'dashboard-card-info';
+            const name = document.createElement('div');
+            name.className = 'dashboard-card-title';
+            name.textContent = node.name;
+            const meta = document.createElement('div');
+            meta.className = 'dashboard-card-meta';
+            meta.textContent = [node.uid, dependents.get(node.id) ? 'Directly' : 'Through other objects']
+                .join(' · ');
+            info.append(name, meta);
+            card.appendChild(info);
+            container.appendChild(card);
+        });
+    });
+}
+
+async function downloadDependencyGraph() {
+    const params = new URLSearchParams({ format: 'dot' });
+    if (graphObjectId) params.set('dependents', graphObjectId);
+    try {
+        const response = await apiFetch(orgUrl(`/api/graph?${params}`));
+        if (!response.ok) {
+            const data = await response.json().catch(() => ({}));
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+        const url = window.URL.createObjectURL(await response.blob());
+        const link = document.createElement('a');
+        link.href = url;
+        link.download = 'dependencies.dot';
+        document.body.appendChild(link);
+        link.click();
+        link.remove();
+        window.URL.revokeObjectURL(url);
+    } catch (error) {
+        showAlert('error', `Failed to download the dependency graph: ${error.message}`);
+    }
+}
+
+// ── Other Objects ──
+// Playlists, snapshots and the other object types are listed one tab at a
+// time; selections are kept per type.
+async function loadObjects() {
+    const kind = objectKind;
+    const container = document.getElementById('objectsContainer');
+    if (!objects[kind]) {
+        container.innerHTML = '<div class="dashboards-empty"><div class="spinner"></div></div>';
+        try {
+            const response = await apiFetch(orgUrl(`/api/${kind}`));
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || `HTTP ${response.status}`);
+            objects[kind] = { available: data.available, items: data[kind] || [] };
+        } catch (error) {
+            objects[kind] = { available: true, items: [], error: error.message };
+        }
+    }
+    if (kind === objectKind) renderObjects();
+}
+
+function switchObjectKind(kind) {
+    objectKind = kind;
+    document.querySelectorAll('.object-tab').forEach(tab => {
+        tab.classList.toggle('active', tab.dataset.kind === kind);
+    });
+    loadObjects();
+}
+
+function renderObjects() {
+    const container = document.getElementById('objectsContainer');
+    const { available, items, error } = objects[objectKind];
+    const selected = selectedObjects[objectKind] || new Set();
+    container.replaceChildren();
+
+    if (error || !available || items.length === 0) {
+        const empty = document.createElement('div');
+        empty.className = 'dashboards-empty';
+        const message = document.createElement('p');
+        message.textContent = error ? `Failed to load: ${error}`
+            : !available ? 'Not available in this Grafana' : 'Nothing found';
+        empty.appendChild(message);
+        container.appendChild(empty);
+        return;
+    }
+
+    items.forEach(item => {
+        const card = document.createElement('div');
+        card.className = `dashboard-card ${selected.has(item.uid) ? 'selected' : ''}`;
+
+        const check = document.createElement('span');
+        check.className = 'custom-check check-left';
+        const checkbox = document.createElement('input');
+        checkbox.type = 'checkbox';
+        checkbox.checked = selected.has(item.uid);
+        const checkmark = document.createElement('span');
+        checkmark.className = 'checkmark';
+        check.append(checkbox, checkmark);
+
+        const info = document.createElement('div');
+        info.className = 'dashboard-card-info';
+        const title = document.createElement('div');
+        title.className = 'dashboard-card-title';
+        title.textContent = item.name;
+        const meta = document.createElement('div');
+        meta.className = 'dashboard-card-meta';
+        meta.textContent = [item.dashboardUid ? `Dashboard ${item.dashboardUid}` : '', formatRelativeTime(item.updated)]
+            .filter(Boolean).join(' · ');
+        info.append(title, meta);
+
+        card.append(check, info);
+        card.addEventListener('click', e => {
+            if (e.target !== checkbox) checkbox.checked = !checkbox.checked;
+            toggleObjectSelection(item.uid, checkbox.checked);
+            card.classList.toggle('selected', checkbox.checked);
+        });
+        container.appendChild(card);
+    });
+}
+
+function toggleObjectSelection(uid, isSelected) {
+    if (!selectedObjects[objectKind]) selectedObjects[objectKind] = new Set();
+    if (isSelected) {
+        selectedObjects[objectKind].add(uid);
+    } else {
+        selectedObjects[objectKind].delete(uid);
+    }
+    updateSelectedCount();
+}
+
+function selectAllObjects() {
+    const loaded = objects[objectKind];
+    if (!loaded) return;
+    selectedObjects[objectKind] = new Set(loaded.items.map(item => item.uid));
+    renderObjects();
+    updateSelectedCount();
+}
+
+function clearObjectSelection() {
+    selectedObjects[objectKind] = new Set();
+    renderObjects();
+    updateSelectedCount();
+}
+
+function selectedObjectCount() {
+    return Object.values(selectedObjects).reduce((count, uids) => count + uids.size, 0);
+}
+
 function renderAlerts() {
     if (filteredAlerts.length === 0) {
         alertsContainer.innerHTML = `
@@ -421,6 +1430,7 @@ function renderAlerts() {
                 <div class="dashboard-card-info">
                     <div class="dashboard-card-title">${alert.title}</div>
                     <div class="dashboard-card-meta">${folderName}</div>
+                    <div class="dashboard-card-meta alert-dashboard"></div>
                 </div>
                 <span class="custom-check check-right">
                     <input type="checkbox" class="alert-checkbox-r" data-uid="${alert.uid}" ${isSelected ? 'checked' : ''} tabindex="-1">
@@ -432,6 +1442,17 @@ function renderAlerts() {
 
     alertsContainer.innerHTML = html;
 
+    // Dashboard titles are user content, so they are set as text
+    alertsContainer.querySelectorAll('.dashboard-card').forEach((card, i) => {
+        const alert = filteredAlerts[i];
+        const meta = card.querySelector('.alert-dashboard');
+        if (alert.dashboardUid) {
+            meta.textContent = `Dashboard: ${alert.dashboardTitle || alert.dashboardUid}`;
+        } else {
+            meta.remove();
+        }
+    });
+
     alertsContainer.querySelectorAll('.dashboard-card').forEach(card => {
         card.addEventListener('click', function(e) {
             if (e.target.type === 'checkbox') return;
@@ -562,17 +1583,25 @@ function clearAlertSelection() {
 function updateSelectedCount() {
     const dashCount = selectedDashboards.size;
     const alertCount = selectedAlerts.size;
-    const totalCount = dashCount + alertCount;
+    const objectCount = selectedObjectCount();
+    const totalCount = dashCount + alertCount + selectedLibraries.size + objectCount;
 
     selectedDashCountEl.textContent = dashCount;
     selectedAlertCountEl.textContent = alertCount;
+    document.getElementById('selectedLibraryCount').textContent = selectedLibraries.size;
+    document.getElementById('selectedObjectCount').textContent = objectCount;
 
     // Count unique folders
     const folderIds = new Set();
     dashboards.filter(d => selectedDashboards.has(d.uid)).forEach(d => folderIds.add(d.folderId));
     selectedFolderCountEl.textContent = folderIds.size;
 
-    exportBtn.disabled = appConfig.forceEnableZipExport ? false : (totalCount === 0);
+    if (exportAllOrgsCheck.checked) {
+        exportBtn.disabled = false;
+        exportBtn.textContent = `Export all (${organizations.length} organizations)`;
+        return;
+    }
+    exportBtn.disabled = appConfig.forceEnableZipExport || includeIdentityCheck.checked ? false : (totalCount === 0);
     exportBtn.textContent = `Export (${totalCount})`;
 
 }
@@ -594,22 +1623,36 @@ function applySorting() {
 
 // ── Export ──
 async function exportSelectedDashboards() {
-    if (selectedDashboards.size === 0 && selectedAlerts.size === 0) {
-        showAlert('warning', 'Please select at least one dashboard or alert to export');
+    const allOrgs = exportAllOrgsCheck.checked;
+    if (!allOrgs && !includeIdentityCheck.checked && selectedDashboards.size === 0 && selectedAlerts.size === 0 && selectedLibraries.size === 0 && selectedObjectCount() === 0) {
+        showAlert('warning', 'Please select at least one dashboard, alert, library panel or other object to export');
         return;
     }
 
     try {
         showLoading('Exporting dashboards, alerts, and linked libraries...');
 
-        const response = await fetch('/api/export', {
+        const response = await apiFetch('/api/export', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({
-                dashboardUIDs: Array.from(selectedDashboards),
-                alertUIDs: Array.from(selectedAlerts),
+                dashboardUIDs: allOrgs ? [] : Array.from(selectedDashboards),
+                alertUIDs: allOrgs ? [] : Array.from(selectedAlerts),
+                libraryUIDs: allOrgs ? [] : Array.from(selectedLibraries),
                 includeAlerts: includeAlertsCheck.checked,
-                exportAsZip: exportAsZipCheck.checked
+                includeLinkedAlerts: includeLinkedAlertsCheck.checked,
+                includePermissions: document.getElementById('includePermissionsCheck').checked,
+                includeIdentity: includeIdentityCheck.checked,
+                includeVersions: includeVersionsCheck.checked,
+                versionLimit: Math.max(0, parseInt(document.getElementById('versionLimitInput').value, 10) || 0),
+                includeAnnotations: includeAnnotationsCheck.checked,
+                annotationsFrom: annotationsFrom(),
+                objects: allOrgs ? {} : Object.fromEntries(
+                    Object.entries(selectedObjects).map(([kind, uids]) => [kind, Array.from(uids)])
+                ),
+                exportAsZip: exportAsZipCheck.checked,
+                orgId: currentOrgId || 0,
+                orgIds: allOrgs ? organizations.map(org => org.id) : []
             })
         });
 
@@ -647,16 +1690,41 @@ async function exportSelectedDashboards() {
     } catch (error) {
         hideLoading();
         showAlert('error', `Export failed: ${error.message}`);
+    } finally {
+        if (hasRole('admin')) loadAuditLog();
     }
 }
 
+// annotationsFrom is the start of the chosen annotation range in epoch ms,
+// or 0 for all time
+function annotationsFrom() {
+    const days = parseInt(document.getElementById('annotationsRangeSelect').value, 10) || 0;
+    return days > 0 ? Date.now() - days * 86400000 : 0;
+}
+
 function showExportResults(result) {
     let html = `
         <p>Successfully exported <strong>${result.exportedDashboards}</strong> dashboards,
            <strong>${result.exportedAlerts || 0}</strong> alerts, and
-           <strong>${result.exportedLibraries}</strong> linked library panels.</p>
+           <strong>${result.exportedLibraries}</strong> library panels.</p>
         <p>Export path: <code>${result.exportPath}</code></p>
     `;
+    if (result.exportedVersions) {
+        html += `<p>Version history: <strong>${result.exportedVersions}</strong> dashboard versions.</p>`;
+    }
+    if (result.exportedAnnotations) {
+        html += `<p>Annotations: <strong>${result.exportedAnnotations}</strong>.</p>`;
+    }
+    const objectCounts = Object.entries(result.exportedObjects || {});
+    if (objectCounts.length > 0) {
+        html += `<p>Other objects: ${objectCounts.map(([kind, count]) => `<strong>${count}</strong> ${kind}`).join(', ')}.</p>`;
+    }
+    if (result.exportedIdentities) {
+        html += `<p>Identity: <strong>${result.exportedIdentities}</strong> teams, users and service accounts.</p>`;
+    }
+    if (result.organizations && result.organizations.length > 0) {
+        html += `<p>Organizations: ${result.organizations.join(', ')}</p>`;
+    }
 
     if (result.errors && result.errors.length > 0) {
         html += `
@@ -672,6 +1740,19 @@ function showExportResults(result) {
 }
 
 // ── Utilities ──
+// apiFetch wraps fetch and sends the browser to the login page when the
+// exporter requires an interactive login.
+async function apiFetch(url, options = {}) {
+    const response = await fetch(url, { credentials: 'same-origin', ...options });
+    if (response.status === 401) {
+        const data = await response.clone().json().catch(() => ({}));
+        if (data.loginUrl) {
+            window.location.href = data.loginUrl;
+        }
+    }
+    return response;
+}
+
 function formatRelativeTime(dateString) {
     if (!dateString) return '';
     try {
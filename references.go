@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// dashboardLinkPattern matches the path of a dashboard URL, /d/<uid>/<slug>
+// or /d-solo/<uid>/<slug>, in relative and absolute links alike.
+var dashboardLinkPattern = regexp.MustCompile(`(?:^|/)d(?:-solo)?/([A-Za-z0-9_-]{1,40})(?:[/?#]|$)`)
+
+// builtinDatasources are the pseudo datasources Grafana provides itself.
+// Nothing breaks when they are missing from an instance, so they are not
+// references.
+var builtinDatasources = map[string]bool{
+	"grafana":         true,
+	"-- Grafana --":   true,
+	"-- Mixed --":     true,
+	"-- Dashboard --": true,
+}
+
+// datasourceRef is a datasource a dashboard queries. Dashboards from before
+// Grafana 8.3 refer to datasources by name only.
+type datasourceRef struct {
+	UID  string `json:"uid,omitempty"`
+	Type string `json:"type,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// dashboardReferences are the objects a dashboard model depends on, each
+// listed once in the order found.
+type dashboardReferences struct {
+	LibraryPanels  []string        `json:"libraryPanels"`
+	Datasources    []datasourceRef `json:"datasources"`
+	DashboardLinks []string        `json:"dashboardLinks"` // UIDs of the dashboards linked to
+}
+
+// extractReferences walks a dashboard model of any schema version and
+// collects what it refers to, wherever it is nested: panels in rows,
+// collapsed rows and the rows[] of schema versions before 16, and the
+// elements, grid, rows and tabs layouts of the v2 schema. Datasources given
+// by template variable, such as ${DS_PROMETHEUS}, are resolved only when the
+// dashboard is viewed and are left out.
+func extractReferences(model map[string]interface{}) dashboardReferences {
+	collector := referenceCollector{
+		refs: dashboardReferences{
+			LibraryPanels:  []string{},
+			Datasources:    []datasourceRef{},
+			DashboardLinks: []string{},
+		},
+		seen: make(map[string]bool),
+	}
+	collector.walk(model)
+	return collector.refs
+}
+
+type referenceCollector struct {
+	refs dashboardReferences
+	seen map[string]bool
+}
+
+// walk visits every object below value, in key order so that the result
+// does not depend on map iteration.
+func (r *referenceCollector) walk(value interface{}) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			r.walk(item)
+		}
+	case map[string]interface{}:
+		r.inspect(v)
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			r.walk(v[key])
+		}
+	}
+}
+
+func (r *referenceCollector) inspect(object map[string]interface{}) {
+	// A panel linked to a library panel, as libraryPanel in panels of the
+	// classic schema and in LibraryPanel elements of v2
+	if library, ok := object["libraryPanel"].(map[string]interface{}); ok {
+		if uid, ok := library["uid"].(string); ok && uid != "" && !r.seen["library:"+uid] {
+			r.seen["library:"+uid] = true
+			r.refs.LibraryPanels = append(r.refs.LibraryPanels, uid)
+		}
+	}
+
+	switch datasource := object["datasource"].(type) {
+	case string:
+		// A name before Grafana 8.3
+		r.addDatasource(datasourceRef{Name: datasource})
+	case map[string]interface{}:
+		ref := datasourceRef{}
+		ref.UID, _ = datasource["uid"].(string)
+		ref.Type, _ = datasource["type"].(string)
+		if ref.UID == "" {
+			// The v2beta1 schema names the datasource and types its query
+			ref.UID, _ = datasource["name"].(string)
+		}
+		if group, ok := object["group"].(string); ok && ref.Type == "" {
+			ref.Type = group
+		}
+		r.addDatasource(ref)
+	}
+
+	if url, ok := object["url"].(string); ok {
+		if match := dashboardLinkPattern.FindStringSubmatch(url); match != nil && !r.seen["dashboard:"+match[1]] {
+			r.seen["dashboard:"+match[1]] = true
+			r.refs.DashboardLinks = append(r.refs.DashboardLinks, match[1])
+		}
+	}
+}
+
+func (r *referenceCollector) addDatasource(ref datasourceRef) {
+	key := ref.UID
+	if key == "" {
+		key = ref.Name
+	}
+	if key == "" || strings.HasPrefix(key, "$") || builtinDatasources[key] || ref.Type == "datasource" {
+		return
+	}
+	if r.seen["datasource:"+key] {
+		return
+	}
+	r.seen["datasource:"+key] = true
+	r.refs.Datasources = append(r.refs.Datasources, ref)
+}
+
+// extractLibraryPanelUIDs returns the library panels a dashboard uses, at any
+// depth and in any schema version.
+func extractLibraryPanelUIDs(dashboard map[string]interface{}) ([]string, error) {
+	if panels, ok := dashboard["panels"]; ok {
+		if _, ok := panels.([]interface{}); !ok {
+			return []string{}, fmt.Errorf("panels is not an array")
+		}
+	}
+	return extractReferences(dashboard).LibraryPanels, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseDashboardModel(t *testing.T, model string) map[string]interface{} {
+	t.Helper()
+	var dashboard map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(model), &dashboard))
+	return dashboard
+}
+
+func TestExtractReferencesClassicSchema(t *testing.T) {
+	// Panels in an open row follow it at the top level, those of a
+	// collapsed row are nested in it
+	dashboard := parseDashboardModel(t, `{
+		"schemaVersion": 39,
+		"links": [
+			{"type": "link", "url": "/d/overview/overview?orgId=1"},
+			{"type": "dashboards", "tags": ["prod"]}
+		],
+		"annotations": {"list": [
+			{"builtIn": 1, "datasource": {"type": "grafana", "uid": "-- Grafana --"}}
+		]},
+		"templating": {"list": [
+			{"type": "query", "datasource": {"type": "prometheus", "uid": "prom-1"}},
+			{"type": "datasource", "query": "prometheus"}
+		]},
+		"panels": [
+			{"type": "row", "collapsed": false, "panels": []},
+			{"id": 1, "libraryPanel": {"uid": "lib-cpu", "name": "CPU"}},
+			{"id": 2, "type": "timeseries",
+				"datasource": {"type": "datasource", "uid": "-- Mixed --"},
+				"targets": [
+					{"datasource": {"type": "prometheus", "uid": "prom-1"}},
+					{"datasource": {"type": "loki", "uid": "loki-1"}},
+					{"datasource": {"type": "prometheus", "uid": "${DS_PROMETHEUS}"}}
+				],
+				"fieldConfig": {"defaults": {"links": [
+					{"title": "Details", "url": "https://grafana.example.com/d/details/service-details?var-host=${__field.labels.host}"}
+				]}}
+			},
+			{"type": "row", "collapsed": true, "panels": [
+				{"id": 4, "libraryPanel": {"uid": "lib-errors", "name": "Errors"}},
+				{"id": 5, "libraryPanel": {"uid": "lib-cpu", "name": "CPU"}},
+				{"id": 6, "type": "text", "links": [{"url": "/d-solo/solo/panel?panelId=2"}, {"url": "https://example.com/docs"}]}
+			]}
+		]
+	}`)
+
+	assert.Equal(t, dashboardReferences{
+		LibraryPanels: []string{"lib-cpu", "lib-errors"},
+		Datasources: []datasourceRef{
+			{UID: "prom-1", Type: "prometheus"},
+			{UID: "loki-1", Type: "loki"},
+		},
+		DashboardLinks: []string{"overview", "details", "solo"},
+	}, extractReferences(dashboard))
+}
+
+func TestExtractReferencesLegacyRows(t *testing.T) {
+	// Before schema version 16 panels lived in rows[], and datasources were
+	// named rather than referenced by UID
+	dashboard := parseDashboardModel(t, `{
+		"schemaVersion": 14,
+		"rows": [
+			{"title": "Overview", "panels": [
+				{"id": 1, "datasource": "Prometheus", "targets": [{"expr": "up"}]},
+				{"id": 2, "datasource": null, "libraryPanel": {"uid": "lib-old", "name": "Old"}}
+			]},
+			{"title": "Logs", "panels": [
+				{"id": 3, "datasource": "-- Mixed --", "targets": [{"datasource": "Loki"}, {"datasource": "$logs"}]}
+			]}
+		]
+	}`)
+
+	refs := extractReferences(dashboard)
+	assert.Equal(t, []string{"lib-old"}, refs.LibraryPanels)
+	assert.Equal(t, []datasourceRef{{Name: "Prometheus"}, {Name: "Loki"}}, refs.Datasources)
+	assert.Empty(t, refs.DashboardLinks)
+}
+
+func TestExtractReferencesV2Schema(t *testing.T) {
+	// Panels are elements referred to from a layout; rows and tabs nest
+	// further layouts. v2alpha1 references datasources by uid, v2beta1 names
+	// them and gives the type as the query's group.
+	dashboard := parseDashboardModel(t, `{
+		"apiVersion": "dashboard.grafana.app/v2beta1",
+		"kind": "Dashboard",
+		"spec": {
+			"links": [{"title": "Runbook", "url": "/d/runbook"}],
+			"elements": {
+				"panel-1": {"kind": "Panel", "spec": {"id": 1, "data": {"kind": "QueryGroup", "spec": {"queries": [
+					{"kind": "PanelQuery", "spec": {"query": {"kind": "DataQuery", "group": "prometheus", "datasource": {"name": "prom-1"}, "spec": {"expr": "up"}}}},
+					{"kind": "PanelQuery", "spec": {"datasource": {"type": "loki", "uid": "loki-1"}, "query": {"kind": "loki", "spec": {}}}}
+				]}}}},
+				"panel-2": {"kind": "LibraryPanel", "spec": {"id": 2, "title": "CPU", "libraryPanel": {"uid": "lib-cpu", "name": "CPU"}}},
+				"panel-3": {"kind": "LibraryPanel", "spec": {"id": 3, "title": "Errors", "libraryPanel": {"uid": "lib-errors", "name": "Errors"}}}
+			},
+			"layout": {"kind": "TabsLayout", "spec": {"tabs": [
+				{"kind": "TabsLayoutTab", "spec": {"title": "Main", "layout": {"kind": "RowsLayout", "spec": {"rows": [
+					{"kind": "RowsLayoutRow", "spec": {"title": "Top", "layout": {"kind": "GridLayout", "spec": {"items": [
+						{"kind": "GridLayoutItem", "spec": {"element": {"kind": "ElementReference", "name": "panel-1"}}}
+					]}}}}
+				]}}}},
+				{"kind": "TabsLayoutTab", "spec": {"title": "Library", "layout": {"kind": "AutoGridLayout", "spec": {"items": [
+					{"kind": "AutoGridLayoutItem", "spec": {"element": {"kind": "ElementReference", "name": "panel-2"}}}
+				]}}}}
+			]}},
+			"variables": [
+				{"kind": "QueryVariable", "spec": {"name": "job", "query": {"kind": "DataQuery", "group": "prometheus", "datasource": {"name": "prom-2"}}}}
+			]
+		}
+	}`)
+
+	assert.Equal(t, dashboardReferences{
+		LibraryPanels: []string{"lib-cpu", "lib-errors"},
+		Datasources: []datasourceRef{
+			{UID: "prom-1", Type: "prometheus"},
+			{UID: "loki-1", Type: "loki"},
+			{UID: "prom-2", Type: "prometheus"},
+		},
+		DashboardLinks: []string{"runbook"},
+	}, extractReferences(dashboard))
+}
+
+func TestExtractLibraryPanelUIDsAtAnyDepth(t *testing.T) {
+	dashboard := parseDashboardModel(t, `{"panels": [
+		{"type": "row", "panels": [
+			{"type": "row", "panels": [
+				{"type": "row", "panels": [{"libraryPanel": {"uid": "deep"}}]}
+			]}
+		]}
+	]}`)
+
+	uids, err := extractLibraryPanelUIDs(dashboard)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"deep"}, uids)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Roles inside the exporter, from least to most privileged.
+const (
+	roleNone     = "none"
+	roleViewer   = "viewer"   // list folders, dashboards and library panels
+	roleExporter = "exporter" // also export dashboards and library panels
+	roleAdmin    = "admin"    // also alerts, restores and administrative endpoints
+)
+
+var roleRanks = map[string]int{
+	roleNone:     0,
+	roleViewer:   1,
+	roleExporter: 2,
+	roleAdmin:    3,
+}
+
+// roleMapper assigns roles to authenticated users. An explicit user mapping
+// always wins, so that a single user can also be demoted; otherwise the user
+// gets the highest role granted by their identity provider groups, and at
+// least the default role.
+type roleMapper struct {
+	users       map[string]string // user name -> role
+	groups      map[string]string // group -> role
+	defaultRole string
+}
+
+func newRoleMapper(cfg Config) (*roleMapper, error) {
+	users, err := parseRoleList(cfg.AuthUserRoles, "AUTH_USER_ROLES")
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := parseRoleList(cfg.AuthGroupRoles, "AUTH_GROUP_ROLES")
+	if err != nil {
+		return nil, err
+	}
+
+	defaultRole := cfg.AuthDefaultRole
+	if defaultRole == "" {
+		defaultRole = roleViewer
+	}
+	if _, ok := roleRanks[defaultRole]; !ok {
+		return nil, fmt.Errorf("invalid AUTH_DEFAULT_ROLE %q", defaultRole)
+	}
+
+	return &roleMapper{users: users, groups: groups, defaultRole: defaultRole}, nil
+}
+
+// parseRoleList parses "name:role,name2:role2" and checks every role.
+func parseRoleList(value, setting string) (map[string]string, error) {
+	roles, err := parseCredentialList(value, setting)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, role := range roles {
+		if _, ok := roleRanks[role]; !ok {
+			return nil, fmt.Errorf("invalid role %q for %q in %s, expected viewer, exporter, admin or none", role, name, setting)
+		}
+	}
+	return roles, nil
+}
+
+func (m *roleMapper) RoleFor(user *User) string {
+	if mapped, ok := m.users[user.Name]; ok {
+		return mapped
+	}
+
+	role := m.defaultRole
+	for _, group := range user.Groups {
+		if mapped, ok := m.groups[group]; ok && roleRanks[mapped] > roleRanks[role] {
+			role = mapped
+		}
+	}
+
+	return role
+}
+
+// hasRole reports whether user holds role or a more privileged one.
+func hasRole(user *User, role string) bool {
+	return roleRanks[user.Role] >= roleRanks[role]
+}
+
+// requireRole rejects requests from users below the given role.
+func requireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !hasRole(currentUser(c), role) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": fmt.Sprintf("This action requires the %s role", role),
+				})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleMapper(t *testing.T) {
+	mapper, err := newRoleMapper(Config{
+		AuthUserRoles:  "alice:admin,ci:exporter",
+		AuthGroupRoles: "ops:exporter,platform:admin",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, roleAdmin, mapper.RoleFor(&User{Name: "alice"}))
+	assert.Equal(t, roleExporter, mapper.RoleFor(&User{Name: "ci"}))
+	assert.Equal(t, roleViewer, mapper.RoleFor(&User{Name: "bob"}))
+	assert.Equal(t, roleExporter, mapper.RoleFor(&User{Name: "bob", Groups: []string{"ops"}}))
+
+	// The most privileged group wins, but an explicit user mapping overrides groups
+	assert.Equal(t, roleAdmin, mapper.RoleFor(&User{Name: "bob", Groups: []string{"ops", "platform"}}))
+	assert.Equal(t, roleExporter, mapper.RoleFor(&User{Name: "ci", Groups: []string{"platform"}}))
+
+	mapper, err = newRoleMapper(Config{AuthDefaultRole: roleNone})
+	assert.NoError(t, err)
+	assert.Equal(t, roleNone, mapper.RoleFor(&User{Name: "bob"}))
+}
+
+func TestRoleMapperInvalidConfig(t *testing.T) {
+	_, err := newRoleMapper(Config{AuthUserRoles: "alice:superuser"})
+	assert.Error(t, err)
+
+	_, err = newRoleMapper(Config{AuthDefaultRole: "owner"})
+	assert.Error(t, err)
+}
+
+func TestRequireRole(t *testing.T) {
+	e, _ := newAuthTestServer(t, Config{
+		AuthBasicUsers: "viewer:pass,exporter:pass,admin:pass,nobody:pass",
+		AuthUserRoles:  "exporter:exporter,admin:admin,nobody:none",
+	})
+	e.GET("/api/listing", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, requireRole(roleViewer))
+	e.POST("/api/export", exportDashboards, requireRole(roleExporter))
+	e.GET("/api/alerts", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, requireRole(roleAdmin))
+
+	request := func(method, target, user, body string) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.SetBasicAuth(user, "pass")
+		return serve(e, req).Code
+	}
+
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/listing", "viewer", ""))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/api/listing", "nobody", ""))
+
+	// An empty export is a bad request once the role check has passed
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, "/api/export", "viewer", "{}"))
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/api/export", "exporter", "{}"))
+
+	alertExport := `{"alertUIDs":["a1"],"includeAlerts":true}`
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, "/api/export", "exporter", alertExport))
+
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/api/alerts", "exporter", ""))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/alerts", "admin", ""))
+
+	// /api/me reports the role to the UI
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.SetBasicAuth("exporter", "pass")
+	assert.Contains(t, serve(e, req).Body.String(), `"role":"exporter"`)
+}
+
+func TestAuthDisabledGrantsAdmin(t *testing.T) {
+	e, _ := newAuthTestServer(t, Config{})
+	e.GET("/api/alerts", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, requireRole(roleAdmin))
+
+	rec := serve(e, httptest.NewRequest(http.MethodGet, "/api/alerts", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultSettingsFile    = "./settings.json"
+	encryptedSettingPrefix = "enc:v1:"
+)
+
+// uiSettings are the settings an admin can change from the settings page.
+var uiSettings = []string{"GRAFANA_URL", "GRAFANA_API_KEY", "SKIP_TLS_VERIFY", "EXPORT_DIRECTORY"}
+
+// settingsKeySource finds the key secrets in the settings file are encrypted
+// with: SETTINGS_KEY (or SETTINGS_KEY_FILE) from the environment or .env, or
+// else a random key kept in keyFile next to the settings.
+type settingsKeySource struct {
+	environment configSource
+	dotenv      configSource
+	keyFile     string
+}
+
+// key returns the 32 byte encryption key. With create, a missing key file is
+// generated.
+func (s settingsKeySource) key(create bool) ([]byte, error) {
+	keySetting := configSetting{name: "SETTINGS_KEY", secret: true}
+	for _, source := range []configSource{s.environment, s.dotenv} {
+		secret, ok, err := source.lookup(keySetting)
+		if err != nil {
+			return nil, err
+		}
+		if ok && secret != "" {
+			sum := sha256.Sum256([]byte(secret))
+			return sum[:], nil
+		}
+	}
+
+	encoded, err := os.ReadFile(s.keyFile)
+	if err == nil {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("%s does not hold a valid key", s.keyFile)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) || !create {
+		return nil, fmt.Errorf("SETTINGS_KEY is not set and %s cannot be read: %v", s.keyFile, err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(s.keyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600); err != nil {
+		return nil, fmt.Errorf("could not store the settings key: %v", err)
+	}
+	log.Printf("Generated a key for encrypting settings in %s, set SETTINGS_KEY to keep it elsewhere", s.keyFile)
+	return key, nil
+}
+
+// currentSettingsKeys returns the key source for the running configuration.
+func currentSettingsKeys() settingsKeySource {
+	dotenv, _ := dotenvSource()
+	return settingsKeySource{
+		environment: environmentSource(),
+		dotenv:      dotenv,
+		keyFile:     currentConfigStatus().SettingsFile + ".key",
+	}
+}
+
+// encryptSetting seals a secret with AES-GCM; the random nonce is stored in
+// front of the ciphertext.
+func encryptSetting(key []byte, plaintext string) (string, error) {
+	gcm, err := newSettingsCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedSettingPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptSetting(key []byte, value string) (string, error) {
+	gcm, err := newSettingsCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedSettingPrefix))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt, was SETTINGS_KEY changed?")
+	}
+	return string(plaintext), nil
+}
+
+func newSettingsCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readSavedSettings returns the settings file as saved, with secrets still
+// encrypted. A missing file holds no settings.
+func readSavedSettings(path string) (map[string]string, error) {
+	saved := make(map[string]string)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return saved, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return saved, nil
+}
+
+// readSettingsFile returns the settings saved from the web UI, decrypted.
+func readSettingsFile(path string, keys settingsKeySource) (map[string]string, []string) {
+	saved, err := readSavedSettings(path)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("Could not read settings: %v", err)}
+	}
+
+	values := make(map[string]string)
+	var problems []string
+	var key []byte
+	for name, value := range saved {
+		if !slices.Contains(uiSettings, name) {
+			problems = append(problems, fmt.Sprintf("%s: unknown setting %q", path, name))
+			continue
+		}
+
+		if strings.HasPrefix(value, encryptedSettingPrefix) {
+			if key == nil {
+				if key, err = keys.key(false); err != nil {
+					problems = append(problems, fmt.Sprintf("%s (%s): %v", name, path, err))
+					continue
+				}
+			}
+			if value, err = decryptSetting(key, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s (%s): %v", name, path, err))
+				continue
+			}
+		}
+		values[name] = value
+	}
+	slices.Sort(problems)
+
+	return values, problems
+}
+
+// writeSettingsFile replaces the settings file. It is written to a
+// temporary file first so that a crash cannot leave it half written.
+func writeSettingsFile(path string, saved map[string]string) error {
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".settings-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// settingsView is what the settings page shows. The API key itself is never
+// sent back.
+type settingsView struct {
+	GrafanaURL      string   `json:"grafanaUrl"`
+	HasAPIKey       bool     `json:"hasApiKey"`
+	SkipTLSVerify   bool     `json:"skipTlsVerify"`
+	ExportDirectory string   `json:"exportDirectory"`
+	Locked          []string `json:"locked"` // Set by .env or the environment, which win over saved settings
+	SettingsFile    string   `json:"settingsFile"`
+	Problems        []string `json:"problems"`
+}
+
+// settingsUpdate is a settings form submitted to be tested or saved.
+type settingsUpdate struct {
+	GrafanaURL      string  `json:"grafanaUrl"`
+	APIKey          *string `json:"apiKey"` // Omitted keeps the current key, empty removes it
+	SkipTLSVerify   bool    `json:"skipTlsVerify"`
+	ExportDirectory string  `json:"exportDirectory"`
+}
+
+// values returns the submitted settings by name; the API key only when one
+// was submitted.
+func (u settingsUpdate) values() map[string]string {
+	values := map[string]string{
+		"GRAFANA_URL":      strings.TrimSpace(u.GrafanaURL),
+		"SKIP_TLS_VERIFY":  strconv.FormatBool(u.SkipTLSVerify),
+		"EXPORT_DIRECTORY": strings.TrimSpace(u.ExportDirectory),
+	}
+	if u.APIKey != nil {
+		values["GRAFANA_API_KEY"] = strings.TrimSpace(*u.APIKey)
+	}
+	return values
+}
+
+// grafanaCredentialSettings are the settings Grafana requests carry as
+// credentials. They belong to the Grafana they were configured for.
+var grafanaCredentialSettings = []string{
+	"GRAFANA_API_KEY", "GRAFANA_PASSWORD", "GRAFANA_AUTH_PROXY_USER",
+	"GRAFANA_ORG_API_KEYS", "GRAFANA_HEADERS", "GRAFANA_COOKIES",
+}
+
+// apply validates the submitted settings and applies them to cfg.
+func (u settingsUpdate) apply(cfg *Config) []string {
+	values := u.values()
+
+	var problems []string
+	if values["GRAFANA_URL"] != cfg.GrafanaURL {
+		problems = u.credentialProblems(cfg)
+	}
+	for _, setting := range configSettings {
+		value, ok := values[setting.name]
+		if !ok {
+			continue
+		}
+		if err := setting.set(cfg, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", setting.name, err))
+		}
+	}
+	return problems
+}
+
+// credentialProblems lists the stored credentials that would be sent to a
+// different Grafana URL. The API key has to be entered again; the others
+// cannot be edited here, so the URL has to be changed where they are set.
+func (u settingsUpdate) credentialProblems(cfg *Config) []string {
+	var problems []string
+	for _, setting := range configSettings {
+		if !slices.Contains(grafanaCredentialSettings, setting.name) || setting.get(cfg) == "" {
+			continue
+		}
+		switch {
+		case setting.name != "GRAFANA_API_KEY":
+			problems = append(problems, fmt.Sprintf("GRAFANA_URL: cannot be changed here while %s is set", setting.name))
+		case u.APIKey == nil:
+			problems = append(problems, "GRAFANA_API_KEY: enter the API key again for the new Grafana URL")
+		}
+	}
+	return problems
+}
+
+func currentSettingsView() settingsView {
+	cfg := currentConfig()
+	status := currentConfigStatus()
+
+	locked := []string{}
+	for _, name := range uiSettings {
+		if source := status.Sources[name]; source == "environment" || source == envFilePath {
+			locked = append(locked, name)
+		}
+	}
+
+	return settingsView{
+		GrafanaURL:      cfg.GrafanaURL,
+		HasAPIKey:       cfg.GrafanaAPIKey != "",
+		SkipTLSVerify:   cfg.SkipTLSVerify,
+		ExportDirectory: cfg.ExportDirectory,
+		Locked:          locked,
+		SettingsFile:    status.SettingsFile,
+		Problems:        status.Problems,
+	}
+}
+
+func getSettings(c echo.Context) error {
+	return c.JSON(http.StatusOK, currentSettingsView())
+}
+
+// testSettings checks the submitted settings against Grafana without saving
+// them.
+func testSettings(c echo.Context) error {
+	var update settingsUpdate
+	if err := c.Bind(&update); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
+
+	cfg := currentConfig()
+	if problems := update.apply(&cfg); len(problems) > 0 {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{"error": "Invalid settings", "problems": problems})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), healthProbeTimeout)
+	defer cancel()
+
+	status := checkGrafana(ctx, cfg)
+	if err := checkExportDirectory(cfg.ExportDirectory); err != nil {
+		status.Issues = append(status.Issues, fmt.Sprintf("Exports cannot be written to %s: %v", cfg.ExportDirectory, err))
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// saveSettings stores the submitted settings, encrypting the API key, and
+// reloads the configuration so that they take effect immediately.
+func saveSettings(c echo.Context) error {
+	audit := newAuditEntry(c, auditActionSettings)
+	defer func() {
+		audit.Status = c.Response().Status
+		auditLogger.Record(audit)
+	}()
+
+	var update settingsUpdate
+	if err := c.Bind(&update); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
+
+	previous := currentConfig()
+	next := previous
+	if problems := update.apply(&next); len(problems) > 0 {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{"error": "Invalid settings", "problems": problems})
+	}
+
+	path := currentConfigStatus().SettingsFile
+	saved, err := readSavedSettings(path)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	for name, value := range update.values() {
+		switch {
+		case name != "GRAFANA_API_KEY":
+			saved[name] = value
+		case value == "":
+			delete(saved, name)
+		default:
+			key, err := currentSettingsKeys().key(true)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+			if saved[name], err = encryptSetting(key, value); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+		}
+	}
+
+	if err := writeSettingsFile(path, saved); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Could not save settings: %v", err)})
+	}
+	log.Printf("Settings saved to %s by %s", path, audit.User)
+
+	for _, setting := range configSettings {
+		if slices.Contains(uiSettings, setting.name) && setting.get(&previous) != setting.get(&next) {
+			audit.Settings = append(audit.Settings, setting.name)
+		}
+	}
+
+	if problems := reloadConfig(c.Request().Context()); len(problems) > 0 {
+		// The file is saved, but the running configuration is unchanged
+		return c.JSON(http.StatusConflict, map[string]interface{}{"error": "Settings saved, but not applied because the configuration has problems", "problems": problems})
+	}
+	return c.JSON(http.StatusOK, currentSettingsView())
+}
+
+// checkExportDirectory makes sure exports can be written to dir without
+// creating it: a missing directory is checked through its nearest existing
+// parent, in which the export will create it.
+func checkExportDirectory(dir string) error {
+	dir = filepath.Clean(dir)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		parent := filepath.Dir(dir)
+		if !errors.Is(err, fs.ErrNotExist) || parent == dir {
+			return err
+		}
+		dir = parent
+	}
+
+	probe, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// useSettingsFile starts a configuration that saves settings in a temporary
+// directory and restores the global state afterwards.
+func useSettingsFile(t *testing.T) string {
+	originalConfig := config
+	originalStartup := startupConfig
+	originalStatus := configStatus
+	originalHealth := health
+	originalCache := metaCache
+	originalEnvFile := envFilePath
+	t.Cleanup(func() {
+		config = originalConfig
+		startupConfig = originalStartup
+		configStatus = originalStatus
+		health = originalHealth
+		metaCache = originalCache
+		envFilePath = originalEnvFile
+		pinGrafanaVersion("")
+	})
+
+	dir := t.TempDir()
+	envFilePath = filepath.Join(dir, ".env")
+	t.Setenv("SETTINGS_FILE", filepath.Join(dir, "settings.json"))
+	t.Setenv("EXPORT_DIRECTORY", filepath.Join(dir, "exported"))
+	health = newHealthChecker(time.Minute)
+	metaCache = newMetadataCache(time.Minute)
+
+	assert.NoError(t, startConfig(loadConfig()))
+	return dir
+}
+
+var settingsTestRoutes = map[string]any{
+	"/api/health":                      `{"database":"ok","version":"11.1.0"}`,
+	"/api/org":                         `{"id":1,"name":"Main Org."}`,
+	"/api/search":                      `[]`,
+	"/api/folders":                     `[]`,
+	"/api/library-elements":            `[]`,
+	"/api/v1/provisioning/alert-rules": `[]`,
+}
+
+func serveSettings(method, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.GET("/api/settings", getSettings)
+	e.PUT("/api/settings", saveSettings)
+	e.POST("/api/settings/test", testSettings)
+
+	req := httptest.NewRequest(method, "/api/settings", strings.NewReader(body))
+	if method == http.MethodPost {
+		req = httptest.NewRequest(method, "/api/settings/test", strings.NewReader(body))
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSettingEncryption(t *testing.T) {
+	key := make([]byte, 32)
+	encrypted, err := encryptSetting(key, "glsa_secret")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, encryptedSettingPrefix))
+	assert.NotContains(t, encrypted, "glsa_secret")
+
+	again, _ := encryptSetting(key, "glsa_secret")
+	assert.NotEqual(t, encrypted, again, "every value gets its own nonce")
+
+	decrypted, err := decryptSetting(key, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "glsa_secret", decrypted)
+
+	otherKey := make([]byte, 32)
+	otherKey[0] = 1
+	_, err = decryptSetting(otherKey, encrypted)
+	assert.Error(t, err)
+}
+
+func TestSaveSettings(t *testing.T) {
+	dir := useSettingsFile(t)
+	t.Setenv("SETTINGS_KEY", "correct horse battery staple")
+	grafana := newFakeGrafanaWithKey("good-key", settingsTestRoutes)
+	defer grafana.Close()
+
+	exportDir := filepath.Join(dir, "exports")
+	rec := serveSettings(http.MethodPut, `{"grafanaUrl":"`+grafana.URL+`","apiKey":"good-key","exportDirectory":"`+exportDir+`"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var view settingsView
+	json.Unmarshal(rec.Body.Bytes(), &view)
+	assert.Equal(t, grafana.URL, view.GrafanaURL)
+	assert.True(t, view.HasAPIKey)
+	assert.NotContains(t, rec.Body.String(), "good-key")
+
+	// Applied without a restart
+	assert.Equal(t, grafana.URL, currentConfig().GrafanaURL)
+	assert.Equal(t, "good-key", currentConfig().GrafanaAPIKey)
+	assert.True(t, health.Status().Ready)
+
+	// The key is encrypted at rest
+	saved, err := os.ReadFile(filepath.Join(dir, "settings.json"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(saved), "good-key")
+	assert.Contains(t, string(saved), encryptedSettingPrefix)
+
+	// Saving without a key keeps it, an empty key removes it
+	rec = serveSettings(http.MethodPut, `{"grafanaUrl":"`+grafana.URL+`","skipTlsVerify":true,"exportDirectory":"`+exportDir+`"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "good-key", currentConfig().GrafanaAPIKey)
+	assert.True(t, currentConfig().SkipTLSVerify)
+
+	rec = serveSettings(http.MethodPut, `{"grafanaUrl":"`+grafana.URL+`","apiKey":"","exportDirectory":"`+exportDir+`"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, currentConfig().GrafanaAPIKey)
+}
+
+func TestSaveSettingsGeneratesKeyFile(t *testing.T) {
+	dir := useSettingsFile(t)
+
+	rec := serveSettings(http.MethodPut, `{"grafanaUrl":"http://127.0.0.1:1","apiKey":"good-key","exportDirectory":"`+dir+`"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	info, err := os.Stat(filepath.Join(dir, "settings.json.key"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// A fresh start decrypts the key with the generated key file
+	loaded := loadConfig()
+	assert.Empty(t, loaded.Problems)
+	assert.Equal(t, "good-key", loaded.Config.GrafanaAPIKey)
+}
+
+func TestSaveSettingsRejectsInvalidValues(t *testing.T) {
+	dir := useSettingsFile(t)
+
+	rec := serveSettings(http.MethodPut, `{"grafanaUrl":"grafana:3000","exportDirectory":""}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "GRAFANA_URL")
+	assert.Contains(t, rec.Body.String(), "EXPORT_DIRECTORY")
+
+	_, err := os.Stat(filepath.Join(dir, "settings.json"))
+	assert.True(t, os.IsNotExist(err), "nothing is saved")
+}
+
+func TestSaveSettingsNotAppliedWithOtherProblems(t *testing.T) {
+	useSettingsFile(t)
+	grafana := newFakeGrafanaWithKey("good-key", settingsTestRoutes)
+	defer grafana.Close()
+
+	t.Setenv("CACHE_TTL", "soon")
+	rec := serveSettings(http.MethodPut, `{"grafanaUrl":"`+grafana.URL+`","apiKey":"good-key","exportDirectory":"./exported"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "CACHE_TTL")
+	assert.NotEqual(t, grafana.URL, currentConfig().GrafanaURL)
+}
+
+func TestSettingsLockedByEnvironment(t *testing.T) {
+	t.Setenv("GRAFANA_URL", "http://from-env:3000")
+	useSettingsFile(t)
+
+	rec := serveSettings(http.MethodGet, "")
+	var view settingsView
+	json.Unmarshal(rec.Body.Bytes(), &view)
+	assert.Equal(t, []string{"GRAFANA_URL", "EXPORT_DIRECTORY"}, view.Locked)
+}
+
+func TestTestSettings(t *testing.T) {
+	dir := useSettingsFile(t)
+	grafana := newFakeGrafanaWithKey("good-key", settingsTestRoutes)
+	defer grafana.Close()
+
+	rec := serveSettings(http.MethodPost, `{"grafanaUrl":"`+grafana.URL+`","apiKey":"good-key","exportDirectory":"`+dir+`"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var status grafanaStatus
+	json.Unmarshal(rec.Body.Bytes(), &status)
+	assert.True(t, status.Ready)
+	assert.Equal(t, "Main Org.", status.Organization)
+
+	rec = serveSettings(http.MethodPost, `{"grafanaUrl":"`+grafana.URL+`","apiKey":"bad-key","exportDirectory":"`+dir+`"}`)
+	json.Unmarshal(rec.Body.Bytes(), &status)
+	assert.False(t, status.Ready)
+	assert.Contains(t, status.Error, "rejected the API key")
+
+	// Testing does not change the running configuration
+	assert.NotEqual(t, grafana.URL, currentConfig().GrafanaURL)
+
+	// nor create the export directory
+	missing := filepath.Join(dir, "new", "exports")
+	rec = serveSettings(http.MethodPost, `{"grafanaUrl":"`+grafana.URL+`","apiKey":"good-key","exportDirectory":"`+missing+`"}`)
+	json.Unmarshal(rec.Body.Bytes(), &status)
+	assert.Empty(t, status.Issues)
+	_, err := os.Stat(filepath.Join(dir, "new"))
+	assert.True(t, os.IsNotExist(err))
+
+	os.WriteFile(filepath.Join(dir, "file"), nil, 0o600)
+	rec = serveSettings(http.MethodPost, `{"grafanaUrl":"`+grafana.URL+`","apiKey":"good-key","exportDirectory":"`+filepath.Join(dir, "file", "exports")+`"}`)
+	json.Unmarshal(rec.Body.Bytes(), &status)
+	if assert.Len(t, status.Issues, 1) {
+		assert.Contains(t, status.Issues[0], "not a directory")
+	}
+}
+
+func TestSettingsKeepCredentialsForTheirURL(t *testing.T) {
+	dir := useSettingsFile(t)
+	grafana := newFakeGrafanaWithKey("good-key", settingsTestRoutes)
+	defer grafana.Close()
+
+	var received []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			received = append(received, auth)
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer other.Close()
+
+	rec := serveSettings(http.MethodPut, `{"grafanaUrl":"`+grafana.URL+`","apiKey":"good-key","exportDirectory":"`+dir+`"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// The stored key is not sent to another URL, neither to test nor to save it
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		rec = serveSettings(method, `{"grafanaUrl":"`+other.URL+`","exportDirectory":"`+dir+`"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, method)
+		assert.Contains(t, rec.Body.String(), "GRAFANA_API_KEY", method)
+	}
+	assert.Empty(t, received)
+	assert.Equal(t, grafana.URL, currentConfig().GrafanaURL)
+
+	// Entering the key again moves it
+	rec = serveSettings(http.MethodPost, `{"grafanaUrl":"`+other.URL+`","apiKey":"other-key","exportDirectory":"`+dir+`"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, received, "Bearer other-key")
+
+	// Credentials set outside the settings page pin the URL
+	t.Setenv("GRAFANA_PASSWORD", "secret")
+	reloadConfig(t.Context())
+	rec = serveSettings(http.MethodPost, `{"grafanaUrl":"`+other.URL+`","apiKey":"other-key","exportDirectory":"`+dir+`"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "GRAFANA_PASSWORD")
+}
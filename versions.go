@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// versionsPageLimit is how many versions are asked for per request.
+const versionsPageLimit = 100
+
+// dashboardVersion is one saved version of a dashboard. Data, the dashboard
+// model, is only part of the answer for a single version.
+type dashboardVersion struct {
+	ID            int                    `json:"id"`
+	Version       int                    `json:"version"`
+	ParentVersion int                    `json:"parentVersion,omitempty"`
+	RestoredFrom  int                    `json:"restoredFrom,omitempty"`
+	Created       string                 `json:"created"`
+	CreatedBy     string                 `json:"createdBy"`
+	Message       string                 `json:"message"`
+	Data          map[string]interface{} `json:"data,omitempty"`
+}
+
+// exportedVersion is how a version is stored in an export.
+type exportedVersion struct {
+	Version      int                    `json:"version"`
+	Created      string                 `json:"created"`
+	CreatedBy    string                 `json:"createdBy"`
+	Message      string                 `json:"message,omitempty"`
+	RestoredFrom int                    `json:"restoredFrom,omitempty"`
+	Dashboard    map[string]interface{} `json:"dashboard"`
+}
+
+// fetchDashboardVersions lists the saved versions of a dashboard, newest
+// first, up to limit of them or all when limit is 0. Grafana 11 pages with a
+// continue token, earlier versions with a start offset.
+func fetchDashboardVersions(ctx context.Context, dash Dashboard, limit int) ([]dashboardVersion, error) {
+	baseURL := currentGrafanaAPI().DashboardVersionsURL(dash)
+	versions := []dashboardVersion{}
+	continueToken := ""
+
+	for {
+		pageSize := versionsPageLimit
+		if limit > 0 && limit-len(versions) < pageSize {
+			pageSize = limit - len(versions)
+		}
+		pageURL := fmt.Sprintf("%s?limit=%d", baseURL, pageSize)
+		if continueToken != "" {
+			pageURL += "&continueToken=" + url.QueryEscape(continueToken)
+		} else if len(versions) > 0 {
+			pageURL += fmt.Sprintf("&start=%d", len(versions))
+		}
+
+		var raw json.RawMessage
+		if err := fetchAPIRaw(ctx, pageURL, &raw); err != nil {
+			return nil, err
+		}
+
+		var page []dashboardVersion
+		continueToken = ""
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			if err := json.Unmarshal(raw, &page); err != nil {
+				return nil, err
+			}
+		} else {
+			var wrapped struct {
+				ContinueToken string             `json:"continueToken"`
+				Versions      []dashboardVersion `json:"versions"`
+			}
+			if err := json.Unmarshal(raw, &wrapped); err != nil {
+				return nil, err
+			}
+			page = wrapped.Versions
+			continueToken = wrapped.ContinueToken
+		}
+
+		if len(page) == 0 || (len(versions) > 0 && page[0].Version == versions[0].Version) {
+			break
+		}
+		versions = append(versions, page...)
+
+		if limit > 0 && len(versions) >= limit {
+			return versions[:limit], nil
+		}
+		if continueToken == "" && len(page) < pageSize {
+			break
+		}
+	}
+
+	return versions, nil
+}
+
+// fetchDashboardVersion returns one saved version of a dashboard with its
+// model.
+func fetchDashboardVersion(ctx context.Context, dash Dashboard, version int) (dashboardVersion, error) {
+	var detail dashboardVersion
+	err := fetchAPIRaw(ctx, currentGrafanaAPI().DashboardVersionURL(dash, version), &detail)
+	return detail, err
+}
+
+// versionsDirectory is where the history of the dashboard exported to
+// dashboardFile is stored, one v<N>.json per version.
+func versionsDirectory(dashboardFile string) string {
+	return strings.TrimSuffix(dashboardFile, ".json") + ".versions"
+}
+
+// exportDashboardVersions stores the last limit versions of a dashboard,
+// or all of them when limit is 0, next to its file.
+func exportDashboardVersions(ctx context.Context, dash Dashboard, dashboardFile string, limit int, result *exportResult) {
+	versions, err := fetchDashboardVersions(ctx, dash, limit)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to list versions of dashboard %s: %v", dash.UID, err))
+		return
+	}
+
+	dir := versionsDirectory(dashboardFile)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to create versions folder for %s: %v", dash.UID, err))
+		return
+	}
+
+	for _, version := range versions {
+		detail, err := fetchDashboardVersion(ctx, dash, version.Version)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to fetch version %d of dashboard %s: %v", version.Version, dash.UID, err))
+			continue
+		}
+
+		data, err := json.MarshalIndent(exportedVersion{
+			Version:      detail.Version,
+			Created:      detail.Created,
+			CreatedBy:    detail.CreatedBy,
+			Message:      detail.Message,
+			RestoredFrom: detail.RestoredFrom,
+			Dashboard:    detail.Data,
+		}, "", "  ")
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, fmt.Sprintf("v%d.json", version.Version)), data, 0644)
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to write version %d of dashboard %s: %v", version.Version, dash.UID, err))
+			continue
+		}
+		result.ExportedVersions++
+	}
+}
+
+// versionChange is one difference between two dashboard models. Path
+// addresses the value like "panels[2].title".
+type versionChange struct {
+	Path string      `json:"path"`
+	Kind string      `json:"kind"` // added, removed or changed
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// restoreResult reports a restore like exportResult reports an export.
+type restoreResult struct {
+	UID             string   `json:"uid"`
+	RestoredVersion int      `json:"restoredVersion"`
+	Version         int      `json:"version"` // The version the restore saved
+	Method          string   `json:"method"`  // "restore" or "save", see restoreVersion
+	Errors          []string `json:"errors"`
+}
+
+// fetchDashboardRef fetches the dashboard uid, returning the reference the
+// version endpoints address it by along with its model.
+func fetchDashboardRef(ctx context.Context, uid string) (Dashboard, DashboardWithMeta, error) {
+	url := fmt.Sprintf("%s/api/dashboards/uid/%s", currentConfig().GrafanaURL, uid)
+	dashboard, err := fetchAPI[DashboardWithMeta](ctx, url)
+	if err != nil {
+		return Dashboard{}, dashboard, err
+	}
+
+	id, _ := dashboard.Dashboard["id"].(float64)
+	title, _ := dashboard.Dashboard["title"].(string)
+	return Dashboard{
+		ID:      int(id),
+		UID:     uid,
+		Title:   title,
+		Version: extractVersionNumber(dashboard.Dashboard),
+	}, dashboard, nil
+}
+
+// getDashboardVersions lists the saved versions of a dashboard, newest first.
+// ?limit caps how many are returned.
+func getDashboardVersions(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	limit := 0
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be a non-negative number"})
+		}
+		limit = parsed
+	}
+
+	dash, _, err := fetchDashboardRef(ctx, c.Param("uid"))
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("Could not read the dashboard: %v", err)})
+	}
+	versions, err := fetchDashboardVersions(ctx, dash, limit)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("Could not list the versions: %v", err)})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"uid":      dash.UID,
+		"title":    dash.Title,
+		"version":  dash.Version,
+		"versions": versions,
+	})
+}
+
+// getDashboardVersion returns one saved version of a dashboard with its model.
+func getDashboardVersion(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid version"})
+	}
+
+	dash, _, err := fetchDashboardRef(ctx, c.Param("uid"))
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("Could not read the dashboard: %v", err)})
+	}
+	detail, err := fetchDashboardVersion(ctx, dash, version)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("Could not read version %d: %v", version, err)})
+	}
+	return c.JSON(http.StatusOK, detail)
+}
+
+// diffDashboardVersions compares the models of the versions ?base and ?new
+// of a dashboard.
+func diffDashboardVersions(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	base, baseErr := strconv.Atoi(c.QueryParam("base"))
+	next, nextErr := strconv.Atoi(c.QueryParam("new"))
+	if baseErr != nil || nextErr != nil || base < 1 || next < 1 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "base and new must be version numbers"})
+	}
+
+	dash, _, err := fetchDashboardRef(ctx, c.Param("uid"))
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("Could not read the dashboard: %v", err)})
+	}
+	models := make(map[int]map[string]interface{}, 2)
+	for _, version := range []int{base, next} {
+		detail, err := fetchDashboardVersion(ctx, dash, version)
+		if err != nil {
+			return c.JSON(http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("Could not read version %d: %v", version, err)})
+		}
+		models[version] = detail.Data
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"uid":     dash.UID,
+		"base":    base,
+		"new":     next,
+		"changes": diffDashboardModels(models[base], models[next]),
+	})
+}
+
+// diffDashboardModels lists what changed from base to next, ordered by path.
+// Arrays are compared by position, so a panel moved up shows as changes to
+// both positions.
+func diffDashboardModels(base, next map[string]interface{}) []versionChange {
+	changes := []versionChange{}
+	diffValues("", base, next, &changes)
+	return changes
+}
+
+func diffValues(path string, base, next interface{}, changes *[]versionChange) {
+	switch baseValue := base.(type) {
+	case map[string]interface{}:
+		nextValue, ok := next.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := slices.Collect(maps.Keys(baseValue))
+		for key := range nextValue {
+			if _, ok := baseValue[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			baseChild, inBase := baseValue[key]
+			nextChild, inNext := nextValue[key]
+			switch {
+			case !inBase:
+				*changes = append(*changes, versionChange{Path: child, Kind: "added", New: nextChild})
+			case !inNext:
+				*changes = append(*changes, versionChange{Path: child, Kind: "removed", Old: baseChild})
+			default:
+				diffValues(child, baseChild, nextChild, changes)
+			}
+		}
+		return
+	case []interface{}:
+		nextValue, ok := next.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < max(len(baseValue), len(nextValue)); i++ {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(baseValue):
+				*changes = append(*changes, versionChange{Path: child, Kind: "added", New: nextValue[i]})
+			case i >= len(nextValue):
+				*changes = append(*changes, versionChange{Path: child, Kind: "removed", Old: baseValue[i]})
+			default:
+				diffValues(child, baseValue[i], nextValue[i], changes)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(base, next) {
+		*changes = append(*changes, versionChange{Path: path, Kind: "changed", Old: base, New: next})
+	}
+}
+
+// restoreDashboardVersion makes a saved version of a dashboard its newest
+// version again, and records it in the audit log.
+func restoreDashboardVersion(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	audit := newAuditEntry(c, auditActionRestore)
+	defer func() {
+		audit.Status = c.Response().Status
+		auditLogger.Record(audit)
+	}()
+
+	uid := c.Param("uid")
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid version"})
+	}
+	audit.UIDs = map[string][]string{"dashboards": {uid}, "versions": {strconv.Itoa(version)}}
+
+	result := restoreVersion(ctx, uid, version)
+	audit.Errors = result.Errors
+	if len(result.Errors) > 0 {
+		return c.JSON(http.StatusBadGateway, result)
+	}
+
+	audit.Counts = map[string]int{"dashboards": 1}
+	metaCache.Delete(cacheDashboardDetails, scopedCacheKey(ctx, uid))
+	metaCache.Delete(cacheDashboardReferences, scopedCacheKey(ctx, "dashboard:"+uid))
+	metaCache.Invalidate(cacheDashboardSearch)
+	return c.JSON(http.StatusOK, result)
+}
+
+// restoreVersion asks Grafana to restore a version of the dashboard uid.
+// Grafanas without the restore endpoint get the old model saved over the
+// current one instead, which Grafana refuses if the dashboard changed since
+// it was read.
+func restoreVersion(ctx context.Context, uid string, version int) restoreResult {
+	result := restoreResult{UID: uid, RestoredVersion: version, Errors: []string{}}
+
+	dash, current, err := fetchDashboardRef(ctx, uid)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to fetch dashboard %s: %v", uid, err))
+		return result
+	}
+
+	var saved struct {
+		Version int `json:"version"`
+	}
+	err = sendAPI(ctx, http.MethodPost, currentGrafanaAPI().DashboardRestoreURL(dash), map[string]int{"version": version}, &saved)
+	var apiErr *grafanaAPIError
+	if err == nil {
+		result.Method = "restore"
+		result.Version = saved.Version
+		return result
+	}
+	if !errors.As(err, &apiErr) || (apiErr.StatusCode != http.StatusNotFound && apiErr.StatusCode != http.StatusMethodNotAllowed) {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to restore version %d of dashboard %s: %v", version, uid, err))
+		return result
+	}
+
+	detail, err := fetchDashboardVersion(ctx, dash, version)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to fetch version %d of dashboard %s: %v", version, uid, err))
+		return result
+	}
+	if detail.Data == nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Version %d of dashboard %s has no dashboard model", version, uid))
+		return result
+	}
+
+	model := detail.Data
+	model["id"] = dash.ID
+	model["uid"] = uid
+	model["version"] = dash.Version
+	err = sendAPI(ctx, http.MethodPost, currentConfig().GrafanaURL+"/api/dashboards/db", map[string]interface{}{
+		"dashboard": model,
+		"folderId":  current.Meta.FolderID,
+		"folderUid": current.Meta.FolderUID,
+		"message":   fmt.Sprintf("Restored from version %d", version),
+		"overwrite": false,
+	}, &saved)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to save version %d of dashboard %s: %v", version, uid, err))
+		return result
+	}
+	result.Method = "save"
+	result.Version = saved.Version
+	return result
+}
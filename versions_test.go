@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// newVersionsTestGrafana serves a dashboard with versions 1 to 5. With
+// continueTokens it pages like Grafana 11, otherwise with start offsets.
+func newVersionsTestGrafana(continueTokens bool) *httptest.Server {
+	return newFakeGrafana(versionsTestRoutes(continueTokens))
+}
+
+func versionsTestRoutes(continueTokens bool) map[string]any {
+	routes := map[string]any{
+		"/api/dashboards/uid/dash-1": `{"dashboard":{"id":11,"uid":"dash-1","title":"Service","version":5,"panels":[]},"meta":{"folderId":0}}`,
+		"/api/dashboards/uid/dash-1/versions": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+			if token := r.URL.Query().Get("continueToken"); token != "" {
+				start, _ = strconv.Atoi(token)
+			}
+
+			page := []map[string]interface{}{}
+			for version := 5 - start; version >= 1 && len(page) < limit; version-- {
+				page = append(page, map[string]interface{}{"id": 100 + version, "version": version, "created": "2026-10-0" + strconv.Itoa(version) + "T00:00:00Z"})
+			}
+			if !continueTokens {
+				json.NewEncoder(w).Encode(page)
+				return
+			}
+			next := ""
+			if start+len(page) < 5 {
+				next = strconv.Itoa(start + len(page))
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"continueToken": next, "versions": page})
+		}),
+	}
+	for version := 1; version <= 5; version++ {
+		routes[fmt.Sprintf("/api/dashboards/uid/dash-1/versions/%d", version)] = fmt.Sprintf(
+			`{"id":1%[1]d,"version":%[1]d,"created":"2026-10-0%[1]dT00:00:00Z","createdBy":"alice","message":"change %[1]d","data":{"title":"Service","version":%[1]d}}`, version)
+	}
+	return routes
+}
+
+func TestFetchDashboardVersions(t *testing.T) {
+	originalConfig := config
+	defer func() { config = originalConfig }()
+
+	for _, continueTokens := range []bool{false, true} {
+		grafana := newVersionsTestGrafana(continueTokens)
+		config = Config{GrafanaURL: grafana.URL}
+
+		versions, err := fetchDashboardVersions(t.Context(), Dashboard{UID: "dash-1"}, 0)
+		assert.NoError(t, err)
+		assert.Len(t, versions, 5)
+		assert.Equal(t, 5, versions[0].Version)
+		assert.Equal(t, 1, versions[4].Version)
+
+		versions, err = fetchDashboardVersions(t.Context(), Dashboard{UID: "dash-1"}, 2)
+		assert.NoError(t, err)
+		assert.Len(t, versions, 2)
+		assert.Equal(t, 4, versions[1].Version)
+
+		grafana.Close()
+	}
+}
+
+func TestFetchDashboardVersionsPagesThroughHistory(t *testing.T) {
+	// Longer histories than one page are walked to the end
+	var requests atomic.Int32
+	grafana := newFakeGrafana(map[string]any{
+		"/api/dashboards/uid/long/versions": countRequests(&requests, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+			page := []map[string]int{}
+			for version := 150 - start; version >= 1 && len(page) < versionsPageLimit; version-- {
+				page = append(page, map[string]int{"version": version})
+			}
+			json.NewEncoder(w).Encode(page)
+		})),
+	})
+	defer grafana.Close()
+
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	config = Config{GrafanaURL: grafana.URL}
+
+	versions, err := fetchDashboardVersions(t.Context(), Dashboard{UID: "long"}, 0)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 150)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestExportDashboardVersions(t *testing.T) {
+	grafana := newVersionsTestGrafana(true)
+	defer grafana.Close()
+
+	originalConfig := config
+	originalCache := metaCache
+	defer func() {
+		config = originalConfig
+		metaCache = originalCache
+	}()
+	config = Config{GrafanaURL: grafana.URL, ExportDirectory: t.TempDir()}
+	metaCache = newMetadataCache(time.Minute)
+
+	e := echo.New()
+	body := `{"dashboardUIDs":["dash-1"],"includeVersions":true,"versionLimit":3}`
+	req := httptest.NewRequest(http.MethodPost, "/api/export", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, exportDashboards(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var result exportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, 3, result.ExportedVersions)
+
+	dir := filepath.Join(result.ExportPath, "General", "Service.versions")
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 3)
+
+	data, err := os.ReadFile(filepath.Join(dir, "v4.json"))
+	assert.NoError(t, err)
+	var version exportedVersion
+	json.Unmarshal(data, &version)
+	assert.Equal(t, exportedVersion{
+		Version:   4,
+		Created:   "2026-10-04T00:00:00Z",
+		CreatedBy: "alice",
+		Message:   "change 4",
+		Dashboard: map[string]interface{}{"title": "Service", "version": float64(4)},
+	}, version)
+}
+
+func TestDiffDashboardModels(t *testing.T) {
+	base := map[string]interface{}{
+		"title":   "Service",
+		"version": float64(1),
+		"tags":    []interface{}{"prod"},
+		"panels": []interface{}{
+			map[string]interface{}{"title": "CPU", "type": "graph"},
+			map[string]interface{}{"title": "Memory"},
+		},
+		"refresh": "1m",
+	}
+	next := map[string]interface{}{
+		"title":   "Service",
+		"version": float64(2),
+		"tags":    []interface{}{"prod", "team-a"},
+		"panels": []interface{}{
+			map[string]interface{}{"title": "CPU", "type": "timeseries"},
+		},
+		"timezone": "utc",
+	}
+
+	assert.Equal(t, []versionChange{
+		{Path: "panels[0].type", Kind: "changed", Old: "graph", New: "timeseries"},
+		{Path: "panels[1]", Kind: "removed", Old: map[string]interface{}{"title": "Memory"}},
+		{Path: "refresh", Kind: "removed", Old: "1m"},
+		{Path: "tags[1]", Kind: "added", New: "team-a"},
+		{Path: "timezone", Kind: "added", New: "utc"},
+		{Path: "version", Kind: "changed", Old: float64(1), New: float64(2)},
+	}, diffDashboardModels(base, next))
+	assert.Empty(t, diffDashboardModels(base, base))
+}
+
+func TestDashboardVersionEndpoints(t *testing.T) {
+	grafana := newVersionsTestGrafana(false)
+	defer grafana.Close()
+
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	config = Config{GrafanaURL: grafana.URL}
+
+	e := echo.New()
+	e.GET("/api/dashboards/:uid/versions", getDashboardVersions)
+	e.GET("/api/dashboards/:uid/versions/diff", diffDashboardVersions)
+	e.GET("/api/dashboards/:uid/versions/:version", getDashboardVersion)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/dashboards/dash-1/versions?limit=2", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var list struct {
+		Title    string             `json:"title"`
+		Version  int                `json:"version"`
+		Versions []dashboardVersion `json:"versions"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Equal(t, "Service", list.Title)
+	assert.Equal(t, 5, list.Version)
+	assert.Len(t, list.Versions, 2)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/dashboards/dash-1/versions/3", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"message":"change 3"`)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/dashboards/dash-1/versions/diff?base=2&new=4", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var diff struct {
+		Changes []versionChange `json:"changes"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &diff))
+	assert.Equal(t, []versionChange{{Path: "version", Kind: "changed", Old: float64(2), New: float64(4)}}, diff.Changes)
+
+	for _, url := range []string{
+		"/api/dashboards/dash-1/versions?limit=-1",
+		"/api/dashboards/dash-1/versions/latest",
+		"/api/dashboards/dash-1/versions/diff?base=2",
+	} {
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/dashboards/missing/versions", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+}
+
+// newRestoreTestGrafana serves dash-1 at version 5 in folder ops. Without
+// restoreEndpoint, /restore is missing as in Grafanas that dropped it; saved
+// receives what was posted to /api/dashboards/db instead.
+func newRestoreTestGrafana(restoreEndpoint bool, saved *map[string]interface{}) *httptest.Server {
+	routes := versionsTestRoutes(false)
+	routes["/api/dashboards/uid/dash-1"] = `{"dashboard":{"id":11,"uid":"dash-1","title":"Service","version":5},"meta":{"folderId":7,"folderUid":"ops"}}`
+	if restoreEndpoint {
+		routes["/api/dashboards/uid/dash-1/restore"] = `{"status":"success","uid":"dash-1","version":6}`
+	}
+	routes["/api/dashboards/db"] = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(saved)
+		w.Write([]byte(`{"status":"success","uid":"dash-1","version":6}`))
+	})
+	return newFakeGrafana(routes)
+}
+
+func TestRestoreVersion(t *testing.T) {
+	originalConfig := config
+	defer func() { config = originalConfig }()
+
+	var saved map[string]interface{}
+	grafana := newRestoreTestGrafana(true, &saved)
+	config = Config{GrafanaURL: grafana.URL}
+	result := restoreVersion(t.Context(), "dash-1", 3)
+	grafana.Close()
+	assert.Equal(t, restoreResult{UID: "dash-1", RestoredVersion: 3, Version: 6, Method: "restore", Errors: []string{}}, result)
+	assert.Nil(t, saved)
+
+	// Without the restore endpoint the old model is saved over the current one
+	grafana = newRestoreTestGrafana(false, &saved)
+	defer grafana.Close()
+	config = Config{GrafanaURL: grafana.URL}
+	result = restoreVersion(t.Context(), "dash-1", 3)
+	assert.Equal(t, restoreResult{UID: "dash-1", RestoredVersion: 3, Version: 6, Method: "save", Errors: []string{}}, result)
+	assert.Equal(t, map[string]interface{}{"id": float64(11), "uid": "dash-1", "title": "Service", "version": float64(5)}, saved["dashboard"])
+	assert.Equal(t, "ops", saved["folderUid"])
+	assert.Equal(t, "Restored from version 3", saved["message"])
+	assert.Equal(t, false, saved["overwrite"])
+}
+
+func TestRestoreIsAudited(t *testing.T) {
+	originalConfig := config
+	originalAudit := auditLogger
+	defer func() {
+		config = originalConfig
+		auditLogger = originalAudit
+	}()
+
+	var saved map[string]interface{}
+	grafana := newRestoreTestGrafana(true, &saved)
+	defer grafana.Close()
+
+	tempDir := t.TempDir()
+	config = Config{GrafanaURL: grafana.URL}
+	var err error
+	auditLogger, err = openAuditLog(filepath.Join(tempDir, "audit.log"))
+	assert.NoError(t, err)
+
+	e := echo.New()
+	e.POST("/api/dashboards/:uid/versions/:version/restore", restoreDashboardVersion)
+
+	for _, uid := range []string{"dash-1", "missing"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/dashboards/"+uid+"/versions/3/restore", nil))
+		if uid == "dash-1" {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		} else {
+			assert.Equal(t, http.StatusBadGateway, rec.Code)
+		}
+	}
+
+	entries, total, err := auditLogger.Query(auditFilter{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, 1, entries[1].Counts["dashboards"])
+	for _, entry := range entries {
+		assert.Equal(t, auditActionRestore, entry.Action)
+		assert.Equal(t, []string{"3"}, entry.UIDs["versions"])
+	}
+}